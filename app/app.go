@@ -3,33 +3,121 @@ package app
 import (
 	"claude-squad/config"
 	"claude-squad/keys"
+	"claude-squad/lock"
 	"claude-squad/log"
 	"claude-squad/session"
+	"claude-squad/session/tmux"
 	"claude-squad/ui"
 	"claude-squad/ui/overlay"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
 )
 
 const GlobalInstanceLimit = 10
 
+// ErrStartupTimeout is returned by Run when loading the instances takes longer than the configured startup timeout.
+var ErrStartupTimeout = errors.New("timed out starting up")
+
 // Run is the main entrypoint into the application.
 func Run(ctx context.Context, program string, autoYes bool, repoPath string) error {
+	h, err := startHome(ctx, program, autoYes, repoPath)
+	if err != nil {
+		return err
+	}
+
 	p := tea.NewProgram(
-		newHome(ctx, program, autoYes, repoPath),
+		h,
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(), // Mouse scroll
+		// We handle signals ourselves so that they shut down through Update, which saves the instances.
+		tea.WithoutSignalHandler(),
 	)
-	_, err := p.Run()
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go shutdownOnSignal(ctx, p, finished)
+
+	_, err = p.Run()
+	if errors.Is(err, tea.ErrProgramKilled) {
+		// The program was killed by shutdownOnSignal after it failed to quit in time. Exiting normally still
+		// releases the repository lock.
+		return nil
+	}
 	return err
 }
 
+// shutdownGracePeriod is how long shutdownOnSignal waits for the TUI to save and quit before killing it.
+const shutdownGracePeriod = 5 * time.Second
+
+// shutdownOnSignal asks the TUI to save its instances and quit when the process is told to terminate (e.g. by
+// kill, or by the terminal going away) or ctx is cancelled. tmux sessions are left running. If the TUI doesn't
+// quit in time, e.g. because it's attached to an instance, it's killed without saving, so that the caller can still
+// release the lock and exit. It returns once finished is closed.
+func shutdownOnSignal(ctx context.Context, p *tea.Program, finished <-chan struct{}) {
+	sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+
+	select {
+	case <-finished:
+		return
+	case <-sigCtx.Done():
+	}
+
+	log.InfoLog.Printf("shutting down on signal or cancellation")
+	p.Send(shutdownMsg{})
+	select {
+	case <-finished:
+	case <-time.After(shutdownGracePeriod):
+		log.ErrorLog.Printf("TUI did not quit within %s, exiting without saving", shutdownGracePeriod)
+		p.Kill()
+	}
+}
+
+// shutdownMsg tells the TUI to save its instances and quit.
+type shutdownMsg struct{}
+
+// startHome runs newHome under a watchdog. Loading instances queries tmux and git, which can hang (e.g. on a
+// wedged tmux server or a network filesystem), so give up with an actionable error instead of blocking forever.
+func startHome(ctx context.Context, program string, autoYes bool, repoPath string) (*home, error) {
+	timeout := time.Duration(config.LoadConfig().StartupTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultStartupTimeout * time.Second
+	}
+	startCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The channel is buffered so the goroutine can finish and exit if we stop waiting for it.
+	done := make(chan *home, 1)
+	go func() {
+		done <- newHome(ctx, startCtx, program, autoYes, repoPath)
+	}()
+
+	select {
+	case h := <-done:
+		return h, nil
+	case <-startCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.ErrorLog.Printf("startup did not finish within %s", timeout)
+		return nil, fmt.Errorf("%w: loading instances took longer than %s. tmux or git may be hung: "+
+			"check 'tmux ls', run 'cs cleanup' to find stuck sessions, or raise startup_timeout in the config",
+			ErrStartupTimeout, timeout)
+	}
+}
+
 type state int
 
 const (
@@ -53,9 +141,15 @@ type home struct {
 
 	program string
 	autoYes bool
+	// repoPath is the canonical path of the repository whose instances are shown.
+	repoPath string
 
 	// storage is the interface for saving/loading data to/from the app's state
 	storage *session.Storage
+	// archived holds the archived instances. They are hidden from the list but must be kept when saving.
+	archived []*session.Instance
+	// loadErr describes the stored instances that couldn't be loaded. It's shown when the app starts.
+	loadErr error
 	// appConfig stores persistent application configuration
 	appConfig *config.Config
 	// appState stores persistent application state like seen help screens
@@ -97,7 +191,9 @@ type home struct {
 	confirmationOverlay *overlay.ConfirmationOverlay
 }
 
-func newHome(ctx context.Context, program string, autoYes bool, repoPath string) *home {
+// newHome sets up the TUI and loads the repository's instances. Loading stops early if loadCtx is cancelled, e.g.
+// when startHome gave up waiting for it.
+func newHome(ctx, loadCtx context.Context, program string, autoYes bool, repoPath string) *home {
 	// Load application config
 	appConfig := config.LoadConfig()
 
@@ -121,25 +217,38 @@ func newHome(ctx context.Context, program string, autoYes bool, repoPath string)
 		appConfig:    appConfig,
 		program:      program,
 		autoYes:      autoYes,
+		repoPath:     repoPath,
 		state:        stateDefault,
 		appState:     appState,
 	}
 	h.list = ui.NewList(&h.spinner, autoYes)
 
-	// Load saved instances
-	instances, err := storage.LoadInstances()
-	if err != nil {
-		fmt.Printf("Failed to load instances: %v\n", err)
-		os.Exit(1)
+	// Undo the creations a crash interrupted before the instance was saved. The repository lock is held.
+	if interrupted, err := storage.RecoverInterruptedCreations(repoPath); err != nil {
+		log.ErrorLog.Printf("failed to recover interrupted creations: %v", err)
+	} else if len(interrupted) > 0 {
+		log.WarningLog.Printf("recovered interrupted creations: %+v", interrupted)
+	}
+	// For the same reason, instances whose worktree went missing can be repaired rather than only loaded paused.
+	if repaired, err := storage.RepairInstances(); err != nil {
+		log.ErrorLog.Printf("failed to repair instances: %v", err)
+	} else if len(repaired) > 0 {
+		log.WarningLog.Printf("paused instances with missing worktrees: %v", repaired)
 	}
 
-	// Add loaded instances to the list
-	for _, instance := range instances {
+	// Load saved instances, adding each to the list as it's restored.
+	// Instances that fail to load are skipped; the error is shown once the UI is up.
+	err = storage.StreamInstances(loadCtx, func(instance *session.Instance) {
+		if instance.Archived {
+			h.archived = append(h.archived, instance)
+			return
+		}
 		// Call the finalizer immediately.
 		h.list.AddInstance(instance)()
-		if autoYes {
-			instance.AutoYes = true
-		}
+		instance.ApplyAutoYes(autoYes)
+	})
+	if err != nil {
+		h.loadErr = fmt.Errorf("some instances failed to load: %w", err)
 	}
 
 	return h
@@ -180,14 +289,18 @@ func (m *home) updateHandleWindowSizeEvent(msg tea.WindowSizeMsg) {
 func (m *home) Init() tea.Cmd {
 	// Upon starting, we want to start the spinner. Whenever we get a spinner.TickMsg, we
 	// update the spinner, which sends a new spinner.TickMsg. I think this lasts forever lol.
-	return tea.Batch(
+	cmds := []tea.Cmd{
 		m.spinner.Tick,
 		func() tea.Msg {
 			time.Sleep(100 * time.Millisecond)
 			return previewTickMsg{}
 		},
 		tickUpdateMetadataCmd,
-	)
+	}
+	if m.loadErr != nil {
+		cmds = append(cmds, m.handleError(m.loadErr))
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -207,18 +320,25 @@ func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.menu.ClearKeydown()
 		return m, nil
 	case tickUpdateMetadataMessage:
+		live := session.LiveSessions()
 		for _, instance := range m.list.GetInstances() {
 			if !instance.Started() || instance.Paused() {
 				continue
 			}
+			if status := instance.StatusIn(live); status == session.Crashed || status == session.Done {
+				instance.SetStatus(status)
+				continue
+			}
 			updated, prompt := instance.HasUpdated()
 			if updated {
 				instance.SetStatus(session.Running)
 			} else {
 				if prompt {
-					instance.TapEnter()
+					if _, err := instance.AcceptPrompt(m.appConfig.AutoYesFor(instance.Program)); err != nil {
+						log.ErrorLog.Printf("%s: %v", instance.Title, err)
+					}
 				} else {
-					instance.SetStatus(session.Ready)
+					instance.SetStatus(session.Idle)
 				}
 			}
 			if err := instance.UpdateDiffStats(); err != nil {
@@ -249,6 +369,11 @@ func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.updateHandleWindowSizeEvent(msg)
 		return m, nil
+	case shutdownMsg:
+		if err := m.saveInstances(); err != nil {
+			log.ErrorLog.Printf("failed to save instances on shutdown: %v", err)
+		}
+		return m, tea.Quit
 	case error:
 		// Handle errors from confirmation actions
 		return m, m.handleError(msg)
@@ -263,8 +388,35 @@ func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// saveInstances persists the instances in the list along with the archived ones.
+func (m *home) saveInstances() error {
+	instances := append([]*session.Instance{}, m.list.GetInstances()...)
+	return m.storage.SaveInstances(append(instances, m.archived...))
+}
+
+// checkInstanceLimit returns an error if no more instances can be created: the list is full, or the configured
+// max_instances is reached.
+func (m *home) checkInstanceLimit() error {
+	if m.list.NumInstances() >= GlobalInstanceLimit {
+		return fmt.Errorf("you can't create more than %d instances", GlobalInstanceLimit)
+	}
+	return session.CheckInstanceLimit(m.list.NumInstances(), m.appConfig.MaxInstances)
+}
+
+// otherInstances returns the data of all instances except the given one, including archived ones.
+func (m *home) otherInstances(except *session.Instance) []session.InstanceData {
+	instances := append([]*session.Instance{}, m.list.GetInstances()...)
+	var others []session.InstanceData
+	for _, instance := range append(instances, m.archived...) {
+		if instance != except {
+			others = append(others, instance.ToInstanceData())
+		}
+	}
+	return others
+}
+
 func (m *home) handleQuit() (tea.Model, tea.Cmd) {
-	if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+	if err := m.saveInstances(); err != nil {
 		return m, m.handleError(err)
 	}
 	return m, tea.Quit
@@ -336,6 +488,9 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 			if len(instance.Title) == 0 {
 				return m, m.handleError(fmt.Errorf("title cannot be empty"))
 			}
+			if err := session.CheckTitleAvailable(instance.Title, m.otherInstances(instance)); err != nil {
+				return m, m.handleError(err)
+			}
 
 			// Transition to program selection state
 			m.state = stateSelectProgram
@@ -346,10 +501,17 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 				"e.g., claude, aider --model X",
 				m.program,
 			)
+			// Show what creating the instance will do, like cs new --dry-run, before the program is picked.
+			if plan, err := instance.Plan(); err != nil {
+				log.WarningLog.Printf("failed to plan instance %s: %v", instance.Title, err)
+			} else {
+				m.singleLineInputOverlay.Description = fmt.Sprintf("Branch:   %s (from %s)\nWorktree: %s\nTmux:     %s",
+					plan.Branch, plan.BaseRef, plan.WorktreePath, plan.TmuxSession)
+			}
 
 			return m, tea.WindowSize()
 		case tea.KeyRunes:
-			if len(instance.Title) >= 32 {
+			if utf8.RuneCountInString(instance.Title) >= 32 {
 				return m, m.handleError(fmt.Errorf("title cannot be longer than 32 characters"))
 			}
 			if err := instance.SetTitle(instance.Title + string(msg.Runes)); err != nil {
@@ -359,7 +521,8 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 			if len(instance.Title) == 0 {
 				return m, nil
 			}
-			if err := instance.SetTitle(instance.Title[:len(instance.Title)-1]); err != nil {
+			runes := []rune(instance.Title)
+			if err := instance.SetTitle(string(runes[:len(runes)-1])); err != nil {
 				return m, m.handleError(err)
 			}
 		case tea.KeySpace:
@@ -414,16 +577,18 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 				}
 
 				// Save after adding new instance
-				if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+				if err := m.saveInstances(); err != nil {
 					m.singleLineInputOverlay = nil
 					return m, m.handleError(err)
 				}
+				instance.CreationSaved()
+				if err := config.RegisterRepo(instance.Path); err != nil {
+					log.WarningLog.Printf("failed to register repo: %v", err)
+				}
 
 				// Instance added successfully, call the finalizer
 				m.newInstanceFinalizer()
-				if m.autoYes {
-					instance.AutoYes = true
-				}
+				instance.ApplyAutoYes(m.autoYes)
 
 				// Close the overlay
 				m.singleLineInputOverlay = nil
@@ -534,9 +699,8 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 	case keys.KeyHelp:
 		return m.showHelpScreen(helpTypeGeneral{}, nil)
 	case keys.KeyPrompt:
-		if m.list.NumInstances() >= GlobalInstanceLimit {
-			return m, m.handleError(
-				fmt.Errorf("you can't create more than %d instances", GlobalInstanceLimit))
+		if err := m.checkInstanceLimit(); err != nil {
+			return m, m.handleError(err)
 		}
 		instance, err := session.NewInstance(session.InstanceOptions{
 			Title:   "",
@@ -555,9 +719,8 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 
 		return m, nil
 	case keys.KeyNew:
-		if m.list.NumInstances() >= GlobalInstanceLimit {
-			return m, m.handleError(
-				fmt.Errorf("you can't create more than %d instances", GlobalInstanceLimit))
+		if err := m.checkInstanceLimit(); err != nil {
+			return m, m.handleError(err)
 		}
 		instance, err := session.NewInstance(session.InstanceOptions{
 			Title:   "",
@@ -595,6 +758,10 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		if selected == nil {
 			return m, nil
 		}
+		// Refuse up front: the list drops the instance even if killing it fails.
+		if err := config.CheckSafeMode("killing instance " + selected.Title); err != nil {
+			return m, m.handleError(err)
+		}
 
 		// Create the kill action as a tea.Cmd
 		killAction := func() tea.Msg {
@@ -663,6 +830,30 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 			m.instanceChanged()
 		})
 		return m, nil
+	case keys.KeyAutoYes:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil {
+			return m, nil
+		}
+		selected.ToggleAutoYes()
+		if err := m.saveInstances(); err != nil {
+			return m, m.handleError(err)
+		}
+		return m, nil
+	case keys.KeyAgent:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil {
+			return m, nil
+		}
+		names := tmux.AgentNames()
+		next := names[(slices.Index(names, selected.AgentName())+1)%len(names)]
+		if err := selected.SetAgent(next); err != nil {
+			return m, m.handleError(err)
+		}
+		if err := m.saveInstances(); err != nil {
+			return m, m.handleError(err)
+		}
+		return m, nil
 	case keys.KeyResume:
 		selected := m.list.GetSelectedInstance()
 		if selected == nil {
@@ -682,6 +873,24 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		}
 		// Show help screen before attaching
 		m.showHelpScreen(helpTypeInstanceAttach{}, func() {
+			// Like cs attach, hold the instance while attached so another process can't attach to, squash or
+			// archive it meanwhile.
+			instanceLock, err := lock.AcquireInstanceLock(m.repoPath, selected.Title)
+			if err != nil {
+				m.handleError(err)
+				return
+			}
+			defer func() {
+				if err := instanceLock.Release(); err != nil {
+					log.ErrorLog.Printf("failed to release instance lock: %v", err)
+				}
+			}()
+			// Fit the window to this terminal first, in case it was sized for another client.
+			if cols, rows, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+				if err := selected.Resize(cols, rows); err != nil {
+					log.WarningLog.Printf("failed to resize %s before attaching: %v", selected.Title, err)
+				}
+			}
 			ch, err := m.list.Attach()
 			if err != nil {
 				m.handleError(err)
@@ -53,6 +53,8 @@ func (h helpTypeGeneral) toContent() string {
 		keyStyle.Render("r")+descStyle.Render("         - Resume a paused session"),
 		"",
 		headerStyle.Render("Other:"),
+		keyStyle.Render("a")+descStyle.Render("         - Toggle autoyes for the selected session"),
+		keyStyle.Render("g")+descStyle.Render("         - Cycle the agent whose prompts autoyes answers in the selected session"),
 		keyStyle.Render("tab")+descStyle.Render("       - Switch between preview and diff tabs"),
 		keyStyle.Render("shift-↓/↑")+descStyle.Render(" - Scroll in diff view"),
 		keyStyle.Render("q")+descStyle.Render("         - Quit the application"),
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var pickerSelectedStyle = lipgloss.NewStyle().
+	Background(lipgloss.Color("#dde4f0")).
+	Foreground(lipgloss.Color("#1a1a1a"))
+
+var pickerHintStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"})
+
+// picker is a minimal list to choose one item from, used by commands that run outside the main app.
+type picker struct {
+	prompt   string
+	items    []string
+	selected int
+	chosen   bool
+}
+
+func (p *picker) Init() tea.Cmd {
+	return nil
+}
+
+func (p *picker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return p, nil
+	}
+	switch keyMsg.String() {
+	case "up", "k":
+		if p.selected > 0 {
+			p.selected--
+		}
+	case "down", "j":
+		if p.selected < len(p.items)-1 {
+			p.selected++
+		}
+	case "enter":
+		p.chosen = true
+		return p, tea.Quit
+	case "esc", "q", "ctrl+c":
+		return p, tea.Quit
+	}
+	return p, nil
+}
+
+func (p *picker) View() string {
+	var b strings.Builder
+	b.WriteString(p.prompt + "\n\n")
+	for i, item := range p.items {
+		line := fmt.Sprintf(" %d. %s ", i+1, item)
+		if i == p.selected {
+			line = pickerSelectedStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n" + pickerHintStyle.Render("↑/k up • ↓/j down • enter select • esc cancel") + "\n")
+	return b.String()
+}
+
+// Pick shows an interactive list of items and returns the index of the chosen one, or -1 if the user cancelled.
+func Pick(prompt string, items []string) (int, error) {
+	p := &picker{prompt: prompt, items: items}
+	if _, err := tea.NewProgram(p).Run(); err != nil {
+		return -1, err
+	}
+	if !p.chosen {
+		return -1, nil
+	}
+	return p.selected, nil
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPickerNavigation(t *testing.T) {
+	p := &picker{items: []string{"one", "two", "three"}}
+
+	p.Update(tea.KeyMsg{Type: tea.KeyUp})
+	assert.Equal(t, 0, p.selected, "up at the top stays put")
+
+	p.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	p.Update(tea.KeyMsg{Type: tea.KeyDown})
+	p.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, 2, p.selected, "down at the bottom stays put")
+
+	_, cmd := p.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.True(t, p.chosen)
+	assert.NotNil(t, cmd)
+}
+
+func TestPickerCancel(t *testing.T) {
+	p := &picker{items: []string{"one"}}
+	_, cmd := p.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, p.chosen)
+	assert.NotNil(t, cmd)
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"claude-squad/cmd"
+	"claude-squad/config"
+	"claude-squad/humanize"
+	"claude-squad/log"
+	"claude-squad/session"
+	"claude-squad/session/tmux"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// topRefreshInterval is how often cs top refreshes the statuses and activity of the instances.
+const topRefreshInterval = time.Second
+
+// topRow is an instance as shown by cs top.
+type topRow struct {
+	summary session.InstanceSummary
+	// lastOutput is when the instance's session last printed something, zero if it isn't running.
+	lastOutput time.Time
+}
+
+type topRefreshMsg struct {
+	rows []topRow
+	err  error
+}
+
+type topTickMsg struct{}
+
+// topModel is a live, read-only table of a repository's instances, lighter than the main app for keeping an eye
+// on them.
+type topModel struct {
+	repoPath string
+	load     func(repoPath string) ([]topRow, error)
+
+	rows      []topRow
+	err       error
+	refreshed time.Time
+}
+
+func (m *topModel) Init() tea.Cmd {
+	return m.refresh
+}
+
+func (m *topModel) refresh() tea.Msg {
+	rows, err := m.load(m.repoPath)
+	return topRefreshMsg{rows: rows, err: err}
+}
+
+func (m *topModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case topRefreshMsg:
+		m.rows, m.err = msg.rows, msg.err
+		m.refreshed = time.Now()
+		return m, tea.Tick(topRefreshInterval, func(time.Time) tea.Msg {
+			return topTickMsg{}
+		})
+	case topTickMsg:
+		return m, m.refresh
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m *topModel) View() string {
+	var b strings.Builder
+	if m.refreshed.IsZero() {
+		b.WriteString("Loading instances...\n")
+	} else if m.err != nil {
+		b.WriteString(fmt.Sprintf("Failed to load instances: %v\n", m.err))
+	} else if len(m.rows) == 0 {
+		b.WriteString("No instances found\n")
+	} else {
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TITLE\tSTATUS\tPROGRAM\tBRANCH\tADDED\tREMOVED\tFILES\tLAST OUTPUT")
+		for _, row := range m.rows {
+			s := row.summary
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t+%d\t-%d\t%d\t%s\n", s.Title, s.Status, s.Program, s.Branch,
+				s.Added, s.Removed, s.FilesChanged, humanize.Ago(row.lastOutput, m.refreshed))
+		}
+		w.Flush()
+	}
+	b.WriteString("\n" + pickerHintStyle.Render(fmt.Sprintf("refreshing every %v, diff stats every %v • q quit",
+		topRefreshInterval, topSlowRefreshInterval)) + "\n")
+	return b.String()
+}
+
+// topSlowRefreshInterval is how often cs top reloads the stored instances and recomputes their diff stats, which
+// takes a git diff per instance. Statuses and activity are refreshed every topRefreshInterval.
+const topSlowRefreshInterval = 10 * time.Second
+
+// topLoader loads the repository's active instances with their current status, diff stats and activity, keeping
+// the instances and diff stats between slow refreshes.
+type topLoader struct {
+	instances []session.InstanceData
+	summaries []session.InstanceSummary
+	loaded    time.Time
+}
+
+func (l *topLoader) load(repoPath string) ([]topRow, error) {
+	// The activity of every session takes one tmux call, and tells which sessions are alive.
+	var live map[string]bool
+	activity, err := tmux.SessionActivity(cmd.MakeExecutor())
+	if err != nil {
+		log.WarningLog.Printf("%v", err)
+	} else {
+		live = make(map[string]bool, len(activity))
+		for name := range activity {
+			live[name] = true
+		}
+	}
+
+	if l.loaded.IsZero() || time.Since(l.loaded) >= topSlowRefreshInterval {
+		storage, err := session.NewStorage(config.LoadState(repoPath))
+		if err != nil {
+			return nil, err
+		}
+		instancesData, err := storage.LoadInstanceData()
+		if err != nil {
+			return nil, err
+		}
+		l.instances, l.summaries = nil, nil
+		for _, data := range instancesData {
+			if data.Archived {
+				continue
+			}
+			l.instances = append(l.instances, data)
+			l.summaries = append(l.summaries, session.Summarize(data, live))
+		}
+		l.loaded = time.Now()
+	}
+
+	rows := make([]topRow, len(l.instances))
+	for i, data := range l.instances {
+		rows[i].summary = l.summaries[i]
+		rows[i].summary.Status = session.StatusIn(data, live).String()
+		if data.Status != session.Paused {
+			rows[i].lastOutput = activity[tmux.SessionName(data.Title, data.Path)]
+		}
+	}
+	return rows, nil
+}
+
+// Top shows a live table of the repository's instances, their status, diff stats and when they last printed
+// something, until the user quits. Unlike the main app it only reads the state, so it can run alongside it.
+func Top(repoPath string) error {
+	m := &topModel{repoPath: repoPath, load: (&topLoader{}).load}
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
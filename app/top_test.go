@@ -0,0 +1,55 @@
+package app
+
+import (
+	"claude-squad/session"
+	"errors"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopRefresh(t *testing.T) {
+	loads := 0
+	m := &topModel{repoPath: "/repo", load: func(repoPath string) ([]topRow, error) {
+		loads++
+		assert.Equal(t, "/repo", repoPath)
+		return []topRow{
+			{
+				summary:    session.InstanceSummary{Title: "fix-bug", Status: "running", Program: "claude", Added: 3},
+				lastOutput: time.Now().Add(-5 * time.Second),
+			},
+			{summary: session.InstanceSummary{Title: "paused-one", Status: "paused", Program: "aider"}},
+		}, nil
+	}}
+	assert.Contains(t, m.View(), "Loading instances")
+
+	msg := m.Init()()
+	_, cmd := m.Update(msg)
+	require.NotNil(t, cmd, "a refresh schedules the next one")
+	assert.Equal(t, 1, loads)
+
+	view := m.View()
+	assert.Contains(t, view, "fix-bug")
+	assert.Contains(t, view, "+3")
+	assert.Contains(t, view, "5s ago")
+	assert.Contains(t, view, "paused-one")
+
+	_, cmd = m.Update(topTickMsg{})
+	m.Update(cmd())
+	assert.Equal(t, 2, loads)
+}
+
+func TestTopLoadError(t *testing.T) {
+	m := &topModel{load: func(string) ([]topRow, error) {
+		return nil, errors.New("state is corrupt")
+	}}
+	m.Update(m.Init()())
+	assert.Contains(t, m.View(), "Failed to load instances: state is corrupt")
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	require.NotNil(t, cmd)
+	assert.Equal(t, tea.Quit(), cmd())
+}
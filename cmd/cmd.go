@@ -1,10 +1,25 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
+// ErrTmuxNotFound is returned when tmux is needed but isn't installed.
+var ErrTmuxNotFound = errors.New("tmux is required but not found in PATH; install it with your package manager " +
+	"(e.g. `brew install tmux` or `sudo apt install tmux`), see https://github.com/tmux/tmux/wiki/Installing")
+
+// CheckTmux returns ErrTmuxNotFound if tmux isn't installed.
+func CheckTmux() error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return ErrTmuxNotFound
+	}
+	return nil
+}
+
 type Executor interface {
 	Run(cmd *exec.Cmd) error
 	Output(cmd *exec.Cmd) ([]byte, error)
@@ -13,11 +28,24 @@ type Executor interface {
 type Exec struct{}
 
 func (e Exec) Run(cmd *exec.Cmd) error {
-	return cmd.Run()
+	return explainNotFound(cmd, cmd.Run())
 }
 
 func (e Exec) Output(cmd *exec.Cmd) ([]byte, error) {
-	return cmd.Output()
+	output, err := cmd.Output()
+	return output, explainNotFound(cmd, err)
+}
+
+// explainNotFound replaces the raw exec error for a missing tmux binary with ErrTmuxNotFound. The original error is
+// kept in the chain so errors.Is(err, exec.ErrNotFound) still holds.
+func explainNotFound(cmd *exec.Cmd, err error) error {
+	if err == nil || !errors.Is(err, exec.ErrNotFound) || len(cmd.Args) == 0 {
+		return err
+	}
+	if filepath.Base(cmd.Args[0]) == "tmux" {
+		return fmt.Errorf("%w (%w)", ErrTmuxNotFound, err)
+	}
+	return err
 }
 
 func MakeExecutor() Executor {
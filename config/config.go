@@ -10,11 +10,20 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 const (
 	ConfigFileName = "config.json"
 	defaultProgram = "claude"
+	// DefaultHistoryLimit is the tmux scrollback kept per session when HistoryLimit isn't set. Agent runs produce a
+	// lot of output, so it's well above tmux's default of 2000 lines.
+	DefaultHistoryLimit = 50000
+	// DefaultStartupTimeout is how many seconds cs waits for instances to load when StartupTimeout isn't set.
+	DefaultStartupTimeout = 30
+	// DefaultWorktreeAddAttempts is how many times creating a worktree is tried while the repository is locked,
+	// when WorktreeAddAttempts isn't set.
+	DefaultWorktreeAddAttempts = 5
 )
 
 // GetConfigDir returns the path to the application's configuration directory
@@ -29,15 +38,134 @@ func GetConfigDir() (string, error) {
 // Config represents the application configuration
 type Config struct {
 	// DefaultProgram is the default program to run in new instances
-	DefaultProgram string `json:"default_program"`
+	DefaultProgram string `json:"default_program" description:"Program to run in new instances"`
+	// Programs are named programs -p can refer to, e.g. {"aider": "aider --model gpt-4o"}. A -p value that isn't one
+	// of the names is run as given.
+	Programs map[string]string `json:"programs,omitempty" description:"Named programs -p accepts in place of a full command (e.g. {\"aider\": \"aider --model gpt-4o\"})"`
 	// AutoYes is a flag to automatically accept all prompts.
-	AutoYes bool `json:"auto_yes"`
+	AutoYes bool `json:"auto_yes" description:"Automatically accept all prompts"`
+	// KeepDaemonOnExit leaves a daemon supervising the instances when the TUI exits, even without AutoYes. Without
+	// AutoYes the daemon runs in monitor mode, so it tracks the instances but never accepts prompts.
+	KeepDaemonOnExit bool `json:"keep_daemon_on_exit,omitempty" description:"Keep a daemon supervising instances after the TUI exits, even without auto_yes"`
+	// AutoYesKeys are the keystrokes autoyes sends to accept a prompt, by program name. Programs without an entry
+	// get the keystrokes of their agent, Enter for most of them.
+	AutoYesKeys map[string]string `json:"autoyes_keys,omitempty" description:"Keystrokes autoyes sends to accept a prompt, by program name (e.g. {\"aider\": \"y\\r\"}); defaults to the agent's"`
+	// AutoYesDelay is how long (ms) autoyes waits between spotting a prompt and answering it, by program name, for
+	// agents that ignore keystrokes sent while their prompt is still being drawn. Defaults to the agent's.
+	AutoYesDelay map[string]int `json:"autoyes_delay_ms,omitempty" description:"Milliseconds autoyes waits before answering a prompt, by program name (e.g. {\"aider\": 300}); defaults to the agent's"`
+	// AutoYesClearLine is whether autoyes clears the input line (C-u) before answering a prompt, by program name, so
+	// half-typed input doesn't end up in the answer. Defaults to the agent's.
+	AutoYesClearLine map[string]bool `json:"autoyes_clear_line,omitempty" description:"Whether autoyes clears the input line with C-u before answering a prompt, by program name; defaults to the agent's"`
 	// DaemonPollInterval is the interval (ms) at which the daemon polls sessions for autoyes mode.
-	DaemonPollInterval int `json:"daemon_poll_interval"`
+	DaemonPollInterval int `json:"daemon_poll_interval" description:"Interval (ms) at which the daemon polls sessions for autoyes mode"`
 	// BranchPrefix is the prefix used for git branches created by the application.
-	BranchPrefix string `json:"branch_prefix"`
+	BranchPrefix string `json:"branch_prefix" description:"Prefix of the git branches created for instances"`
+	// StateDirName is the name of the directory cs keeps in each repository for its state, locks and worktrees.
+	// A repository's own config can override it. Empty means DefaultStateDirName.
+	StateDirName string `json:"state_dir_name,omitempty" description:"Name of the directory in each repository holding cs's state and worktrees (default .claude-squad; existing state isn't moved)"`
+	// IsolationMode is how instances get their own copy of the repository: a git worktree, or a local clone for
+	// agents that don't cope with the object store shared by worktrees.
+	IsolationMode string `json:"isolation_mode" description:"How instances are isolated from the repository" enum:"worktree,clone"`
+	// OnExistingWorktree is what creating an instance does when its branch already exists, e.g. left behind by a
+	// creation that was interrupted: reuse the branch, fail, or delete the branch and its worktree and start afresh.
+	OnExistingWorktree string `json:"on_existing_worktree,omitempty" description:"What creating an instance does when its branch already exists" enum:"reuse,error,recreate"`
+	// DiffBase is what the diff stats and the diff tab compare an instance's worktree against. Instances can override
+	// it.
+	DiffBase string `json:"diff_base,omitempty" description:"What instance diffs are computed against" enum:"base,merge-base,last-commit,committed"`
+	// DiffIgnore are git pathspecs of files left out of the diff stats and the diff tab, e.g. lockfiles or build
+	// output.
+	DiffIgnore []string `json:"diff_ignore,omitempty" description:"Git pathspecs of files left out of instance diffs (e.g. package-lock.json, dist/**)"`
+	// AutoCommitOnPause commits an instance's uncommitted changes before it's killed and keeps its branch, the same
+	// way pausing an instance does.
+	AutoCommitOnPause bool `json:"auto_commit_on_pause" description:"Commit uncommitted changes and keep the branch when killing an instance"`
+	// MaxInstances is the most active (not archived) instances a repository may have. 0 means no limit beyond the
+	// number the TUI can show.
+	MaxInstances int `json:"max_instances,omitempty" description:"Most active instances per repository (0 means no limit)"`
+	// MaxRuntime is how many minutes an instance may run before the daemon takes MaxRuntimeAction on it, counting
+	// from when it was last started or resumed. 0 disables the cap. It's only enforced while a daemon runs, i.e.
+	// with AutoYes or KeepDaemonOnExit.
+	MaxRuntime int `json:"max_runtime,omitempty" description:"Minutes an instance may run before the daemon pauses or kills it (0 disables)"`
+	// MaxRuntimeAction is what the daemon does with an instance that ran longer than MaxRuntime.
+	MaxRuntimeAction string `json:"max_runtime_action,omitempty" description:"What the daemon does with instances that exceed max_runtime" enum:"pause,kill"`
+	// MaxRuntimeHook is a shell command the daemon runs after it paused or killed an instance for exceeding
+	// MaxRuntime, e.g. to send a notification. The instance's title and branch and the action taken are passed in
+	// the CLAUDE_SQUAD_INSTANCE, CLAUDE_SQUAD_BRANCH and CLAUDE_SQUAD_ACTION environment variables. It runs in the
+	// background and is killed after five minutes.
+	MaxRuntimeHook string `json:"max_runtime_hook,omitempty" description:"Shell command the daemon runs after stopping an instance that exceeded max_runtime (gets CLAUDE_SQUAD_INSTANCE, CLAUDE_SQUAD_BRANCH and CLAUDE_SQUAD_ACTION)"`
+	// HistoryLimit is the tmux scrollback history-limit of each session, in lines.
+	HistoryLimit int `json:"history_limit" description:"Scrollback lines kept by each tmux session"`
+	// WorktreeAddAttempts is how many times creating an instance's worktree is tried while another git process
+	// holds one of the repository's lock files, backing off between attempts.
+	WorktreeAddAttempts int `json:"worktree_add_attempts,omitempty" description:"Times creating a worktree is tried while another git process holds the repository's locks"`
+	// StartupTimeout is how many seconds cs waits for its instances to load before giving up.
+	StartupTimeout int `json:"startup_timeout" description:"Seconds cs waits for instances to load on startup before giving up"`
+	// TmuxOptions are tmux options set on every new session, as "name value" strings (e.g. "mouse off").
+	TmuxOptions []string `json:"tmux_options,omitempty" description:"tmux options set on new sessions, as \"name value\" strings"`
+	// PostCreateHook is a shell command run in the worktree of each new instance once it's created, before the
+	// program starts, e.g. to set the branch's upstream or push.default, or to tag it. The config of a repository in
+	// TrustedRepos can override it. If it fails, the instance isn't created.
+	PostCreateHook string `json:"post_create_hook,omitempty" description:"Shell command run in each new instance's worktree before its program starts, e.g. to set the branch's upstream (gets CLAUDE_SQUAD_INSTANCE, CLAUDE_SQUAD_BRANCH, CLAUDE_SQUAD_WORKTREE and CLAUDE_SQUAD_REPO); creation fails if it does"`
+	// TrustedRepos are the paths of the repositories whose .claude-squad.json may set the commands cs runs:
+	// default_program and post_create_hook. Anyone who can commit to a repository can change its config, so a cloned repository
+	// mustn't get to run its own commands until the user says so.
+	TrustedRepos []string `json:"trusted_repos,omitempty" description:"Absolute paths of the repositories whose .claude-squad.json may set commands cs runs (default_program and post_create_hook)"`
+	// MergeHook is a shell command cs sync runs for each instance it finds merged. The instance's title and branch
+	// are passed in the CLAUDE_SQUAD_INSTANCE and CLAUDE_SQUAD_BRANCH environment variables.
+	MergeHook string `json:"merge_hook,omitempty" description:"Shell command cs sync runs for each newly merged instance (gets CLAUDE_SQUAD_INSTANCE and CLAUDE_SQUAD_BRANCH)"`
+	// SafeMode refuses the operations that destroy instances or their work: killing instances and their tmux
+	// sessions, removing worktrees with their branches, cs reset and cs cleanup --kill-all. The commands print what
+	// they would have done instead. CS_SAFE_MODE=1 turns it on too.
+	SafeMode bool `json:"safe_mode,omitempty" description:"Refuse to kill instances, tmux sessions or worktrees, e.g. for demos (also enabled by CS_SAFE_MODE=1)"`
+	// RedactPatterns are regular expressions for secrets that must not leave cs in captured pane text, e.g. via cs
+	// output or the preview. Every pane capture replaces matches with [REDACTED], as it does DefaultRedactPatterns.
+	RedactPatterns []string `json:"redact_patterns,omitempty" description:"Regular expressions for secrets to replace with [REDACTED] in captured pane text, e.g. in the event log and cs output (common API key formats are always redacted)"`
+	// WindowName names the tmux window of new instances. {title} and {branch} are replaced with the instance's title
+	// and branch. Empty leaves the window to tmux's automatic naming, after the running program.
+	WindowName string `json:"window_name,omitempty" description:"Name of the tmux window of new instances, where {title} and {branch} stand for the instance's (defaults to tmux's automatic name)"`
+	// CommitAuthor and CommitEmail are the identity of the commits cs makes, e.g. of an instance's changes when it's
+	// paused, so they can be told apart from the user's own. Empty means the repository's user.name or user.email.
+	CommitAuthor string `json:"commit_author,omitempty" description:"Author name of the commits cs makes, e.g. when pausing an instance (defaults to the repository's user.name)"`
+	CommitEmail  string `json:"commit_email,omitempty" description:"Author email of the commits cs makes (defaults to the repository's user.email)"`
+	// Editor is the command cs open uses to open a worktree. Defaults to $EDITOR.
+	Editor string `json:"editor,omitempty" description:"Command used by cs open to open an instance's worktree (defaults to $EDITOR)"`
 }
 
+const (
+	// IsolationWorktree gives each instance a git worktree of the repository.
+	IsolationWorktree = "worktree"
+	// IsolationClone gives each instance a local clone of the repository.
+	IsolationClone = "clone"
+)
+
+const (
+	// OnExistingReuse creates the new instance's worktree on the existing branch, keeping its commits.
+	OnExistingReuse = "reuse"
+	// OnExistingError fails the creation.
+	OnExistingError = "error"
+	// OnExistingRecreate removes the existing branch, and the worktree it's checked out in, and creates it afresh.
+	OnExistingRecreate = "recreate"
+)
+
+const (
+	// DiffBaseCommit diffs the worktree, including uncommitted changes, against the commit the instance started from.
+	DiffBaseCommit = "base"
+	// DiffBaseMergeBase diffs the worktree against its merge base with origin's default branch, so changes merged
+	// into the branch from upstream don't count.
+	DiffBaseMergeBase = "merge-base"
+	// DiffBaseLastCommit diffs the worktree against the commit before HEAD: the agent's last commit plus whatever
+	// it hasn't committed yet.
+	DiffBaseLastCommit = "last-commit"
+	// DiffBaseCommitted only counts committed changes since the commit the instance started from.
+	DiffBaseCommitted = "committed"
+)
+
+const (
+	// MaxRuntimePause pauses instances that exceed MaxRuntime, keeping their branch.
+	MaxRuntimePause = "pause"
+	// MaxRuntimeKill kills instances that exceed MaxRuntime.
+	MaxRuntimeKill = "kill"
+)
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	program, err := GetClaudeCommand()
@@ -50,6 +178,13 @@ func DefaultConfig() *Config {
 		DefaultProgram:     program,
 		AutoYes:            false,
 		DaemonPollInterval: 1000,
+		HistoryLimit:       DefaultHistoryLimit,
+		StartupTimeout:     DefaultStartupTimeout,
+		IsolationMode:      IsolationWorktree,
+		OnExistingWorktree: OnExistingReuse,
+		DiffBase:           DiffBaseCommit,
+		MaxRuntimeAction:   MaxRuntimePause,
+		StateDirName:       DefaultStateDirName,
 		BranchPrefix: func() string {
 			user, err := user.Current()
 			if err != nil || user == nil || user.Username == "" {
@@ -61,6 +196,61 @@ func DefaultConfig() *Config {
 	}
 }
 
+// ExpandProgram returns the program named program in Programs, or program itself if there's none by that name.
+func (c *Config) ExpandProgram(program string) string {
+	if expanded, ok := c.Programs[program]; ok && expanded != "" {
+		return expanded
+	}
+	return program
+}
+
+// AutoYesKeysFor returns the keystrokes autoyes sends to accept a prompt of program, or "" for the keystrokes of the
+// program's agent.
+// Entries match either the whole program string or the name of its executable, so "aider" covers
+// "/usr/local/bin/aider --model x".
+func (c *Config) AutoYesKeysFor(program string) string {
+	keys, _ := programEntry(c.AutoYesKeys, program)
+	return keys
+}
+
+// AutoYes is how autoyes answers the prompts of a program where it differs from the program's agent.
+type AutoYes struct {
+	// Keys are the keystrokes to send, or "" for the agent's.
+	Keys string
+	// Delay is how long to wait before sending them, or nil for the agent's delay.
+	Delay *time.Duration
+	// ClearLine is whether to clear the input line first, or nil for the agent's choice.
+	ClearLine *bool
+}
+
+// AutoYesFor returns how autoyes answers the prompts of program, from the autoyes_* entries matching it the way
+// AutoYesKeysFor matches them.
+func (c *Config) AutoYesFor(program string) AutoYes {
+	autoYes := AutoYes{Keys: c.AutoYesKeysFor(program)}
+	if ms, ok := programEntry(c.AutoYesDelay, program); ok {
+		delay := time.Duration(ms) * time.Millisecond
+		autoYes.Delay = &delay
+	}
+	if clearLine, ok := programEntry(c.AutoYesClearLine, program); ok {
+		autoYes.ClearLine = &clearLine
+	}
+	return autoYes
+}
+
+// programEntry looks program up in a map by program name: the whole program string, or else the name of its
+// executable.
+func programEntry[T any](entries map[string]T, program string) (T, bool) {
+	if value, ok := entries[program]; ok {
+		return value, true
+	}
+	if fields := strings.Fields(program); len(fields) > 0 {
+		value, ok := entries[filepath.Base(fields[0])]
+		return value, ok
+	}
+	var zero T
+	return zero, false
+}
+
 // GetClaudeCommand attempts to find the "claude" command in the user's shell
 // It checks in the following order:
 // 1. Shell alias resolution: using "which" command
@@ -109,17 +299,42 @@ func GetClaudeCommand() (string, error) {
 	return "", fmt.Errorf("claude command not found in aliases or PATH")
 }
 
-func LoadConfig() *Config {
+// configPathOverride is the config file set with SetConfigPath. Empty means the default location.
+var configPathOverride string
+
+// SetConfigPath overrides the location of the config file used by LoadConfig and SaveConfig.
+func SetConfigPath(path string) {
+	configPathOverride = path
+}
+
+// GetConfigPath returns the path of the config file: the one set with SetConfigPath, or config.json in the
+// config directory.
+func GetConfigPath() (string, error) {
+	if configPathOverride != "" {
+		return configPathOverride, nil
+	}
 	configDir, err := GetConfigDir()
 	if err != nil {
-		log.ErrorLog.Printf("failed to get config directory: %v", err)
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, ConfigFileName), nil
+}
+
+func LoadConfig() *Config {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		log.ErrorLog.Printf("failed to get config path: %v", err)
 		return DefaultConfig()
 	}
+	return LoadConfigFrom(configPath)
+}
 
-	configPath := filepath.Join(configDir, ConfigFileName)
+// LoadConfigFrom loads the config file at configPath. A missing file at the default location is created with the
+// default config; an explicitly set file is never created.
+func LoadConfigFrom(configPath string) *Config {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if os.IsNotExist(err) && configPathOverride == "" {
 			// Create and save default config if file doesn't exist
 			defaultCfg := DefaultConfig()
 			if saveErr := saveConfig(defaultCfg); saveErr != nil {
@@ -141,18 +356,38 @@ func LoadConfig() *Config {
 	return &config
 }
 
+// readConfig reads the config file without creating it, for callers that mustn't write, e.g. deep in the git layer.
+// A missing file gives the default config, and one that can't be read or parsed an error.
+func readConfig() (*Config, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultConfig(), nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return &config, nil
+}
+
 // saveConfig saves the configuration to disk
 func saveConfig(config *Config) error {
-	configDir, err := GetConfigDir()
+	configPath, err := GetConfigPath()
 	if err != nil {
-		return fmt.Errorf("failed to get config directory: %w", err)
+		return err
 	}
 
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	configPath := filepath.Join(configDir, ConfigFileName)
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
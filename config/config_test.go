@@ -2,11 +2,14 @@ package config
 
 import (
 	"claude-squad/log"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -200,6 +203,34 @@ func TestLoadConfig(t *testing.T) {
 		assert.False(t, config.AutoYes)                  // Default value
 		assert.Equal(t, 1000, config.DaemonPollInterval) // Default value
 	})
+
+	t.Run("loads config from overridden path", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "custom.json")
+		err := os.WriteFile(configPath, []byte(`{"default_program": "custom-claude", "branch_prefix": "ci/"}`), 0644)
+		require.NoError(t, err)
+
+		SetConfigPath(configPath)
+		defer SetConfigPath("")
+
+		path, err := GetConfigPath()
+		require.NoError(t, err)
+		assert.Equal(t, configPath, path)
+
+		config := LoadConfig()
+		assert.Equal(t, "custom-claude", config.DefaultProgram)
+		assert.Equal(t, "ci/", config.BranchPrefix)
+	})
+
+	t.Run("doesn't create missing overridden config", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "missing.json")
+		SetConfigPath(configPath)
+		defer SetConfigPath("")
+
+		config := LoadConfig()
+		assert.NotNil(t, config)
+		_, err := os.Stat(configPath)
+		assert.True(t, os.IsNotExist(err))
+	})
 }
 
 func TestSaveConfig(t *testing.T) {
@@ -237,3 +268,86 @@ func TestSaveConfig(t *testing.T) {
 		assert.Equal(t, testConfig.BranchPrefix, loadedConfig.BranchPrefix)
 	})
 }
+
+func TestAutoYesKeysFor(t *testing.T) {
+	cfg := &Config{AutoYesKeys: map[string]string{
+		"aider":             "y\r",
+		"codex --full-auto": "yes\r",
+	}}
+
+	assert.Equal(t, "y\r", cfg.AutoYesKeysFor("aider"))
+	assert.Equal(t, "y\r", cfg.AutoYesKeysFor("/usr/local/bin/aider --model x"))
+	assert.Equal(t, "yes\r", cfg.AutoYesKeysFor("codex --full-auto"))
+	assert.Equal(t, "", cfg.AutoYesKeysFor("codex"))
+	assert.Equal(t, "", cfg.AutoYesKeysFor("claude"))
+	assert.Equal(t, "", (&Config{}).AutoYesKeysFor("aider"))
+}
+
+func TestAutoYesFor(t *testing.T) {
+	cfg := &Config{
+		AutoYesKeys:      map[string]string{"codex": "y"},
+		AutoYesDelay:     map[string]int{"aider": 300},
+		AutoYesClearLine: map[string]bool{"aider --model x": false, "aider": true},
+	}
+
+	autoYes := cfg.AutoYesFor("/usr/local/bin/aider --model y")
+	assert.Equal(t, "", autoYes.Keys)
+	require.NotNil(t, autoYes.Delay)
+	assert.Equal(t, 300*time.Millisecond, *autoYes.Delay)
+	require.NotNil(t, autoYes.ClearLine)
+	assert.True(t, *autoYes.ClearLine)
+
+	// The whole program string takes precedence over the executable's name.
+	autoYes = cfg.AutoYesFor("aider --model x")
+	require.NotNil(t, autoYes.ClearLine)
+	assert.False(t, *autoYes.ClearLine)
+
+	autoYes = cfg.AutoYesFor("codex")
+	assert.Equal(t, "y", autoYes.Keys)
+	assert.Nil(t, autoYes.Delay)
+	assert.Nil(t, autoYes.ClearLine)
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	assert.Equal(t, "object", schema["type"])
+
+	properties, ok := schema["properties"].(map[string]any)
+	require.True(t, ok)
+
+	// Every config field should be described under its json name.
+	cfgType := reflect.TypeOf(Config{})
+	require.Len(t, properties, cfgType.NumField())
+	for i := 0; i < cfgType.NumField(); i++ {
+		name, _, _ := strings.Cut(cfgType.Field(i).Tag.Get("json"), ",")
+		property, ok := properties[name].(map[string]any)
+		require.True(t, ok, "missing property %s", name)
+		assert.NotEmpty(t, property["type"], "property %s has no type", name)
+		assert.NotEmpty(t, property["description"], "property %s has no description", name)
+	}
+
+	pollInterval := properties["daemon_poll_interval"].(map[string]any)
+	assert.Equal(t, "integer", pollInterval["type"])
+	assert.Equal(t, float64(1000), pollInterval["default"])
+	assert.Equal(t, "boolean", properties["auto_yes"].(map[string]any)["type"])
+}
+
+func TestValidateConfig(t *testing.T) {
+	require.NoError(t, ValidateConfig([]byte(`{"default_program": "aider", "isolation_mode": "clone"}`)))
+	require.NoError(t, ValidateConfig([]byte(`{}`)))
+	defaults, err := json.Marshal(DefaultConfig())
+	require.NoError(t, err)
+	require.NoError(t, ValidateConfig(defaults))
+
+	tests := map[string]string{
+		`{"default_program": "aider",}`: "invalid character",
+		`{"defualt_program": "aider"}`:  `unknown field "defualt_program"`,
+		`{"auto_yes": "yes"}`:           "cannot unmarshal string",
+		`{"isolation_mode": "copy"}`:    "isolation_mode must be one of worktree, clone",
+		`{"auto_yes": true} {}`:         "unexpected data",
+		`["not", "an", "object"]`:       "cannot unmarshal array",
+	}
+	for data, expected := range tests {
+		require.ErrorContains(t, ValidateConfig([]byte(data)), expected, data)
+	}
+}
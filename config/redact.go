@@ -0,0 +1,72 @@
+package config
+
+import (
+	"claude-squad/log"
+	"fmt"
+	"regexp"
+)
+
+// Redacted replaces the text a Redactor matches.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactPatterns match common API key and token formats. They're always redacted, in addition to the
+// configured RedactPatterns.
+var DefaultRedactPatterns = []string{
+	// Anthropic and OpenAI API keys
+	`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`,
+	// AWS access key IDs
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	// GitHub tokens
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	`\bgithub_pat_[A-Za-z0-9_]{22,}\b`,
+	// Slack tokens
+	`\bxox[abposr]-[A-Za-z0-9-]{10,}`,
+	// Google API keys
+	`\bAIza[0-9A-Za-z_-]{35}`,
+	// PEM private keys
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+}
+
+// Redactor replaces secrets in captured pane text before it leaves cs, e.g. into the event log. A nil Redactor
+// leaves text as it is.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a Redactor for the default patterns and the given ones.
+func NewRedactor(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range append(append([]string{}, DefaultRedactPatterns...), patterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redactor returns the Redactor for the configured RedactPatterns. Invalid patterns are logged and skipped.
+func (c *Config) Redactor() *Redactor {
+	r, _ := NewRedactor(nil)
+	for _, pattern := range c.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.WarningLog.Printf("ignoring invalid redact pattern %q: %v", pattern, err)
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r
+}
+
+// Redact returns text with every match of the patterns replaced by Redacted.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, re := range r.patterns {
+		text = re.ReplaceAllString(text, Redacted)
+	}
+	return text
+}
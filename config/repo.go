@@ -1,19 +1,32 @@
 package config
 
 import (
+	"claude-squad/log"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/fs"
 	"path/filepath"
+	"sync"
 )
 
 // GetCanonicalRepoPath resolves symlinks and returns the absolute canonical path
 // to a repository. This ensures that the same repository accessed through different
 // paths (e.g., symlinks) always gets the same hash.
+//
+// If the symlinks can't be resolved for another reason than the path not existing, e.g. on a network filesystem
+// that doesn't support it, the cleaned absolute path is used instead, with a warning logged once per process.
 func GetCanonicalRepoPath(path string) (string, error) {
 	// Resolve any symlinks in the path
 	resolved, err := filepath.EvalSymlinks(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve symlinks: %w", err)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to resolve symlinks: %w", err)
+		}
+		symlinkWarning.Do(func() {
+			log.WarningLog.Printf("failed to resolve symlinks, using paths as given: %v", err)
+		})
+		resolved = path
 	}
 
 	// Get the absolute path
@@ -25,6 +38,9 @@ func GetCanonicalRepoPath(path string) (string, error) {
 	return absPath, nil
 }
 
+// symlinkWarning logs GetCanonicalRepoPath's fallback only once, as it's called for most operations.
+var symlinkWarning sync.Once
+
 // GetRepoHash returns a short hash (first 8 hex chars) of the canonical repository path.
 // This hash is used to:
 // - Organize worktrees by repository
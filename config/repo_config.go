@@ -0,0 +1,95 @@
+package config
+
+import (
+	"claude-squad/log"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RepoConfigFileName is the name of the per-repository config file. It lives at the root of the repository and is
+// meant to be committed, so everyone working in the repository gets the same settings. It can't be named
+// .claude-squad like the global config directory, since that name is taken by the default state directory.
+const RepoConfigFileName = ".claude-squad.json"
+
+// RepoConfig holds the settings a repository declares for itself. Empty fields fall back to the global config.
+type RepoConfig struct {
+	// DefaultProgram is the program to run in the repository's new instances. The -p flag overrides it, and it
+	// overrides the global default_program if the repository is trusted (see Config.TrustsRepo).
+	DefaultProgram string `json:"default_program,omitempty"`
+	// StateDirName is the name of the repository's state directory, for repositories whose conventions rule out
+	// the default. It overrides the global state_dir_name.
+	StateDirName string `json:"state_dir_name,omitempty"`
+	// PostCreateHook is the shell command run in the worktree of each of the repository's new instances, so the
+	// repository can standardize how agent branches relate to its remote. It overrides the global post_create_hook
+	// if the repository is trusted (see Config.TrustsRepo), and is ignored otherwise.
+	PostCreateHook string `json:"post_create_hook,omitempty"`
+}
+
+// LoadRepoConfig loads the repository's config file. A repository without one gets an empty config.
+func LoadRepoConfig(repoPath string) (*RepoConfig, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, RepoConfigFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &RepoConfig{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", RepoConfigFileName, err)
+	}
+
+	var repoConfig RepoConfig
+	if err := json.Unmarshal(data, &repoConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", RepoConfigFileName, err)
+	}
+	return &repoConfig, nil
+}
+
+// ResolveProgram returns the program to run in the repository's new instances: flagProgram if set, expanded if it
+// names one of the configured programs, then the repository's default_program if it's trusted, then the global one.
+// A repository config that can't be read is logged and skipped.
+func ResolveProgram(flagProgram string, repoPath string, cfg *Config) string {
+	if flagProgram != "" {
+		return cfg.ExpandProgram(flagProgram)
+	}
+	repoConfig, err := LoadRepoConfig(repoPath)
+	if err != nil {
+		log.WarningLog.Printf("ignoring repository config: %v", err)
+	} else if repoConfig.DefaultProgram != "" {
+		if cfg.TrustsRepo(repoPath) {
+			return repoConfig.DefaultProgram
+		}
+		log.WarningLog.Printf("ignoring default_program %q of %s, which isn't in trusted_repos",
+			repoConfig.DefaultProgram, repoPath)
+	}
+	return cfg.DefaultProgram
+}
+
+// ResolvePostCreateHook returns the post-create hook of the repository's new instances: the repository's
+// post_create_hook if it's trusted, then the global one. A repository config that can't be read is logged and
+// skipped.
+func ResolvePostCreateHook(repoPath string, cfg *Config) string {
+	repoConfig, err := LoadRepoConfig(repoPath)
+	if err != nil {
+		log.WarningLog.Printf("ignoring repository config: %v", err)
+	} else if repoConfig.PostCreateHook != "" {
+		if cfg.TrustsRepo(repoPath) {
+			return repoConfig.PostCreateHook
+		}
+		log.WarningLog.Printf("ignoring post_create_hook of %s, which isn't in trusted_repos", repoPath)
+	}
+	return cfg.PostCreateHook
+}
+
+// TrustsRepo reports whether the repository is in TrustedRepos, so the commands its config sets may be run.
+func (c *Config) TrustsRepo(repoPath string) bool {
+	canonical, err := GetCanonicalRepoPath(repoPath)
+	if err != nil {
+		return false
+	}
+	for _, trusted := range c.TrustedRepos {
+		if trustedPath, err := GetCanonicalRepoPath(trusted); err == nil && trustedPath == canonical {
+			return true
+		}
+	}
+	return false
+}
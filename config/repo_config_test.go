@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveProgram(t *testing.T) {
+	repoPath := t.TempDir()
+	cfg := &Config{DefaultProgram: "claude"}
+
+	// Without a repository config, the global default applies.
+	require.Equal(t, "claude", ResolveProgram("", repoPath, cfg))
+
+	configPath := filepath.Join(repoPath, RepoConfigFileName)
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"default_program": "aider --yes"}`), 0644))
+	// The repository's program is ignored until the user trusts it.
+	require.Equal(t, "claude", ResolveProgram("", repoPath, cfg))
+	cfg.TrustedRepos = []string{repoPath}
+	require.Equal(t, "aider --yes", ResolveProgram("", repoPath, cfg))
+	require.Equal(t, "codex", ResolveProgram("codex", repoPath, cfg))
+
+	// -p can name a configured program; anything else is taken literally.
+	cfg.Programs = map[string]string{"aider": "aider --model gpt-4o"}
+	require.Equal(t, "aider --model gpt-4o", ResolveProgram("aider", repoPath, cfg))
+	require.Equal(t, "aider --yes", ResolveProgram("aider --yes", repoPath, cfg))
+	require.Equal(t, "aider --yes", ResolveProgram("", repoPath, cfg))
+
+	// A broken repository config is skipped rather than failing.
+	require.NoError(t, os.WriteFile(configPath, []byte(`{`), 0644))
+	_, err := LoadRepoConfig(repoPath)
+	require.Error(t, err)
+	require.Equal(t, "claude", ResolveProgram("", repoPath, cfg))
+}
+
+func TestResolvePostCreateHook(t *testing.T) {
+	repoPath := t.TempDir()
+	cfg := &Config{PostCreateHook: "git config push.default current"}
+	require.Equal(t, "git config push.default current", ResolvePostCreateHook(repoPath, cfg))
+
+	configPath := filepath.Join(repoPath, RepoConfigFileName)
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"post_create_hook": "git tag agent/$CLAUDE_SQUAD_INSTANCE"}`), 0644))
+
+	// The repository's hook is ignored until the user trusts it.
+	require.Equal(t, "git config push.default current", ResolvePostCreateHook(repoPath, cfg))
+	require.Empty(t, ResolvePostCreateHook(repoPath, &Config{}))
+
+	cfg.TrustedRepos = []string{repoPath}
+	require.Equal(t, "git tag agent/$CLAUDE_SQUAD_INSTANCE", ResolvePostCreateHook(repoPath, cfg))
+	require.Equal(t, "git tag agent/$CLAUDE_SQUAD_INSTANCE",
+		ResolvePostCreateHook(repoPath, &Config{TrustedRepos: []string{repoPath + "/"}}))
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCanonicalRepoPath(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	repoPath := filepath.Join(dir, "repo")
+	require.NoError(t, os.Mkdir(repoPath, 0755))
+	require.NoError(t, os.Symlink(repoPath, filepath.Join(dir, "link")))
+
+	canonical, err := GetCanonicalRepoPath(filepath.Join(dir, "link"))
+	require.NoError(t, err)
+	require.Equal(t, repoPath, canonical)
+
+	_, err = GetCanonicalRepoPath(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+
+	// A path whose symlinks can't be resolved is used as given, cleaned.
+	require.NoError(t, os.Symlink("loop", filepath.Join(dir, "loop")))
+	canonical, err = GetCanonicalRepoPath(filepath.Join(dir, "repo", "..", "loop"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "loop"), canonical)
+
+	hash, err := GetRepoHash(filepath.Join(dir, "loop"))
+	require.NoError(t, err)
+	require.NotEmpty(t, hash)
+}
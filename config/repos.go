@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ReposFileName is the global index of repositories with instances, in the config directory.
+const ReposFileName = "repos.json"
+
+// RepoEntry is a repository in the global index.
+type RepoEntry struct {
+	// Path is the canonical path of the repository.
+	Path string `json:"path"`
+	// LastUsed is when an instance was last created in the repository.
+	LastUsed time.Time `json:"last_used"`
+}
+
+// reposIndex is the content of the repos file.
+type reposIndex struct {
+	Repos []RepoEntry `json:"repos"`
+}
+
+// RegisterRepo records in the global index that the repository has instances.
+func RegisterRepo(repoPath string) error {
+	canonical, err := GetCanonicalRepoPath(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get canonical repo path: %w", err)
+	}
+
+	index, err := loadReposIndex()
+	if err != nil {
+		return err
+	}
+	for i := range index.Repos {
+		if index.Repos[i].Path == canonical {
+			index.Repos[i].LastUsed = time.Now()
+			return saveReposIndex(index)
+		}
+	}
+	index.Repos = append(index.Repos, RepoEntry{Path: canonical, LastUsed: time.Now()})
+	return saveReposIndex(index)
+}
+
+// UnregisterRepo removes the repository from the global index, e.g. after its instances were reset. The repository
+// doesn't need to exist anymore.
+func UnregisterRepo(repoPath string) error {
+	canonical, err := GetCanonicalRepoPath(repoPath)
+	if err != nil {
+		canonical = filepath.Clean(repoPath)
+	}
+
+	index, err := loadReposIndex()
+	if err != nil {
+		return err
+	}
+	repos := index.Repos[:0]
+	for _, entry := range index.Repos {
+		if entry.Path != canonical {
+			repos = append(repos, entry)
+		}
+	}
+	if len(repos) == len(index.Repos) {
+		return nil
+	}
+	index.Repos = repos
+	return saveReposIndex(index)
+}
+
+// ListRepos returns the repositories in the global index, sorted by path.
+func ListRepos() ([]RepoEntry, error) {
+	index, err := loadReposIndex()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(index.Repos, func(i, j int) bool {
+		return index.Repos[i].Path < index.Repos[j].Path
+	})
+	return index.Repos, nil
+}
+
+// PrunedRepo is a repository PruneRepos removed from the global index.
+type PrunedRepo struct {
+	Path string
+	// Reason is why the repository was removed, e.g. "missing".
+	Reason string
+}
+
+// PruneRepos removes the repositories that check rejects from the global index, e.g. ones that were deleted or
+// moved, and returns them sorted by path. check returns why a repository should go, or "" to keep it.
+func PruneRepos(check func(path string) string) ([]PrunedRepo, error) {
+	index, err := loadReposIndex()
+	if err != nil {
+		return nil, err
+	}
+	var pruned []PrunedRepo
+	repos := index.Repos[:0]
+	for _, entry := range index.Repos {
+		if reason := check(entry.Path); reason != "" {
+			pruned = append(pruned, PrunedRepo{Path: entry.Path, Reason: reason})
+			continue
+		}
+		repos = append(repos, entry)
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+	index.Repos = repos
+	if err := saveReposIndex(index); err != nil {
+		return nil, err
+	}
+	sort.Slice(pruned, func(i, j int) bool {
+		return pruned[i].Path < pruned[j].Path
+	})
+	return pruned, nil
+}
+
+func getReposPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, ReposFileName), nil
+}
+
+func loadReposIndex() (*reposIndex, error) {
+	reposPath, err := getReposPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(reposPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &reposIndex{}, nil
+		}
+		return nil, fmt.Errorf("failed to read repos index: %w", err)
+	}
+
+	var index reposIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse repos index %s: %w", reposPath, err)
+	}
+	return &index, nil
+}
+
+// saveReposIndex writes the index through a temporary file, so that concurrent cs processes never read a partial
+// index.
+func saveReposIndex(index *reposIndex) error {
+	reposPath, err := getReposPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(reposPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal repos index: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(reposPath), ReposFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write repos index: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write repos index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write repos index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), reposPath); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write repos index: %w", err)
+	}
+	return nil
+}
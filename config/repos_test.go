@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReposIndex(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	repoA, err := GetCanonicalRepoPath(t.TempDir())
+	require.NoError(t, err)
+	repoB, err := GetCanonicalRepoPath(t.TempDir())
+	require.NoError(t, err)
+
+	repos, err := ListRepos()
+	require.NoError(t, err)
+	assert.Empty(t, repos)
+
+	require.NoError(t, RegisterRepo(repoA))
+	require.NoError(t, RegisterRepo(repoB))
+	// Registering again only updates the entry.
+	require.NoError(t, RegisterRepo(repoA))
+
+	repos, err = ListRepos()
+	require.NoError(t, err)
+	require.Len(t, repos, 2)
+	assert.ElementsMatch(t, []string{repoA, repoB}, []string{repos[0].Path, repos[1].Path})
+
+	require.NoError(t, UnregisterRepo(repoA))
+	repos, err = ListRepos()
+	require.NoError(t, err)
+	require.Len(t, repos, 1)
+	assert.Equal(t, repoB, repos[0].Path)
+}
+
+func TestPruneRepos(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	repoA, err := GetCanonicalRepoPath(t.TempDir())
+	require.NoError(t, err)
+	repoB, err := GetCanonicalRepoPath(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, RegisterRepo(repoA))
+	require.NoError(t, RegisterRepo(repoB))
+
+	keep := func(path string) string { return "" }
+	pruned, err := PruneRepos(keep)
+	require.NoError(t, err)
+	assert.Empty(t, pruned)
+
+	pruned, err = PruneRepos(func(path string) string {
+		if path == repoA {
+			return "missing"
+		}
+		return ""
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []PrunedRepo{{Path: repoA, Reason: "missing"}}, pruned)
+
+	repos, err := ListRepos()
+	require.NoError(t, err)
+	require.Len(t, repos, 1)
+	assert.Equal(t, repoB, repos[0].Path)
+}
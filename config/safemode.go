@@ -0,0 +1,43 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// SafeModeEnv turns safe mode on when set to a true value such as 1, whatever the config says.
+const SafeModeEnv = "CS_SAFE_MODE"
+
+// ErrSafeMode is returned by destructive operations that were refused because safe mode is on.
+var ErrSafeMode = errors.New("safe mode is on")
+
+func safeModeEnv() bool {
+	on, err := strconv.ParseBool(os.Getenv(SafeModeEnv))
+	return err == nil && on
+}
+
+// SafeModeEnabled reports whether safe mode is on, from the config or the CS_SAFE_MODE environment variable, like
+// CheckSafeMode does.
+func SafeModeEnabled() bool {
+	return CheckSafeMode("") != nil
+}
+
+// CheckSafeMode returns an error wrapping ErrSafeMode that says what isn't done, e.g. "killing tmux session x", if
+// safe mode is on. The destructive operations of the git and tmux packages call it, so that safe mode holds whichever
+// command reaches them. A config that can't be read may have safe mode on, so it counts as on. The config isn't
+// written, unlike with LoadConfig.
+func CheckSafeMode(what string) error {
+	if safeModeEnv() {
+		return fmt.Errorf("%w (%s), so not %s", ErrSafeMode, SafeModeEnv, what)
+	}
+	config, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("%w, as far as can be told: %v, so not %s", ErrSafeMode, err, what)
+	}
+	if config.SafeMode {
+		return fmt.Errorf("%w (safe_mode in the config), so not %s", ErrSafeMode, what)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSafeMode(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	t.Setenv(SafeModeEnv, "")
+	require.NoError(t, CheckSafeMode("killing x"))
+	require.False(t, SafeModeEnabled())
+
+	t.Setenv(SafeModeEnv, "1")
+	err := CheckSafeMode("killing x")
+	require.ErrorIs(t, err, ErrSafeMode)
+	require.ErrorContains(t, err, "so not killing x")
+	require.True(t, SafeModeEnabled())
+
+	t.Setenv(SafeModeEnv, "false")
+	require.NoError(t, CheckSafeMode("killing x"))
+	require.False(t, SafeModeEnabled())
+
+	// Reading the config doesn't write it.
+	configPath, err := GetConfigPath()
+	require.NoError(t, err)
+	require.NoFileExists(t, configPath)
+
+	require.NoError(t, saveConfig(&Config{SafeMode: true}))
+	require.ErrorContains(t, CheckSafeMode("killing x"), "safe_mode in the config")
+	require.True(t, SafeModeEnabled())
+
+	// An unreadable config fails closed.
+	require.NoError(t, os.WriteFile(configPath, []byte("{"), 0644))
+	require.ErrorIs(t, CheckSafeMode("killing x"), ErrSafeMode)
+	require.True(t, SafeModeEnabled())
+}
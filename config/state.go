@@ -1,18 +1,25 @@
 package config
 
 import (
+	"bytes"
 	"claude-squad/log"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	StateFileName     = "state.json"
+	StateLockFileName = "state.lock"
 	InstancesFileName = "instances.json"
-	StateDirName      = ".claude-squad"
+	// DefaultStateDirName is the name of the state directory in each repository unless state_dir_name says
+	// otherwise.
+	DefaultStateDirName = ".claude-squad"
 )
 
 // InstanceStorage handles instance-related operations
@@ -25,6 +32,13 @@ type InstanceStorage interface {
 	DeleteAllInstances() error
 }
 
+// InstanceStreamer is implemented by instance storage that can read the stored instances one at a time, without
+// holding all of them in memory.
+type InstanceStreamer interface {
+	// StreamInstances calls fn with the raw JSON of each stored instance in turn, stopping at the first error.
+	StreamInstances(fn func(entry json.RawMessage) error) error
+}
+
 // AppState handles application-level state
 type AppState interface {
 	// GetHelpScreensSeen returns the bitmask of seen help screens
@@ -45,9 +59,15 @@ type State struct {
 	HelpScreensSeen uint32 `json:"help_screens_seen"`
 	// Instances stores the serialized instance data as raw JSON
 	InstancesData json.RawMessage `json:"instances"`
+	// RepoPath is the canonical path of the repository the state was saved for. LoadState refuses state saved for
+	// a different repository, e.g. after the project directory was copied.
+	RepoPath string `json:"repo_path,omitempty"`
 
 	// repoPath is the repository path this state belongs to (not serialized)
 	repoPath string `json:"-"`
+	// loadedInstances is the instance data as it was on disk when this state was loaded or last saved. SaveState
+	// compares it with the file to detect writes by other processes (not serialized).
+	loadedInstances json.RawMessage `json:"-"`
 }
 
 // DefaultState returns the default state
@@ -58,8 +78,85 @@ func DefaultState() *State {
 	}
 }
 
+// stateDirNames caches StateDirName by repository, as it's needed for most operations.
+var stateDirNames sync.Map
+
+// StateDirName returns the name of the repository's state directory, which holds its state, locks and worktrees:
+// the state_dir_name of the repository config, else that of the global config, else DefaultStateDirName. Invalid
+// names are logged and skipped. It's worked out once per process and repository. Changing the name doesn't move an
+// existing state directory.
+func StateDirName(repoPath string) string {
+	if name, ok := stateDirNames.Load(repoPath); ok {
+		return name.(string)
+	}
+	name := resolveStateDirName(repoPath)
+	stateDirNames.Store(repoPath, name)
+	return name
+}
+
+// resolveStateDirName is StateDirName without the cache.
+func resolveStateDirName(repoPath string) string {
+	var names []string
+	if repoConfig, err := LoadRepoConfig(repoPath); err != nil {
+		log.WarningLog.Printf("ignoring repository config: %v", err)
+	} else {
+		names = append(names, repoConfig.StateDirName)
+	}
+	if cfg, err := readConfig(); err != nil {
+		log.WarningLog.Printf("ignoring state_dir_name of the config: %v", err)
+	} else {
+		names = append(names, cfg.StateDirName)
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if err := CheckStateDirName(name); err != nil {
+			log.WarningLog.Printf("ignoring state directory name: %v", err)
+			continue
+		}
+		if err := checkStateDirUnused(repoPath, name); err != nil {
+			log.WarningLog.Printf("ignoring state directory name: %v", err)
+			continue
+		}
+		return name
+	}
+	return DefaultStateDirName
+}
+
+// CheckStateDirName returns an error unless name can name a state directory: a single directory name other than
+// ., .. and .git.
+func CheckStateDirName(name string) error {
+	if name == "" || name == "." || name == ".." || name == ".git" || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid state_dir_name %q: must be a single directory name other than ., .. and .git", name)
+	}
+	return nil
+}
+
+// checkStateDirUnused returns an error if name is a path of the repository's own, i.e. a file or a directory with
+// tracked files. The state directory ignores all of its contents, so using such a directory would hide it from git
+// and from instance diffs. A state directory cs made has no tracked files.
+func checkStateDirUnused(repoPath string, name string) error {
+	info, err := os.Stat(filepath.Join(repoPath, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil && !info.IsDir() {
+		return fmt.Errorf("invalid state_dir_name %q: it's a file of the repository", name)
+	}
+	output, err := exec.Command("git", "-C", repoPath, "ls-files", "--", name).Output()
+	if err != nil {
+		// Not a git repository, or git failed: nothing is tracked as far as we can tell.
+		return nil
+	}
+	if len(bytes.TrimSpace(output)) > 0 {
+		return fmt.Errorf("invalid state_dir_name %q: it holds files of the repository", name)
+	}
+	return nil
+}
+
 // GetStateDir returns the per-repo state directory path.
-// For a repository at /home/user/project, this returns /home/user/project/.claude-squad/
+// For a repository at /home/user/project, this returns /home/user/project/.claude-squad/ (see StateDirName).
 func GetStateDir(repoPath string) (string, error) {
 	// Get canonical path to handle symlinks
 	canonical, err := GetCanonicalRepoPath(repoPath)
@@ -67,7 +164,7 @@ func GetStateDir(repoPath string) (string, error) {
 		return "", fmt.Errorf("failed to get canonical repo path: %w", err)
 	}
 
-	stateDir := filepath.Join(canonical, StateDirName)
+	stateDir := filepath.Join(canonical, StateDirName(canonical))
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(stateDir, 0755); err != nil {
@@ -94,11 +191,12 @@ func LoadState(repoPath string) *State {
 	}
 
 	statePath := filepath.Join(stateDir, StateFileName)
-	data, err := os.ReadFile(statePath)
+	data, err := readStateFile(stateDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Create and save default state if file doesn't exist
 			defaultState := DefaultState()
+			defaultState.repoPath = repoPath
 			if saveErr := SaveState(defaultState, repoPath); saveErr != nil {
 				log.WarningLog.Printf("failed to save default state: %v", saveErr)
 			}
@@ -129,9 +227,10 @@ func LoadState(repoPath string) *State {
 		backupData, backupErr := os.ReadFile(backupPath)
 		if backupErr == nil {
 			var backupState State
-			if json.Unmarshal(backupData, &backupState) == nil {
+			if json.Unmarshal(backupData, &backupState) == nil && backupState.belongsTo(repoPath) {
 				log.InfoLog.Printf("successfully restored state from backup")
 				backupState.repoPath = repoPath
+				backupState.loadedInstances = backupState.InstancesData
 				return &backupState
 			}
 			log.ErrorLog.Printf("backup file is also corrupted")
@@ -144,10 +243,155 @@ func LoadState(repoPath string) *State {
 		return defaultState
 	}
 
+	if !state.belongsTo(repoPath) {
+		// The instances point at another repository's worktrees and tmux sessions, so don't load them.
+		foreignPath := fmt.Sprintf("%s.foreign.%d", statePath, time.Now().Unix())
+		log.WarningLog.Printf("state file belongs to %s, not %s: moving it to %s", state.RepoPath, repoPath, foreignPath)
+		if renameErr := os.Rename(statePath, foreignPath); renameErr != nil {
+			log.ErrorLog.Printf("failed to move foreign state: %v", renameErr)
+		}
+		defaultState := DefaultState()
+		defaultState.repoPath = repoPath
+		return defaultState
+	}
+
 	state.repoPath = repoPath
+	state.loadedInstances = state.InstancesData
 	return &state
 }
 
+// lockState blocks until this process holds the state lock of the repository, so that reading or writing the state
+// file never interleaves with another process. Call the returned function to release it.
+func lockState(stateDir string) (func(), error) {
+	file, err := os.OpenFile(filepath.Join(stateDir, StateLockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state lock: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock state: %w", err)
+	}
+	return func() { file.Close() }, nil
+}
+
+// readStateFile reads the state file while holding the state lock, since SaveState briefly moves it aside.
+func readStateFile(stateDir string) ([]byte, error) {
+	unlock, err := lockState(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return os.ReadFile(filepath.Join(stateDir, StateFileName))
+}
+
+// mergeInstances merges the instances another process saved (theirs) into the ones being saved (ours). base is the
+// instance data ours started from. Instances are matched by title: ones added by the other process are kept, ones it
+// removed are dropped unless we changed them, and ones it changed are taken from it unless we changed them too, in
+// which case ours win.
+func mergeInstances(base, ours, theirs json.RawMessage) (json.RawMessage, error) {
+	baseByTitle, _, err := instancesByTitle(base)
+	if err != nil {
+		return nil, err
+	}
+	oursByTitle, oursOrder, err := instancesByTitle(ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsByTitle, theirsOrder, err := instancesByTitle(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make([]json.RawMessage, 0, len(oursOrder))
+	for _, title := range oursOrder {
+		instance := oursByTitle[title]
+		baseInstance, inBase := baseByTitle[title]
+		theirInstance, inTheirs := theirsByTitle[title]
+		unchangedByUs := inBase && bytes.Equal(instance, baseInstance)
+		switch {
+		case unchangedByUs && !inTheirs:
+			// Removed by the other process
+			continue
+		case unchangedByUs && inTheirs:
+			merged = append(merged, theirInstance)
+		default:
+			merged = append(merged, instance)
+		}
+	}
+	for _, title := range theirsOrder {
+		_, inBase := baseByTitle[title]
+		_, inOurs := oursByTitle[title]
+		if !inBase && !inOurs {
+			// Added by the other process
+			merged = append(merged, theirsByTitle[title])
+		}
+	}
+
+	return json.Marshal(merged)
+}
+
+// instancesByTitle splits serialized instances into compacted entries keyed by title, along with the titles in order.
+func instancesByTitle(data json.RawMessage) (map[string]json.RawMessage, []string, error) {
+	var entries []json.RawMessage
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal instances: %w", err)
+		}
+	}
+
+	byTitle := make(map[string]json.RawMessage, len(entries))
+	titles := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		var instance struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(entry, &instance); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal instance: %w", err)
+		}
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, entry); err != nil {
+			return nil, nil, fmt.Errorf("failed to compact instance: %w", err)
+		}
+		if _, ok := byTitle[instance.Title]; !ok {
+			titles = append(titles, instance.Title)
+		}
+		byTitle[instance.Title] = compacted.Bytes()
+	}
+	return byTitle, titles, nil
+}
+
+// LeftoverStateFiles returns the state files that LoadState set aside (corrupted or foreign state) and nothing reads
+// anymore. The state.json.bak backup isn't included, as LoadState restores from it.
+func LeftoverStateFiles(repoPath string) ([]string, error) {
+	stateDir, err := GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+
+	var files []string
+	for _, suffix := range []string{".corrupted.*", ".foreign.*"} {
+		matches, err := filepath.Glob(filepath.Join(stateDir, StateFileName+suffix))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// belongsTo returns true if the state was saved for repoPath. State saved before the repo path was recorded is
+// accepted and gets keyed to the repo on the next save.
+func (s *State) belongsTo(repoPath string) bool {
+	if s.RepoPath == "" {
+		return true
+	}
+	canonical, err := GetCanonicalRepoPath(repoPath)
+	if err != nil {
+		canonical = repoPath
+	}
+	return s.RepoPath == canonical
+}
+
 // SaveState saves the state to disk with proactive backup
 func SaveState(state *State, repoPath string) error {
 	stateDir, err := GetStateDir(repoPath)
@@ -155,7 +399,34 @@ func SaveState(state *State, repoPath string) error {
 		return fmt.Errorf("failed to get state directory: %w", err)
 	}
 
+	// Key the state to its repository so it can't be picked up by another one
+	if canonical, err := GetCanonicalRepoPath(repoPath); err == nil {
+		state.RepoPath = canonical
+	}
+
+	// Hold the state lock so a concurrent save (e.g. from the TUI and a daemon that hasn't been stopped yet) can't
+	// interleave with ours, then merge whatever another process saved since we loaded.
+	unlock, err := lockState(stateDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	statePath := filepath.Join(stateDir, StateFileName)
+	if existing, err := os.ReadFile(statePath); err == nil && state.loadedInstances != nil {
+		var onDisk State
+		if json.Unmarshal(existing, &onDisk) == nil && !jsonEqual(onDisk.InstancesData, state.loadedInstances) {
+			merged, err := mergeInstances(state.loadedInstances, state.InstancesData, onDisk.InstancesData)
+			if err != nil {
+				log.WarningLog.Printf("failed to merge instances saved by another process, overwriting them: %v", err)
+			} else {
+				log.WarningLog.Printf("instances were saved by another process since they were loaded: merging")
+				state.InstancesData = merged
+			}
+			state.HelpScreensSeen |= onDisk.HelpScreensSeen
+		}
+	}
+
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
@@ -182,9 +453,19 @@ func SaveState(state *State, repoPath string) error {
 		return fmt.Errorf("failed to write state file: %w", err)
 	}
 
+	state.loadedInstances = state.InstancesData
 	return nil
 }
 
+// jsonEqual returns true if a and b are the same JSON apart from whitespace.
+func jsonEqual(a, b json.RawMessage) bool {
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
+
 // InstanceStorage interface implementation
 
 // SaveInstances saves the raw instance data
@@ -198,6 +479,84 @@ func (s *State) GetInstances() json.RawMessage {
 	return s.InstancesData
 }
 
+// StreamInstances decodes the instances one at a time from the state file, rather than from InstancesData. A state
+// that was never saved streams InstancesData instead.
+func (s *State) StreamInstances(fn func(entry json.RawMessage) error) error {
+	file, err := s.openStateFile()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return StreamArray(json.NewDecoder(bytes.NewReader(s.InstancesData)), fn)
+		}
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected a state object, got %v", token)
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key == "instances" {
+			return StreamArray(decoder, fn)
+		}
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openStateFile opens the state file while holding the state lock, since SaveState briefly moves it aside. Once
+// open, the file can be read without the lock: SaveState writes a new file rather than rewriting this one.
+func (s *State) openStateFile() (*os.File, error) {
+	if s.repoPath == "" {
+		return nil, os.ErrNotExist
+	}
+	stateDir, err := GetStateDir(s.repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+	unlock, err := lockState(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return os.Open(filepath.Join(stateDir, StateFileName))
+}
+
+// StreamArray calls fn with each element of the JSON array decoder is at, decoding them one at a time. A null array
+// has no elements.
+func StreamArray(decoder *json.Decoder, fn func(element json.RawMessage) error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected a list, got %v", token)
+	}
+	for decoder.More() {
+		var element json.RawMessage
+		if err := decoder.Decode(&element); err != nil {
+			return err
+		}
+		if err := fn(element); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
+
 // DeleteAllInstances removes all stored instances
 func (s *State) DeleteAllInstances() error {
 	s.InstancesData = json.RawMessage("[]")
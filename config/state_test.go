@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadStateRejectsForeignState(t *testing.T) {
+	repoA := t.TempDir()
+	repoB := t.TempDir()
+
+	state := LoadState(repoA)
+	require.NoError(t, state.SaveInstances(json.RawMessage(`[{"title":"task"}]`)))
+
+	canonicalA, err := GetCanonicalRepoPath(repoA)
+	require.NoError(t, err)
+	assert.Equal(t, canonicalA, LoadState(repoA).RepoPath)
+	assert.JSONEq(t, `[{"title":"task"}]`, string(LoadState(repoA).GetInstances()))
+
+	// Copy the state into another repository, as if the project directory was copied.
+	data, err := os.ReadFile(filepath.Join(repoA, DefaultStateDirName, StateFileName))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(repoB, DefaultStateDirName), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoB, DefaultStateDirName, StateFileName), data, 0644))
+
+	foreign := LoadState(repoB)
+	assert.JSONEq(t, `[]`, string(foreign.GetInstances()))
+
+	// The foreign state is preserved for inspection.
+	matches, err := filepath.Glob(filepath.Join(repoB, DefaultStateDirName, StateFileName+".foreign.*"))
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestLoadStateAcceptsUnkeyedState(t *testing.T) {
+	repo := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, DefaultStateDirName), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, DefaultStateDirName, StateFileName),
+		[]byte(`{"help_screens_seen": 1, "instances": [{"title":"task"}]}`), 0644))
+
+	state := LoadState(repo)
+	assert.JSONEq(t, `[{"title":"task"}]`, string(state.GetInstances()))
+}
+
+func TestLeftoverStateFiles(t *testing.T) {
+	repo := t.TempDir()
+	state := LoadState(repo)
+	require.NoError(t, state.SaveInstances(json.RawMessage(`[]`)))
+
+	stateDir, err := GetStateDir(repo)
+	require.NoError(t, err)
+	corrupted := filepath.Join(stateDir, StateFileName+".corrupted.1")
+	foreign := filepath.Join(stateDir, StateFileName+".foreign.2")
+	require.NoError(t, os.WriteFile(corrupted, []byte("{"), 0644))
+	require.NoError(t, os.WriteFile(foreign, []byte("{}"), 0644))
+
+	files, err := LeftoverStateFiles(repo)
+	require.NoError(t, err)
+	// The live state and its backup are never leftovers.
+	assert.ElementsMatch(t, []string{corrupted, foreign}, files)
+}
+
+func TestSaveStateMergesConcurrentSaves(t *testing.T) {
+	repo := t.TempDir()
+	require.NoError(t, LoadState(repo).SaveInstances(json.RawMessage(`[{"title":"shared","status":0}]`)))
+
+	// Two processes, e.g. the TUI and a daemon, load the same state.
+	tui := LoadState(repo)
+	daemon := LoadState(repo)
+
+	require.NoError(t, tui.SaveInstances(json.RawMessage(`[{"title":"shared","status":0},{"title":"new","status":0}]`)))
+	// The daemon only updated the shared instance; it must not drop the one the TUI added.
+	require.NoError(t, daemon.SaveInstances(json.RawMessage(`[{"title":"shared","status":1}]`)))
+	assert.JSONEq(t, `[{"title":"shared","status":1},{"title":"new","status":0}]`,
+		string(LoadState(repo).GetInstances()))
+
+	// Removing an instance sticks, and the daemon's change to the instance the TUI didn't touch is kept.
+	require.NoError(t, tui.SaveInstances(json.RawMessage(`[{"title":"shared","status":0}]`)))
+	assert.JSONEq(t, `[{"title":"shared","status":1}]`, string(LoadState(repo).GetInstances()))
+}
+
+func TestStateStreamInstances(t *testing.T) {
+	repo := t.TempDir()
+	stream := func(state *State) ([]string, error) {
+		var titles []string
+		err := state.StreamInstances(func(entry json.RawMessage) error {
+			var instance struct {
+				Title string `json:"title"`
+			}
+			if err := json.Unmarshal(entry, &instance); err != nil {
+				return err
+			}
+			titles = append(titles, instance.Title)
+			return nil
+		})
+		return titles, err
+	}
+
+	// A state that was never saved streams what it holds.
+	entries, err := stream(DefaultState())
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	state := LoadState(repo)
+	require.NoError(t, state.SaveInstances(json.RawMessage(`[{"title":"one"},{"title":"two"}]`)))
+	entries, err = stream(state)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two"}, entries)
+
+	// The instances are read from the file, so a file cut short fails the stream after the complete entries.
+	statePath := filepath.Join(repo, DefaultStateDirName, StateFileName)
+	require.NoError(t, os.WriteFile(statePath, []byte(`{"help_screens_seen": 1, "instances": [{"title":"one"}, {"ti`),
+		0644))
+	entries, err = stream(state)
+	require.Error(t, err)
+	assert.Equal(t, []string{"one"}, entries)
+}
+
+func TestStateDirName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, DefaultStateDirName, resolveStateDirName(repo))
+
+	configDir, err := GetConfigDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(configDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, ConfigFileName), []byte(`{"state_dir_name": ".cs"}`), 0644))
+	assert.Equal(t, ".cs", resolveStateDirName(repo))
+	stateDir, err := GetStateDir(repo)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, ".cs"), stateDir)
+	assert.FileExists(t, filepath.Join(stateDir, ".gitignore"))
+
+	// The name is worked out once per repository.
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, ConfigFileName), []byte(`{"state_dir_name": "_cs"}`), 0644))
+	assert.Equal(t, ".cs", StateDirName(repo))
+	assert.Equal(t, "_cs", resolveStateDirName(repo))
+
+	// The repository's own config wins, unless its name is invalid.
+	repoConfigPath := filepath.Join(repo, RepoConfigFileName)
+	require.NoError(t, os.WriteFile(repoConfigPath, []byte(`{"state_dir_name": ".agents"}`), 0644))
+	assert.Equal(t, ".agents", resolveStateDirName(repo))
+	require.NoError(t, os.WriteFile(repoConfigPath, []byte(`{"state_dir_name": "../elsewhere"}`), 0644))
+	assert.Equal(t, "_cs", resolveStateDirName(repo))
+
+	// So is a directory of the repository's own, which the state directory's .gitignore would hide.
+	output, err := exec.Command("git", "-C", repo, "init", "-q").CombinedOutput()
+	require.NoError(t, err, string(output))
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "src", "main.go"), []byte("package main\n"), 0644))
+	output, err = exec.Command("git", "-C", repo, "add", "src").CombinedOutput()
+	require.NoError(t, err, string(output))
+	require.NoError(t, os.WriteFile(repoConfigPath, []byte(`{"state_dir_name": "src"}`), 0644))
+	assert.Equal(t, "_cs", resolveStateDirName(repo))
+	require.NoError(t, os.WriteFile(repoConfigPath, []byte(`{"state_dir_name": ".cs"}`), 0644))
+	assert.Equal(t, ".cs", resolveStateDirName(repo))
+
+	for _, name := range []string{"", ".", "..", ".git", "a/b"} {
+		assert.Error(t, CheckStateDirName(name), name)
+	}
+}
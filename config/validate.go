@@ -0,0 +1,56 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ValidateConfig checks the contents of a config file: it must be a JSON object whose properties are all config
+// fields of the right type, and fields with an `enum` tag must hold one of the allowed values (or be empty).
+// LoadConfig is more forgiving, ignoring unknown properties and falling back to the defaults on a parse error.
+func ValidateConfig(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var cfg Config
+	if err := decoder.Decode(&cfg); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("invalid config: unexpected data after the JSON object")
+	}
+
+	if _, err := NewRedactor(cfg.RedactPatterns); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.StateDirName != "" {
+		if err := CheckStateDirName(cfg.StateDirName); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	for _, repo := range cfg.TrustedRepos {
+		if !filepath.IsAbs(repo) {
+			return fmt.Errorf("invalid config: trusted_repos must hold absolute paths, got %q", repo)
+		}
+	}
+
+	value := reflect.ValueOf(cfg)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		enum := field.Tag.Get("enum")
+		if enum == "" || field.Type.Kind() != reflect.String {
+			continue
+		}
+		allowed := strings.Split(enum, ",")
+		if v := value.Field(i).String(); v != "" && !slices.Contains(allowed, v) {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			return fmt.Errorf("invalid config: %s must be one of %s, got %q", name, strings.Join(allowed, ", "), v)
+		}
+	}
+	return nil
+}
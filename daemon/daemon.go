@@ -2,42 +2,57 @@ package daemon
 
 import (
 	"claude-squad/config"
+	"claude-squad/lock"
 	"claude-squad/log"
 	"claude-squad/session"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"sync"
 	"syscall"
 	"time"
 )
 
+// ErrDaemonNotRunning is returned when no daemon PID file exists for a repository.
+var ErrDaemonNotRunning = errors.New("daemon is not running")
+
+// ErrDaemonRunning is returned when launching a daemon for a repository whose daemon is already running.
+var ErrDaemonRunning = errors.New("daemon is already running")
+
 // RunDaemon runs the daemon process which iterates over all sessions in a repository and runs AutoYes mode on them.
+// In monitor mode it only tracks the instances' diff stats and never accepts prompts.
 // It's expected that the main process kills the daemon when the main process starts.
-func RunDaemon(cfg *config.Config, repoPath string) error {
-	log.InfoLog.Printf("starting daemon for repo: %s", repoPath)
+func RunDaemon(cfg *config.Config, repoPath string, monitor bool) error {
+	log.InfoLog.Printf("starting daemon for repo: %s (monitor: %t)", repoPath, monitor)
 	state := config.LoadState(repoPath)
 	storage, err := session.NewStorage(state)
 	if err != nil {
 		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
-	instances, err := storage.LoadInstances()
+	instances, err := loadInstances(storage, monitor)
 	if err != nil {
-		return fmt.Errorf("failed to load instacnes: %w", err)
-	}
-	for _, instance := range instances {
-		// Assume AutoYes is true if the daemon is running.
-		instance.AutoYes = true
+		return err
 	}
+	set := newInstanceSet(instances)
 
 	pollInterval := time.Duration(cfg.DaemonPollInterval) * time.Millisecond
 
 	// If we get an error for a session, it's likely that we'll keep getting the error. Log every 30 seconds.
 	everyN := log.NewEvery(60 * time.Second)
 
+	var heartbeatFile string
+	var events *eventLog
+	if stateDir, err := config.GetStateDir(repoPath); err == nil {
+		heartbeatFile = filepath.Join(stateDir, heartbeatFileName)
+		events = &eventLog{path: filepath.Join(stateDir, eventsFileName), redactor: cfg.Redactor()}
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	stopCh := make(chan struct{})
@@ -45,17 +60,19 @@ func RunDaemon(cfg *config.Config, repoPath string) error {
 		defer wg.Done()
 		ticker := time.NewTimer(pollInterval)
 		for {
-			for _, instance := range instances {
-				// We only store started instances, but check anyway.
-				if instance.Started() && !instance.Paused() {
-					if _, hasPrompt := instance.HasUpdated(); hasPrompt {
-						instance.TapEnter()
-						if err := instance.UpdateDiffStats(); err != nil {
-							if everyN.ShouldLog() {
-								log.WarningLog.Printf("could not update diff stats for %s: %v", instance.Title, err)
-							}
-						}
-					}
+			var killed []*session.Instance
+			live := session.LiveSessions()
+			set.forEach(func(instance *session.Instance) {
+				if enforceMaxRuntime(cfg, repoPath, events, instance) {
+					killed = append(killed, instance)
+					return
+				}
+				pollInstance(cfg, events, instance, live, everyN, monitor)
+			})
+			set.remove(killed)
+			if heartbeatFile != "" {
+				if err := touchHeartbeat(heartbeatFile); err != nil && everyN.ShouldLog() {
+					log.WarningLog.Printf("failed to update heartbeat: %v", err)
 				}
 			}
 
@@ -71,24 +88,302 @@ func RunDaemon(cfg *config.Config, repoPath string) error {
 		}
 	}()
 
-	// Notify on SIGINT (Ctrl+C) and SIGTERM. Save instances before
+	// Notify on SIGINT (Ctrl+C) and SIGTERM to save the instances before exiting, and on SIGHUP to reload them from
+	// storage, e.g. after cs kill removed some (see ReloadDaemon).
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	sig := <-sigChan
+	for sig == syscall.SIGHUP {
+		log.InfoLog.Printf("received signal %s, reloading instances", sig.String())
+		if instances, err := loadInstances(storage, monitor); err != nil {
+			log.ErrorLog.Printf("failed to reload instances, keeping the loaded ones: %v", err)
+		} else {
+			set.replace(instances)
+		}
+		sig = <-sigChan
+	}
 	log.InfoLog.Printf("received signal %s", sig.String())
 
 	// Stop the goroutine so we don't race.
 	close(stopCh)
 	wg.Wait()
 
-	if err := storage.SaveInstances(instances); err != nil {
+	if err := set.save(storage); err != nil {
 		log.ErrorLog.Printf("failed to save instances when terminating daemon: %v", err)
 	}
 	return nil
 }
 
-// LaunchDaemon launches the daemon process for a specific repository.
-func LaunchDaemon(repoPath string) error {
+// loadInstances loads the stored instances and sets their AutoYes for the daemon: on unless the instance opted out,
+// or always off in monitor mode. Only fails if no instance could be loaded.
+func loadInstances(storage *session.Storage, monitor bool) ([]*session.Instance, error) {
+	instances, err := storage.LoadInstances()
+	if err != nil {
+		if len(instances) == 0 {
+			return nil, fmt.Errorf("failed to load instances: %w", err)
+		}
+		// Keep running autoyes for the instances that did load
+		log.ErrorLog.Printf("some instances failed to load: %v", err)
+	}
+	for _, instance := range instances {
+		if monitor {
+			// A monitor never accepts prompts, whatever the instance's override says.
+			instance.AutoYes = false
+			continue
+		}
+		// Assume AutoYes is true if the daemon is running, unless the instance opted out.
+		instance.ApplyAutoYes(true)
+	}
+	return instances, nil
+}
+
+// pollInstance accepts the prompt the instance is waiting on, the way configured for its program, records
+// it in events, and refreshes its diff stats. In monitor mode it never accepts prompts, and refreshes the diff stats
+// whenever the instance's output changed. live are the live tmux sessions (see session.StatusIn).
+func pollInstance(cfg *config.Config, events *eventLog, instance *session.Instance, live map[string]bool,
+	everyN *log.Every, monitor bool) {
+	// We only store started instances, but check anyway.
+	if !instance.Started() || instance.Paused() || instance.Archived {
+		events.promptGone(instance.Title)
+		return
+	}
+	if status := instance.StatusIn(live); status == session.Crashed || status == session.Done {
+		instance.SetStatus(status)
+		events.promptGone(instance.Title)
+		return
+	}
+	updated, hasPrompt := instance.HasUpdated()
+	if !hasPrompt {
+		events.promptGone(instance.Title)
+	} else if !monitor {
+		event := Event{Instance: instance.Title, Action: EventConfirm, Prompt: instance.WaitingPrompt()}
+		accepted, err := instance.AcceptPrompt(cfg.AutoYesFor(instance.Program))
+		if err != nil {
+			log.ErrorLog.Printf("%s: %v", instance.Title, err)
+			event.Action, event.Error = EventError, err.Error()
+		}
+		if accepted || err != nil {
+			// The prompt stays on screen until the agent redraws, so later polls may answer it again.
+			if err := events.recordPrompt(event); err != nil {
+				log.ErrorLog.Printf("failed to record %s event for instance %s: %v", event.Action, event.Instance, err)
+			}
+		}
+	}
+	if hasPrompt || (monitor && updated) {
+		if err := instance.UpdateDiffStats(); err != nil {
+			if everyN.ShouldLog() {
+				log.WarningLog.Printf("could not update diff stats for %s: %v", instance.Title, err)
+			}
+		}
+	}
+}
+
+// enforceMaxRuntime pauses or kills the instance, as configured, if it has run longer than cfg.MaxRuntime, saves
+// the change, records it in events and runs the max runtime hook. Returns true if the instance was killed.
+func enforceMaxRuntime(cfg *config.Config, repoPath string, events *eventLog, instance *session.Instance) bool {
+	maxRuntime := time.Duration(cfg.MaxRuntime) * time.Minute
+	runtime := instance.Runtime(time.Now())
+	if maxRuntime <= 0 || runtime <= maxRuntime {
+		return false
+	}
+
+	action := cfg.MaxRuntimeAction
+	if action != config.MaxRuntimeKill {
+		action = config.MaxRuntimePause
+	}
+	log.WarningLog.Printf("instance %s ran for %s, longer than max_runtime (%s); max_runtime_action is %s", instance.Title,
+		runtime.Round(time.Second), maxRuntime, action)
+
+	var err error
+	if action == config.MaxRuntimeKill {
+		err = instance.Kill()
+	} else {
+		err = instance.Pause()
+	}
+	if err != nil {
+		// Try again after another max_runtime rather than on every poll.
+		log.ErrorLog.Printf("failed to %s instance %s: %v", action, instance.Title, err)
+		recordEvent(events, Event{Instance: instance.Title, Action: EventError,
+			Error: fmt.Sprintf("failed to %s after max_runtime: %v", action, err)})
+		instance.RunningSince = time.Now()
+		return false
+	}
+	eventAction := EventPause
+	if action == config.MaxRuntimeKill {
+		eventAction = EventKill
+	}
+	recordEvent(events, Event{Instance: instance.Title, Action: eventAction})
+
+	killed := action == config.MaxRuntimeKill
+	// The daemon is stopped with SIGKILL, so the change has to be saved now rather than on shutdown.
+	if err := saveInstance(repoPath, instance, killed); err != nil {
+		log.ErrorLog.Printf("failed to save instance %s: %v", instance.Title, err)
+	}
+	if cfg.MaxRuntimeHook != "" {
+		// The hook may take a while, e.g. to notify someone, and polling the other instances can't wait for it.
+		go runMaxRuntimeHook(cfg.MaxRuntimeHook, instance.Title, instance.Branch, instance.Path, action)
+	}
+	return killed
+}
+
+// recordEvent appends the event to events, logging rather than returning a failure so polling carries on.
+func recordEvent(events *eventLog, event Event) {
+	if err := events.record(event); err != nil {
+		log.ErrorLog.Printf("failed to record %s event for instance %s: %v", event.Action, event.Instance, err)
+	}
+}
+
+// repoLockWait is how long saveInstance waits for a command holding the repo lock, e.g. cs kill, to finish.
+const repoLockWait = 10 * time.Second
+
+// saveInstance stores the instance's record, or deletes it if the instance was killed, leaving the other stored
+// instances as they are. Like the commands that change the stored instances, it holds the repo lock while it loads
+// and saves them.
+func saveInstance(repoPath string, instance *session.Instance, killed bool) error {
+	repoLock, err := acquireRepoLock(repoPath, repoLockWait)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := repoLock.Release(); err != nil {
+			log.ErrorLog.Printf("failed to release lock: %v", err)
+		}
+	}()
+
+	storage, err := session.NewStorage(config.LoadState(repoPath))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return err
+	}
+	saved := make([]session.InstanceData, 0, len(instancesData))
+	for _, data := range instancesData {
+		if data.Title == instance.Title {
+			if killed {
+				continue
+			}
+			data = instance.ToInstanceData()
+		}
+		saved = append(saved, data)
+	}
+	return storage.SaveInstanceData(saved)
+}
+
+// acquireRepoLock acquires the repo lock, retrying for up to wait while another process holds it.
+func acquireRepoLock(repoPath string, wait time.Duration) (*lock.Lock, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		repoLock, err := lock.AcquireLock(repoPath)
+		var held *lock.LockHeldError
+		if err == nil || !errors.As(err, &held) || time.Now().After(deadline) {
+			return repoLock, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// maxRuntimeHookTimeout is how long the max runtime hook may run before it's killed.
+const maxRuntimeHookTimeout = 5 * time.Minute
+
+// runMaxRuntimeHook runs the configured max runtime hook for an instance the daemon paused or killed, killing it if
+// it runs longer than maxRuntimeHookTimeout.
+func runMaxRuntimeHook(hook, title, branch, path, action string) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxRuntimeHookTimeout)
+	defer cancel()
+	hookCmd := exec.CommandContext(ctx, "sh", "-c", hook)
+	hookCmd.Dir = path
+	hookCmd.Env = append(os.Environ(),
+		"CLAUDE_SQUAD_INSTANCE="+title,
+		"CLAUDE_SQUAD_BRANCH="+branch,
+		"CLAUDE_SQUAD_ACTION="+action,
+	)
+	if output, err := hookCmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("killed after %s", maxRuntimeHookTimeout)
+		}
+		log.ErrorLog.Printf("max runtime hook failed for instance %s: %v: %s", title, err, output)
+	}
+}
+
+// instanceSet guards the instances shared by the daemon's polling goroutine and anything else that reads or
+// mutates them, such as the shutdown path saving them to storage.
+type instanceSet struct {
+	mu        sync.Mutex
+	instances []*session.Instance
+}
+
+func newInstanceSet(instances []*session.Instance) *instanceSet {
+	return &instanceSet{instances: instances}
+}
+
+// forEach calls fn for every instance while holding the lock. fn must not call back into the set.
+func (s *instanceSet) forEach(fn func(instance *session.Instance)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, instance := range s.instances {
+		fn(instance)
+	}
+}
+
+// remove drops the given instances from the set.
+func (s *instanceSet) remove(removed []*session.Instance) {
+	if len(removed) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instances = slices.DeleteFunc(s.instances, func(instance *session.Instance) bool {
+		return slices.Contains(removed, instance)
+	})
+}
+
+// replace swaps the set's instances for the given ones, disconnecting the old ones from their tmux sessions without
+// killing them.
+func (s *instanceSet) replace(instances []*session.Instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, instance := range s.instances {
+		if err := instance.Disconnect(); err != nil {
+			log.WarningLog.Printf("failed to disconnect from instance %s: %v", instance.Title, err)
+		}
+	}
+	s.instances = instances
+}
+
+// save persists the instances. The lock is held while serializing so no instance is mutated mid-save.
+func (s *instanceSet) save(storage *session.Storage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return storage.SaveInstances(s.instances)
+}
+
+// LaunchDaemon launches the daemon process for a specific repository. A monitor daemon only tracks diff stats (see
+// RunDaemon). Returns ErrDaemonRunning if the repository's daemon is already alive, and a *lock.LockHeldError if
+// another process is launching it right now.
+func LaunchDaemon(repoPath string, monitor bool) error {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get state directory: %w", err)
+	}
+	pidFile := filepath.Join(stateDir, pidFileName)
+
+	// Hold the lock from checking the PID file until the new daemon's PID is written, or a concurrent launch would
+	// overwrite it and orphan one of the daemons.
+	launchLock, err := lock.AcquireDaemonLock(repoPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := launchLock.Release(); err != nil {
+			log.ErrorLog.Printf("failed to release daemon lock: %v", err)
+		}
+	}()
+	if pid, err := readPIDFile(pidFile); err == nil && processAlive(pid) {
+		return fmt.Errorf("%w (PID %d)", ErrDaemonRunning, pid)
+	}
+
 	// Find the claude squad binary.
 	execPath, err := os.Executable()
 	if err != nil {
@@ -96,7 +391,15 @@ func LaunchDaemon(repoPath string) error {
 	}
 
 	// Pass repo path to daemon so it knows which repo to monitor
-	cmd := exec.Command(execPath, "--daemon", "--repo-path", repoPath)
+	args := []string{"--daemon", "--repo-path", repoPath}
+	if monitor {
+		args = append(args, "--monitor")
+	}
+	// The daemon should read the same config as the process launching it.
+	if configPath, err := config.GetConfigPath(); err == nil {
+		args = append(args, "--config", configPath)
+	}
+	cmd := exec.Command(execPath, args...)
 
 	// Detach the process from the parent
 	cmd.Stdin = nil
@@ -113,12 +416,6 @@ func LaunchDaemon(repoPath string) error {
 	log.InfoLog.Printf("started daemon child process with PID: %d for repo %s", cmd.Process.Pid, repoPath)
 
 	// Save PID to per-repo state directory
-	stateDir, err := config.GetStateDir(repoPath)
-	if err != nil {
-		return fmt.Errorf("failed to get state directory: %w", err)
-	}
-
-	pidFile := filepath.Join(stateDir, "daemon.pid")
 	if err := os.WriteFile(pidFile, []byte(fmt.Sprintf("%d", cmd.Process.Pid)), 0644); err != nil {
 		return fmt.Errorf("failed to write PID file: %w", err)
 	}
@@ -135,18 +432,13 @@ func StopDaemon(repoPath string) error {
 		return fmt.Errorf("failed to get state directory: %w", err)
 	}
 
-	pidFile := filepath.Join(stateDir, "daemon.pid")
-	data, err := os.ReadFile(pidFile)
+	pidFile := filepath.Join(stateDir, pidFileName)
+	pid, err := readPIDFile(pidFile)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, ErrDaemonNotRunning) {
 			return nil
 		}
-		return fmt.Errorf("failed to read PID file: %w", err)
-	}
-
-	var pid int
-	if _, err := fmt.Sscanf(string(data), "%d", &pid); err != nil {
-		return fmt.Errorf("invalid PID file format: %w", err)
+		return err
 	}
 
 	proc, err := os.FindProcess(pid)
@@ -166,3 +458,44 @@ func StopDaemon(repoPath string) error {
 	log.InfoLog.Printf("daemon process (PID: %d) stopped successfully", pid)
 	return nil
 }
+
+// ReloadDaemon tells the repository's running daemon to reload its instances from storage, so it stops polling the
+// ones killed since it started. Does nothing if the daemon isn't running.
+func ReloadDaemon(repoPath string) error {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get state directory: %w", err)
+	}
+	pid, err := readPIDFile(filepath.Join(stateDir, pidFileName))
+	if err != nil {
+		if errors.Is(err, ErrDaemonNotRunning) {
+			return nil
+		}
+		return err
+	}
+	if !processAlive(pid) {
+		return nil
+	}
+	if err := signalReload(pid); err != nil {
+		return fmt.Errorf("failed to reload daemon (PID %d): %w", pid, err)
+	}
+	log.InfoLog.Printf("told daemon process (PID: %d) to reload its instances", pid)
+	return nil
+}
+
+// readPIDFile reads the daemon PID from pidFile. Returns ErrDaemonNotRunning if the file doesn't exist.
+func readPIDFile(pidFile string) (int, error) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrDaemonNotRunning
+		}
+		return 0, fmt.Errorf("failed to read PID file: %w", err)
+	}
+
+	var pid int
+	if _, err := fmt.Sscanf(string(data), "%d", &pid); err != nil {
+		return 0, fmt.Errorf("invalid PID file format: %w", err)
+	}
+	return pid, nil
+}
@@ -0,0 +1,272 @@
+package daemon
+
+import (
+	"claude-squad/config"
+	"claude-squad/lock"
+	"claude-squad/log"
+	"claude-squad/session"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs before all tests to set up the test environment
+func TestMain(m *testing.M) {
+	// Initialize the logger before any tests run
+	log.Initialize(false)
+	defer log.Close()
+
+	exitCode := m.Run()
+	os.Exit(exitCode)
+}
+
+// memoryStorage is an in-memory config.InstanceStorage
+type memoryStorage struct {
+	mu   sync.Mutex
+	data json.RawMessage
+}
+
+func (s *memoryStorage) SaveInstances(instancesJSON json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = instancesJSON
+	return nil
+}
+
+func (s *memoryStorage) GetInstances() json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data
+}
+
+func (s *memoryStorage) DeleteAllInstances() error {
+	return s.SaveInstances(json.RawMessage("[]"))
+}
+
+// TestInstanceSetConcurrentPollAndSave exercises the polling and save paths concurrently. Run with -race.
+func TestInstanceSetConcurrentPollAndSave(t *testing.T) {
+	var instances []*session.Instance
+	for _, title := range []string{"one", "two", "three"} {
+		// Paused instances are started without touching tmux.
+		instance, err := session.FromInstanceData(session.InstanceData{
+			Title:   title,
+			Path:    t.TempDir(),
+			Status:  session.Paused,
+			Started: true,
+		})
+		require.NoError(t, err)
+		instances = append(instances, instance)
+	}
+	set := newInstanceSet(instances)
+
+	storage, err := session.NewStorage(&memoryStorage{})
+	require.NoError(t, err)
+
+	everyN := log.NewEvery(time.Minute)
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			set.forEach(func(instance *session.Instance) {
+				pollInstance(&config.Config{}, nil, instance, nil, everyN, false)
+				instance.AutoYes = !instance.AutoYes
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			require.NoError(t, set.save(storage))
+		}
+	}()
+	wg.Wait()
+
+	saved, err := storage.LoadInstanceData()
+	require.NoError(t, err)
+	require.Len(t, saved, 3)
+}
+
+func TestReadPIDFile(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), pidFileName)
+
+	_, err := readPIDFile(pidFile)
+	require.ErrorIs(t, err, ErrDaemonNotRunning)
+
+	require.NoError(t, os.WriteFile(pidFile, []byte("1234"), 0644))
+	pid, err := readPIDFile(pidFile)
+	require.NoError(t, err)
+	require.Equal(t, 1234, pid)
+
+	require.NoError(t, os.WriteFile(pidFile, []byte("garbage"), 0644))
+	_, err = readPIDFile(pidFile)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrDaemonNotRunning)
+}
+
+func TestGetStatus(t *testing.T) {
+	repoPath := t.TempDir()
+
+	status, err := GetStatus(repoPath)
+	require.NoError(t, err)
+	require.False(t, status.Running)
+	require.False(t, status.Stale)
+	require.Nil(t, status.LastHeartbeat)
+
+	stateDir := filepath.Join(repoPath, ".claude-squad")
+	pid := os.Getpid()
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, pidFileName), []byte(fmt.Sprintf("%d", pid)), 0644))
+	require.NoError(t, touchHeartbeat(filepath.Join(stateDir, heartbeatFileName)))
+
+	status, err = GetStatus(repoPath)
+	require.NoError(t, err)
+	require.True(t, status.Running)
+	require.False(t, status.Stale)
+	require.Equal(t, pid, status.PID)
+	require.NotNil(t, status.LastHeartbeat)
+}
+
+func TestLaunchDaemonRefusesConcurrentLaunch(t *testing.T) {
+	repoPath := t.TempDir()
+
+	launchLock, err := lock.AcquireDaemonLock(repoPath)
+	require.NoError(t, err)
+	err = LaunchDaemon(repoPath, false)
+	var held *lock.LockHeldError
+	require.ErrorAs(t, err, &held)
+	require.True(t, held.Daemon)
+	require.NoError(t, launchLock.Release())
+
+	// A live daemon isn't replaced. Our own PID stands in for it.
+	stateDir := filepath.Join(repoPath, ".claude-squad")
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, pidFileName), []byte(fmt.Sprintf("%d", os.Getpid())), 0644))
+	require.ErrorIs(t, LaunchDaemon(repoPath, false), ErrDaemonRunning)
+}
+
+func TestEvents(t *testing.T) {
+	repoPath := t.TempDir()
+
+	events, err := ReadEvents(repoPath)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	stateDir, err := config.GetStateDir(repoPath)
+	require.NoError(t, err)
+	eventsFile := filepath.Join(stateDir, eventsFileName)
+	l := &eventLog{path: eventsFile}
+	require.NoError(t, l.record(Event{Instance: "one", Action: EventConfirm, Prompt: "Allow this command?"}))
+	// A line cut short by the daemon being killed mid-write is skipped.
+	f, err := os.OpenFile(eventsFile, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"time":"2025-01-02T15:04:05Z","inst` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, l.record(Event{Instance: "two", Action: EventPause}))
+	require.NoError(t, (*eventLog)(nil).record(Event{Instance: "three", Action: EventKill}))
+
+	events, err = ReadEvents(repoPath)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, "one", events[0].Instance)
+	require.Equal(t, EventConfirm, events[0].Action)
+	require.Equal(t, "Allow this command?", events[0].Prompt)
+	require.False(t, events[0].Time.IsZero())
+	require.Equal(t, "two", events[1].Instance)
+	require.Equal(t, EventPause, events[1].Action)
+	require.Empty(t, events[1].Prompt)
+}
+
+func TestEventsRecordEachPromptOnce(t *testing.T) {
+	repoPath := t.TempDir()
+	stateDir, err := config.GetStateDir(repoPath)
+	require.NoError(t, err)
+	l := &eventLog{path: filepath.Join(stateDir, eventsFileName)}
+
+	confirm := Event{Instance: "one", Action: EventConfirm, Prompt: "Allow this command?"}
+	require.NoError(t, l.recordPrompt(confirm))
+	require.NoError(t, l.recordPrompt(confirm))
+	// Another instance's prompt and a different outcome for the same prompt are recorded.
+	require.NoError(t, l.recordPrompt(Event{Instance: "two", Action: EventConfirm}))
+	require.NoError(t, l.recordPrompt(Event{Instance: "one", Action: EventError, Error: "no session"}))
+	require.NoError(t, l.recordPrompt(Event{Instance: "one", Action: EventError, Error: "no session"}))
+	// Once the prompt is gone, the next one is recorded.
+	l.promptGone("one")
+	require.NoError(t, l.recordPrompt(confirm))
+
+	events, err := ReadEvents(repoPath)
+	require.NoError(t, err)
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.Instance+" "+event.Action)
+	}
+	require.Equal(t, []string{"one confirm", "two confirm", "one error", "one confirm"}, actions)
+}
+
+func TestEventsRotate(t *testing.T) {
+	repoPath := t.TempDir()
+	stateDir, err := config.GetStateDir(repoPath)
+	require.NoError(t, err)
+	eventsFile := filepath.Join(stateDir, eventsFileName)
+	l := &eventLog{path: eventsFile, maxSize: 200}
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.record(Event{Instance: fmt.Sprintf("instance-%d", i), Action: EventPause}))
+	}
+	for _, path := range []string{eventsFile, eventsFile + ".1"} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.LessOrEqual(t, info.Size(), int64(200))
+	}
+
+	// The events of the rotated file come first, and the oldest ones are gone.
+	events, err := ReadEvents(repoPath)
+	require.NoError(t, err)
+	require.Less(t, len(events), 10)
+	for i, event := range events {
+		require.Equal(t, fmt.Sprintf("instance-%d", 10-len(events)+i), event.Instance)
+	}
+}
+
+func TestReloadDaemonWithoutDaemon(t *testing.T) {
+	repoPath := t.TempDir()
+	require.NoError(t, ReloadDaemon(repoPath))
+
+	// A PID file left by a daemon that died isn't signalled.
+	stateDir, err := config.GetStateDir(repoPath)
+	require.NoError(t, err)
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, pidFileName), []byte(fmt.Sprintf("%d", cmd.Process.Pid)), 0644))
+	require.NoError(t, ReloadDaemon(repoPath))
+}
+
+func TestLoadInstancesAfterKill(t *testing.T) {
+	storage, err := session.NewStorage(&memoryStorage{})
+	require.NoError(t, err)
+	var data []session.InstanceData
+	for _, title := range []string{"one", "two"} {
+		data = append(data, session.InstanceData{Title: title, Path: t.TempDir(), Status: session.Paused, Started: true})
+	}
+	require.NoError(t, storage.SaveInstanceData(data))
+
+	instances, err := loadInstances(storage, false)
+	require.NoError(t, err)
+	set := newInstanceSet(instances)
+	require.Len(t, set.instances, 2)
+
+	// cs kill removes "one" from storage and has the daemon reload.
+	require.NoError(t, storage.SaveInstanceData(data[1:]))
+	instances, err = loadInstances(storage, true)
+	require.NoError(t, err)
+	set.replace(instances)
+	require.Len(t, set.instances, 1)
+	require.Equal(t, "two", set.instances[0].Title)
+	require.False(t, set.instances[0].AutoYes)
+}
@@ -3,6 +3,8 @@
 package daemon
 
 import (
+	"errors"
+	"os"
 	"syscall"
 )
 
@@ -12,3 +14,19 @@ func getSysProcAttr() *syscall.SysProcAttr {
 		Setsid: true, // Create a new session
 	}
 }
+
+// processAlive returns true if a process with the given PID exists.
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Signal 0 checks for existence without affecting the process. EPERM means it exists but belongs to someone else.
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// signalReload sends SIGHUP to the daemon process, which makes it reload its instances.
+func signalReload(pid int) error {
+	return syscall.Kill(pid, syscall.SIGHUP)
+}
@@ -3,7 +3,9 @@
 package daemon
 
 import (
+	"errors"
 	"golang.org/x/sys/windows"
+	"os"
 	"syscall"
 )
 
@@ -13,3 +15,19 @@ func getSysProcAttr() *syscall.SysProcAttr {
 		CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.DETACHED_PROCESS,
 	}
 }
+
+// processAlive returns true if a process with the given PID exists.
+func processAlive(pid int) bool {
+	// On Windows, FindProcess opens a handle to the process and fails if it doesn't exist.
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = proc.Release()
+	return true
+}
+
+// signalReload would ask the daemon process to reload its instances, but Windows has no signal for it.
+func signalReload(pid int) error {
+	return errors.New("reloading isn't supported on Windows; restart the daemon with cs daemon stop and cs daemon start")
+}
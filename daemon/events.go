@@ -0,0 +1,161 @@
+package daemon
+
+import (
+	"bufio"
+	"claude-squad/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// eventsFileName is the file in the state directory the daemon appends its events to, one JSON object per line.
+const eventsFileName = "events.jsonl"
+
+// maxEventsFileSize is the size past which the events file is rotated: it's renamed to events.jsonl.1, replacing the
+// previous one, and a new one is started, so a daemon answering prompts for months doesn't fill the disk.
+const maxEventsFileSize = 5 << 20
+
+// Actions of daemon events.
+const (
+	// EventConfirm is recorded when the daemon accepts a prompt for an instance.
+	EventConfirm = "confirm"
+	// EventPause and EventKill are recorded when the daemon pauses or kills an instance for exceeding max_runtime.
+	EventPause = "pause"
+	EventKill  = "kill"
+	// EventError is recorded when one of the above fails.
+	EventError = "error"
+)
+
+// Event is an automated action the daemon took on an instance. Unlike the log, events are kept as a record of what
+// autoyes did, e.g. which prompts it accepted overnight.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"`
+	Action   string    `json:"action"`
+	// Prompt is the prompt marker the daemon matched, for EventConfirm and its errors.
+	Prompt string `json:"prompt,omitempty"`
+	// Error describes what failed, for EventError.
+	Error string `json:"error,omitempty"`
+}
+
+// eventLog appends events to a repository's events file. A nil eventLog drops them.
+type eventLog struct {
+	path string
+	// redactor removes secrets from the errors events carry, which may quote command output.
+	redactor *config.Redactor
+	// maxSize overrides maxEventsFileSize when set, for tests.
+	maxSize int64
+	// prompts holds the action recorded for the prompt each instance is waiting on, so the polls that see the same
+	// prompt again don't record it again. Only the poll loop uses it.
+	prompts map[string]string
+}
+
+// recordPrompt records the daemon's answer to the prompt the instance is waiting on, once per prompt: the polls that
+// see it again before it's gone, e.g. while the agent redraws it, only record a different outcome.
+func (l *eventLog) recordPrompt(event Event) error {
+	if l == nil || l.prompts[event.Instance] == event.Action {
+		return nil
+	}
+	if l.prompts == nil {
+		l.prompts = make(map[string]string)
+	}
+	l.prompts[event.Instance] = event.Action
+	return l.record(event)
+}
+
+// promptGone forgets the instance's prompt once its pane no longer shows one, so the next prompt is recorded.
+func (l *eventLog) promptGone(instance string) {
+	if l != nil {
+		delete(l.prompts, instance)
+	}
+}
+
+// record appends the event, timestamped now. The file is opened for every event so that events survive the daemon
+// being killed.
+func (l *eventLog) record(event Event) error {
+	if l == nil {
+		return nil
+	}
+	event.Time = time.Now()
+	event.Error = l.redactor.Redact(event.Error)
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	f, err := l.open(int64(len(line)) + 1)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return f.Close()
+}
+
+// open opens the events file for appending n more bytes, rotating it first if they would take it past its maximum size.
+func (l *eventLog) open(n int64) (*os.File, error) {
+	maxSize := l.maxSize
+	if maxSize <= 0 {
+		maxSize = maxEventsFileSize
+	}
+	if info, err := os.Stat(l.path); err == nil && info.Size() > 0 && info.Size()+n > maxSize {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return nil, fmt.Errorf("failed to rotate events file: %w", err)
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+	return f, nil
+}
+
+// ReadEvents returns the events the repository's daemon recorded, oldest first, including those in the file the
+// events file was last rotated to. Lines that aren't valid events, e.g. one cut short by the daemon being killed
+// mid-write, are skipped.
+func ReadEvents(repoPath string) ([]Event, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+	path := filepath.Join(stateDir, eventsFileName)
+	events, err := readEventsFile(path + ".1")
+	if err != nil {
+		return nil, err
+	}
+	current, err := readEventsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return append(events, current...), nil
+}
+
+// readEventsFile returns the events in the file, skipping invalid lines. A missing file has no events.
+func readEventsFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events file: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"claude-squad/config"
+	"claude-squad/session"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// heartbeatFileName is touched by the daemon on every poll so its liveness can be checked from outside.
+const heartbeatFileName = "daemon.heartbeat"
+
+// pidFileName holds the PID of the repository's daemon, written by LaunchDaemon.
+const pidFileName = "daemon.pid"
+
+// Status describes the daemon of a repository.
+type Status struct {
+	// Running is true if the daemon process recorded in the PID file is alive.
+	Running bool `json:"running"`
+	// PID is the daemon's process ID from the PID file, or 0 if there is none.
+	PID int `json:"pid"`
+	// Stale is true if a PID file exists but its process is gone, e.g. because the daemon crashed.
+	Stale bool `json:"stale"`
+	// Instances is the number of instances stored for the repository.
+	Instances int `json:"instances"`
+	// UptimeSeconds is how long ago the daemon was launched, if it's running.
+	UptimeSeconds int `json:"uptime_seconds"`
+	// LastHeartbeat is the last time the daemon polled its instances, if it has ever run.
+	LastHeartbeat *time.Time `json:"last_heartbeat"`
+}
+
+// GetStatus reports whether the daemon of a repository is running, based on its PID and heartbeat files.
+func GetStatus(repoPath string) (*Status, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+
+	status := &Status{}
+	pidFile := filepath.Join(stateDir, pidFileName)
+	pid, err := readPIDFile(pidFile)
+	if err != nil && !errors.Is(err, ErrDaemonNotRunning) {
+		return nil, err
+	}
+	if err == nil {
+		status.PID = pid
+		status.Running = processAlive(pid)
+		status.Stale = !status.Running
+		// The PID file is written when the daemon is launched.
+		if info, err := os.Stat(pidFile); err == nil && status.Running {
+			status.UptimeSeconds = int(time.Since(info.ModTime()).Seconds())
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(stateDir, heartbeatFileName)); err == nil {
+		heartbeat := info.ModTime()
+		status.LastHeartbeat = &heartbeat
+	}
+
+	storage, err := session.NewStorage(config.LoadState(repoPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load instances: %w", err)
+	}
+	status.Instances = len(instancesData)
+
+	return status, nil
+}
+
+// touchHeartbeat records that the daemon is alive by updating the heartbeat file's modification time.
+func touchHeartbeat(heartbeatFile string) error {
+	now := time.Now()
+	if err := os.Chtimes(heartbeatFile, now, now); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		return os.WriteFile(heartbeatFile, nil, 0644)
+	}
+	return nil
+}
+
+// StaleFiles returns the PID and heartbeat files of a daemon that is no longer running, which are safe to remove.
+// Returns nil if the daemon is running or left nothing behind.
+func StaleFiles(repoPath string) ([]string, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+
+	pidFile := filepath.Join(stateDir, pidFileName)
+	pid, err := readPIDFile(pidFile)
+	if err != nil && !errors.Is(err, ErrDaemonNotRunning) {
+		return nil, err
+	}
+	if err == nil && processAlive(pid) {
+		return nil, nil
+	}
+
+	var files []string
+	for _, path := range []string{pidFile, filepath.Join(stateDir, heartbeatFileName)} {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// Probe returns nil if the daemon of a repository is running and polled its instances within maxAge.
+func Probe(repoPath string, maxAge time.Duration) error {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get state directory: %w", err)
+	}
+
+	pid, err := readPIDFile(filepath.Join(stateDir, pidFileName))
+	if err != nil {
+		return err
+	}
+	if !processAlive(pid) {
+		return fmt.Errorf("daemon process %d is gone", pid)
+	}
+
+	info, err := os.Stat(filepath.Join(stateDir, heartbeatFileName))
+	if err != nil {
+		return fmt.Errorf("daemon has no heartbeat: %w", err)
+	}
+	if age := time.Since(info.ModTime()); age > maxAge {
+		return fmt.Errorf("daemon heartbeat is %s old", age.Round(time.Second))
+	}
+	return nil
+}
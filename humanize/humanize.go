@@ -0,0 +1,63 @@
+// Package humanize formats times and text for people reading cs output.
+package humanize
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// AbsoluteLayout is the layout of exact times in human-readable output. Machine-readable output uses RFC3339.
+const AbsoluteLayout = "2006-01-02 15:04:05"
+
+// Ago formats how long before now t was, in its largest whole unit: "just now", "42s ago", "5m ago", "3h ago",
+// "2d ago", "6w ago" or "1y ago". Times after now, e.g. from a skewed clock, count as just now. The zero time
+// formats as "-".
+func Ago(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return Since(now.Sub(t))
+}
+
+// Since formats a duration that has passed the way Ago does.
+func Since(d time.Duration) string {
+	const (
+		day  = 24 * time.Hour
+		week = 7 * day
+		year = 365 * day
+	)
+	switch {
+	case d < time.Second:
+		return "just now"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", d/time.Second)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", d/time.Minute)
+	case d < day:
+		return fmt.Sprintf("%dh ago", d/time.Hour)
+	case d < 2*week:
+		return fmt.Sprintf("%dd ago", d/day)
+	case d < year:
+		return fmt.Sprintf("%dw ago", d/week)
+	default:
+		return fmt.Sprintf("%dy ago", d/year)
+	}
+}
+
+// Time formats t relative to now like Ago, or as a local AbsoluteLayout time if absolute is set.
+func Time(t, now time.Time, absolute bool) string {
+	if !absolute || t.IsZero() {
+		return Ago(t, now)
+	}
+	return t.Local().Format(AbsoluteLayout)
+}
+
+// escapeRegex matches terminal escape sequences: CSI sequences such as colors, OSC sequences such as hyperlinks
+// and window titles, and the short escapes such as charset switches.
+var escapeRegex = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[ -/]*[0-~])`)
+
+// StripEscapes removes the terminal escape sequences from s, e.g. the colors of a program's output, for --plain.
+func StripEscapes(s string) string {
+	return escapeRegex.ReplaceAllString(s, "")
+}
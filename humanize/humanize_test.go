@@ -0,0 +1,58 @@
+package humanize
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgo(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{-time.Hour, "just now"},
+		{0, "just now"},
+		{999 * time.Millisecond, "just now"},
+		{5 * time.Second, "5s ago"},
+		{42 * time.Second, "42s ago"},
+		{5*time.Minute + 59*time.Second, "5m ago"},
+		{3 * time.Hour, "3h ago"},
+		{47 * time.Hour, "1d ago"},
+		{13 * 24 * time.Hour, "13d ago"},
+		{45 * 24 * time.Hour, "6w ago"},
+		{800 * 24 * time.Hour, "2y ago"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Ago(now.Add(-tt.ago), now), "%v ago", tt.ago)
+	}
+	assert.Equal(t, "-", Ago(time.Time{}, now))
+}
+
+func TestTime(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+	created := now.Add(-3 * time.Hour)
+	assert.Equal(t, "3h ago", Time(created, now, false))
+	assert.Equal(t, "2025-06-01 09:00:00", Time(created, now, true))
+	assert.Equal(t, "-", Time(time.Time{}, now, true))
+}
+
+func TestStripEscapes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain text\n", "plain text\n"},
+		{"\x1b[31m-removed\x1b[m\n\x1b[1;32m+added\x1b[0m", "-removed\n+added"},
+		{"\x1b[38;2;255;0;0mred\x1b[39m", "red"},
+		{"\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"\x1b]0;title\x07text", "text"},
+		{"\x1b[?25lhidden cursor\x1b[?25h", "hidden cursor"},
+		{"\x1b(Bascii", "ascii"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, StripEscapes(tt.in), "%q", tt.in)
+	}
+}
@@ -24,6 +24,8 @@ const (
 	KeyResume
 	KeyPrompt // New key for entering a prompt
 	KeyHelp   // Key for showing help screen
+	KeyAutoYes
+	KeyAgent
 
 	// Diff keybindings
 	KeyShiftUp
@@ -49,6 +51,8 @@ var GlobalKeyStringsMap = map[string]KeyName{
 	"r":          KeyResume,
 	"p":          KeySubmit,
 	"?":          KeyHelp,
+	"a":          KeyAutoYes,
+	"g":          KeyAgent,
 }
 
 // GlobalkeyBindings is a global, immutable map of KeyName tot keybinding.
@@ -109,6 +113,14 @@ var GlobalkeyBindings = map[KeyName]key.Binding{
 		key.WithKeys("r"),
 		key.WithHelp("r", "resume"),
 	),
+	KeyAutoYes: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "toggle autoyes"),
+	),
+	KeyAgent: key.NewBinding(
+		key.WithKeys("g"),
+		key.WithHelp("g", "cycle agent"),
+	),
 
 	// -- Special keybindings --
 
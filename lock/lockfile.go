@@ -4,21 +4,58 @@ package lock
 
 import (
 	"claude-squad/config"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
-// Lock represents an exclusive lock on a repository
+// LockHeldError is returned by AcquireLock and AcquireInstanceLock when another process holds the lock.
+type LockHeldError struct {
+	// PID of the process holding the lock, or 0 if it couldn't be read from the lock file.
+	PID int
+	// Instance is the title of the locked instance, or empty for the repository lock.
+	Instance string
+	// Daemon is true for the lock held while launching the repository's daemon.
+	Daemon bool
+	// Err is the underlying error from the platform lock call.
+	Err error
+}
+
+func (e *LockHeldError) Error() string {
+	if e.Daemon {
+		if e.PID > 0 {
+			return fmt.Sprintf("another cs process (PID %d) is launching the daemon of this repo", e.PID)
+		}
+		return fmt.Sprintf("failed to lock daemon launch: %v", e.Err)
+	}
+	if e.Instance != "" {
+		if e.PID > 0 {
+			return fmt.Sprintf("instance '%s' is in use by another cs process (PID %d)", e.Instance, e.PID)
+		}
+		return fmt.Sprintf("failed to lock instance '%s': %v", e.Instance, e.Err)
+	}
+	if e.PID > 0 {
+		return fmt.Sprintf("another cs instance is running in this repo (PID %d)", e.PID)
+	}
+	return fmt.Sprintf("failed to acquire lock: %v", e.Err)
+}
+
+func (e *LockHeldError) Unwrap() error {
+	return e.Err
+}
+
+// Lock represents an exclusive lock on a repository or one of its instances
 type Lock struct {
 	file     *os.File
 	filePath string
 }
 
 // AcquireLock attempts to acquire an exclusive lock for the given repository.
-// Returns an error if another process holds the lock.
+// Returns a *LockHeldError if another process holds the lock.
 func AcquireLock(repoPath string) (*Lock, error) {
 	// Get the state directory for this repo
 	stateDir, err := config.GetStateDir(repoPath)
@@ -27,7 +64,59 @@ func AcquireLock(repoPath string) (*Lock, error) {
 	}
 
 	lockPath := filepath.Join(stateDir, "cs.lock")
+	return acquireLockFile(lockPath, "")
+}
 
+// AcquireInstanceLock attempts to acquire an exclusive lock on a single instance of the repository, so that
+// processes can manage different instances concurrently but not the same one. Returns a *LockHeldError if another
+// process holds the instance's lock.
+func AcquireInstanceLock(repoPath string, title string) (*Lock, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+
+	locksDir := filepath.Join(stateDir, instanceLocksDirName)
+	if err := os.MkdirAll(locksDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create instance locks directory: %w", err)
+	}
+
+	lockPath := filepath.Join(locksDir, sanitizeLockName(title)+".lock")
+	return acquireLockFile(lockPath, title)
+}
+
+// AcquireDaemonLock attempts to acquire the lock guarding the launch of the repository's daemon, so that two
+// processes can't both launch one. It's separate from the repository lock, which the launching process may hold.
+// Returns a *LockHeldError if another process holds the lock.
+func AcquireDaemonLock(repoPath string) (*Lock, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+
+	l, err := acquireLockFile(filepath.Join(stateDir, "daemon.lock"), "")
+	var held *LockHeldError
+	if errors.As(err, &held) {
+		held.Daemon = true
+	}
+	return l, err
+}
+
+// instanceLocksDirName is the directory in the state directory holding the per-instance lock files.
+const instanceLocksDirName = "locks"
+
+// unsafeLockNameChars matches characters that aren't safe in a lock file name.
+var unsafeLockNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// sanitizeLockName turns an instance title into a file name. Titles that only differ in unsafe characters share
+// a lock, which errs on the side of locking too much.
+func sanitizeLockName(title string) string {
+	return unsafeLockNameChars.ReplaceAllString(title, "_")
+}
+
+// acquireLockFile locks the file at lockPath, creating it if needed, and writes our PID to it. instance is the
+// title reported in a *LockHeldError, or empty for the repository lock.
+func acquireLockFile(lockPath string, instance string) (*Lock, error) {
 	// Open or create the lock file
 	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
@@ -39,11 +128,7 @@ func AcquireLock(repoPath string) (*Lock, error) {
 		file.Close()
 
 		// Try to read existing PID for better error message
-		existingPID := readPIDFromLockFile(lockPath)
-		if existingPID != "" {
-			return nil, fmt.Errorf("another cs instance is running in this repo (PID %s)", existingPID)
-		}
-		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+		return nil, &LockHeldError{PID: readPIDFromLockFile(lockPath), Instance: instance, Err: err}
 	}
 
 	// Write our PID to the lock file
@@ -67,13 +152,20 @@ func (l *Lock) Release() error {
 		return nil
 	}
 
+	// Unlock explicitly where closing alone doesn't release the lock promptly
+	if err := releaseLockPlatform(l.file); err != nil {
+		l.file.Close()
+		l.file = nil
+		return err
+	}
+
 	// Close the file (this releases the flock automatically on Unix)
 	if err := l.file.Close(); err != nil {
 		return fmt.Errorf("failed to close lock file: %w", err)
 	}
 
 	// Remove the lock file
-	if err := os.Remove(l.filePath); err != nil && !os.IsNotExist(err) {
+	if err := removeLockFile(l.filePath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove lock file: %w", err)
 	}
 
@@ -81,18 +173,52 @@ func (l *Lock) Release() error {
 	return nil
 }
 
-// readPIDFromLockFile attempts to read a PID from the lock file for error reporting
-func readPIDFromLockFile(lockPath string) string {
+// readPIDFromLockFile attempts to read a PID from the lock file for error reporting. Returns 0 if it can't.
+func readPIDFromLockFile(lockPath string) int {
 	data, err := os.ReadFile(lockPath)
 	if err != nil {
-		return ""
+		return 0
 	}
 
-	pidStr := strings.TrimSpace(string(data))
 	// Validate it's a number
-	if _, err := strconv.Atoi(pidStr); err != nil {
-		return ""
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+
+	return pid
+}
+
+// StaleInstanceLocks returns the instance lock files that no process holds, e.g. because a cs process crashed.
+func StaleInstanceLocks(repoPath string) ([]string, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
 	}
 
-	return pidStr
+	entries, err := os.ReadDir(filepath.Join(stateDir, instanceLocksDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read instance locks directory: %w", err)
+	}
+
+	var stale []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".lock" {
+			continue
+		}
+		lockPath := filepath.Join(stateDir, instanceLocksDirName, entry.Name())
+		file, err := os.OpenFile(lockPath, os.O_RDWR, 0644)
+		if err != nil {
+			continue
+		}
+		// Closing the file releases the lock if we got it, without removing the file like Release does.
+		if acquireLockPlatform(file) == nil {
+			stale = append(stale, lockPath)
+		}
+		file.Close()
+	}
+	return stale, nil
 }
@@ -20,3 +20,13 @@ func acquireLockPlatform(file *os.File) error {
 	}
 	return nil
 }
+
+// releaseLockPlatform is a no-op on Unix: closing the file releases the flock.
+func releaseLockPlatform(file *os.File) error {
+	return nil
+}
+
+// removeLockFile removes the lock file once it's been closed.
+func removeLockFile(lockPath string) error {
+	return os.Remove(lockPath)
+}
@@ -3,10 +3,10 @@
 package lock
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"syscall"
-	"unsafe"
+	"time"
 
 	"golang.org/x/sys/windows"
 )
@@ -18,7 +18,7 @@ func acquireLockPlatform(file *os.File) error {
 	handle := windows.Handle(file.Fd())
 
 	// Create an overlapped structure (required for LockFileEx)
-	var overlapped syscall.Overlapped
+	var overlapped windows.Overlapped
 
 	// Flags:
 	// LOCKFILE_EXCLUSIVE_LOCK = exclusive lock (not shared)
@@ -48,3 +48,41 @@ func acquireLockPlatform(file *os.File) error {
 
 // Note: The lock is automatically released when the file handle is closed
 // or when the process terminates, similar to Unix flock behavior.
+
+// releaseLockPlatform unlocks the file explicitly before it's closed, so that the lock doesn't linger until
+// Windows gets around to releasing it with the handle.
+func releaseLockPlatform(file *os.File) error {
+	var overlapped windows.Overlapped
+	if err := windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &overlapped); err != nil {
+		return fmt.Errorf("failed to unlock lock file: %w", err)
+	}
+	return nil
+}
+
+// removeLockFileAttempts and removeLockFileDelay bound how long removeLockFile retries.
+const (
+	removeLockFileAttempts = 10
+	removeLockFileDelay    = 20 * time.Millisecond
+)
+
+// removeLockFile removes the lock file once it's been closed. Windows can refuse to delete a file whose handle
+// was just closed, or that another process (e.g. an antivirus scanner) briefly has open, so sharing violations
+// are retried for a short while instead of leaving a stale lock file behind.
+func removeLockFile(lockPath string) error {
+	var err error
+	for attempt := 0; attempt < removeLockFileAttempts; attempt++ {
+		err = os.Remove(lockPath)
+		if err == nil || os.IsNotExist(err) || !isSharingViolation(err) {
+			return err
+		}
+		time.Sleep(removeLockFileDelay)
+	}
+	return err
+}
+
+// isSharingViolation reports whether err means the file is in use by another handle.
+func isSharingViolation(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) ||
+		errors.Is(err, windows.ERROR_LOCK_VIOLATION) ||
+		errors.Is(err, windows.ERROR_ACCESS_DENIED)
+}
@@ -0,0 +1,44 @@
+//go:build windows
+
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveLockFileRetriesWhileInUse(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "cs.lock")
+	require.NoError(t, os.WriteFile(lockPath, []byte("1\n"), 0644))
+
+	// os.Open doesn't share delete access, so removing the file fails until it's closed.
+	file, err := os.Open(lockPath)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(removeLockFileDelay * 2)
+		file.Close()
+	}()
+
+	require.NoError(t, removeLockFile(lockPath))
+	_, err = os.Stat(lockPath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestReleaseRemovesLockFile(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "cs.lock")
+	l, err := acquireLockFile(lockPath, "")
+	require.NoError(t, err)
+	require.NoError(t, l.Release())
+
+	_, err = os.Stat(lockPath)
+	require.True(t, os.IsNotExist(err))
+
+	// The lock can be taken again straight away.
+	l, err = acquireLockFile(lockPath, "")
+	require.NoError(t, err)
+	require.NoError(t, l.Release())
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,14 @@ var logFileName = filepath.Join(os.TempDir(), "claudesquad.log")
 
 var globalLogFile *os.File
 
+// quiet stops Close from printing where the logs went.
+var quiet bool
+
+// SetQuiet sets whether Close prints where the logs went, e.g. for --quiet.
+func SetQuiet(q bool) {
+	quiet = q
+}
+
 // Initialize should be called once at the beginning of the program to set up logging.
 // defer Close() after calling this function. It sets the go log output to the file in
 // the os temp directory.
@@ -44,8 +53,11 @@ func Initialize(daemon bool) {
 
 func Close() {
 	_ = globalLogFile.Close()
-	// TODO: maybe only print if verbose flag is set?
-	fmt.Println("wrote logs to " + logFileName)
+	if quiet {
+		return
+	}
+	// Print to stderr so the notice doesn't end up in output meant for scripts, e.g. JSON or paths.
+	fmt.Fprintln(os.Stderr, "wrote logs to "+logFileName)
 }
 
 // Every is used to log at most once every timeout duration.
@@ -74,3 +86,28 @@ func (e *Every) ShouldLog() bool {
 		return false
 	}
 }
+
+// FilePath returns the path of the log file.
+func FilePath() string {
+	return logFileName
+}
+
+// lineTimeLayout is the timestamp layout the loggers write after the level prefix (log.Ldate|log.Ltime).
+const lineTimeLayout = "2006/01/02 15:04:05"
+
+// ParseLineTime returns the time a log line was written, parsed from its timestamp. Returns false for lines without
+// one, such as the continuation lines of a multi-line message.
+func ParseLineTime(line string) (time.Time, bool) {
+	line = strings.TrimPrefix(line, "[DAEMON] ")
+	for _, prefix := range []string{"INFO:", "WARNING:", "ERROR:"} {
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			if len(rest) < len(lineTimeLayout) {
+				return time.Time{}, false
+			}
+			// The log package writes local time.
+			t, err := time.ParseInLocation(lineTimeLayout, rest[:len(lineTimeLayout)], time.Local)
+			return t, err == nil
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,25 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLineTime(t *testing.T) {
+	want := time.Date(2026, 10, 15, 8, 41, 46, 0, time.Local)
+	for _, line := range []string{
+		"ERROR:2026/10/15 08:41:46 storage.go:118: failed to repair instances",
+		"[DAEMON] INFO:2026/10/15 08:41:46 daemon.go:24: starting daemon",
+	} {
+		got, ok := ParseLineTime(line)
+		require.True(t, ok, line)
+		require.True(t, want.Equal(got), line)
+	}
+
+	for _, line := range []string{"", "  continuation of a message", "INFO:garbage"} {
+		_, ok := ParseLineTime(line)
+		require.False(t, ok, line)
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"claude-squad/app"
 	cmd2 "claude-squad/cmd"
 	"claude-squad/config"
 	"claude-squad/daemon"
+	"claude-squad/humanize"
 	"claude-squad/lock"
 	"claude-squad/log"
 	"claude-squad/session"
@@ -12,24 +14,92 @@ import (
 	"claude-squad/session/tmux"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
 
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
-	version         = "1.0.13"
-	programFlag     string
-	autoYesFlag     bool
-	daemonFlag      bool
-	repoPathFlag    string
-	cleanupKillAll  bool
-	rootCmd      = &cobra.Command{
+	version              = "1.0.13"
+	programFlag          string
+	autoYesFlag          bool
+	daemonFlag           bool
+	noDaemonFlag         bool
+	repoPathFlag         string
+	repoFlag             string
+	configFlag           string
+	plainFlag            bool
+	quietFlag            bool
+	cleanupKillAll       bool
+	cleanupRepo          bool
+	cleanupJSON          bool
+	cleanupFailOnOrphans bool
+	daemonStatusJSON     bool
+	daemonStatusAbsolute bool
+	daemonProbeAge       time.Duration
+	daemonMonitor        bool
+	gcYes                bool
+	syncArchive          bool
+	syncNoFetch          bool
+	logsSince            string
+	logsLines            int
+	logsFull             bool
+	eventsInstance       string
+	eventsAction         string
+	eventsSince          string
+	eventsJSON           bool
+	listJSONFlag         bool
+	listAllFlag          bool
+	listAbsoluteFlag     bool
+	listNotesFlag        bool
+	reposPrune           bool
+	noteClear            bool
+	labelClear           bool
+	newTitleFlag         string
+	newBaseFlag          string
+	newSubdirFlag        string
+	newDiffBaseFlag      string
+	newSeedFlag          string
+	newAgentFlag         string
+	newWindowNameFlag    string
+	newLabelFlags        []string
+	newEnvFlags          []string
+	newDryRunFlag        bool
+	cloneTitleFlag       string
+	cloneBaseFlag        string
+	cloneDryRunFlag      bool
+	adoptTitle           string
+	adoptAll             bool
+	compareStatFlag      bool
+	compareMergeBaseFlag bool
+	killAllPaused        bool
+	killKeepBranch       bool
+	killYes              bool
+	killIncludePinned    bool
+	wherePathOnly        bool
+	whereJSON            bool
+	resetIncludePinned   bool
+	cleanupIncludePinned bool
+	repairRecreate       bool
+	squashMessage        string
+	execParallel         int
+	execLabels           []string
+	fetchRebase          bool
+	rootCmd              = &cobra.Command{
 		Use:   "claude-squad",
 		Short: "Claude Squad - Manage multiple AI agents like Claude Code, Aider, Codex, and Amp.",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -43,86 +113,70 @@ var (
 					return fmt.Errorf("--repo-path is required in daemon mode")
 				}
 				cfg := config.LoadConfig()
-				err := daemon.RunDaemon(cfg, repoPathFlag)
+				err := daemon.RunDaemon(cfg, repoPathFlag, daemonMonitor)
 				log.ErrorLog.Printf("failed to start daemon %v", err)
 				return err
 			}
 
-			// Check if we're in a git repository
-			currentDir, err := filepath.Abs(".")
+			// Check if we're in a git repository and get its canonical path (resolves symlinks)
+			repoPath, err := getRepoPath()
 			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			if !git.IsGitRepo(currentDir) {
-				return fmt.Errorf("error: claude-squad must be run from within a git repository")
-			}
-
-			// Get canonical repo path (resolves symlinks)
-			repoPath, err := config.GetCanonicalRepoPath(currentDir)
-			if err != nil {
-				return fmt.Errorf("failed to get canonical repo path: %w", err)
+				return err
 			}
 
-			// Acquire exclusive lock for this repository
-			lock, err := lock.AcquireLock(repoPath)
-			if err != nil {
+			if err := cmd2.CheckTmux(); err != nil {
 				return err
 			}
-			defer func() {
-				if err := lock.Release(); err != nil {
-					log.ErrorLog.Printf("failed to release lock: %v", err)
+			if v, err := tmux.InstalledVersion(); err == nil {
+				for _, f := range v.MissingFeatures() {
+					log.WarningLog.Printf("tmux %s lacks %s, which needs tmux %s or later", v, f.Name, f.Since)
 				}
-			}()
+			}
 
-			cfg := config.LoadConfig()
+			// Acquire exclusive lock for this repository
+			return withRepoLock(repoPath, func() error {
+				cfg := config.LoadConfig()
 
-			// Program flag overrides config
-			program := cfg.DefaultProgram
-			if programFlag != "" {
-				program = programFlag
-			}
-			// AutoYes flag overrides config
-			autoYes := cfg.AutoYes
-			if autoYesFlag {
-				autoYes = true
-			}
-			if autoYes {
-				defer func() {
-					if err := daemon.LaunchDaemon(repoPath); err != nil {
-						log.ErrorLog.Printf("failed to launch daemon: %v", err)
-					}
-				}()
-			}
-			// Kill any daemon that's running for this repo
-			if err := daemon.StopDaemon(repoPath); err != nil {
-				log.ErrorLog.Printf("failed to stop daemon: %v", err)
-			}
+				// Program flag overrides the repository's config, which overrides the global one
+				program := config.ResolveProgram(programFlag, repoPath, cfg)
+				// AutoYes flag overrides config
+				autoYes := cfg.AutoYes
+				if autoYesFlag {
+					autoYes = true
+				}
+				// --no-daemon keeps autoyes for the foreground run but doesn't leave a daemon behind on exit. Without
+				// autoyes, keep_daemon_on_exit leaves a monitor daemon behind instead.
+				if (autoYes || cfg.KeepDaemonOnExit) && !noDaemonFlag {
+					monitor := !autoYes
+					defer func() {
+						if err := daemon.LaunchDaemon(repoPath, monitor); err != nil {
+							log.ErrorLog.Printf("failed to launch daemon: %v", err)
+						}
+					}()
+				}
+				// Kill any daemon that's running for this repo
+				if err := daemon.StopDaemon(repoPath); err != nil {
+					log.ErrorLog.Printf("failed to stop daemon: %v", err)
+				}
 
-			return app.Run(ctx, program, autoYes, repoPath)
+				return app.Run(ctx, program, autoYes, repoPath)
+			})
 		},
 	}
 
 	resetCmd = &cobra.Command{
 		Use:   "reset",
 		Short: "Reset all stored instances for the current repository",
+		Long: `Forget all stored instances of the current repository and kill their tmux sessions and
+worktrees. Pinned instances are kept, with their sessions and worktrees, unless
+--include-pinned is passed.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log.Initialize(false)
 			defer log.Close()
 
-			// Get current directory and repo path
-			currentDir, err := filepath.Abs(".")
-			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			if !git.IsGitRepo(currentDir) {
-				return fmt.Errorf("error: must be run from within a git repository")
-			}
-
-			repoPath, err := config.GetCanonicalRepoPath(currentDir)
+			repoPath, err := getRepoPath()
 			if err != nil {
-				return fmt.Errorf("failed to get canonical repo path: %w", err)
+				return err
 			}
 
 			// Load and reset state for this repo
@@ -131,10 +185,35 @@ var (
 			if err != nil {
 				return fmt.Errorf("failed to initialize storage: %w", err)
 			}
-			if err := storage.DeleteAllInstances(); err != nil {
+			if config.SafeModeEnabled() {
+				instancesData, err := storage.LoadInstanceData()
+				if err != nil {
+					return fmt.Errorf("failed to load instances: %w", err)
+				}
+				infoln("cs reset would forget these instances, kill their tmux sessions and remove their worktrees:")
+				for _, data := range instancesData {
+					if !data.Pinned || resetIncludePinned {
+						infof("  - %s (branch %s)\n", data.Title, data.Branch)
+					}
+				}
+				return safeModeNoop("nothing was reset")
+			}
+			pinned, err := storage.DeleteAllInstances(resetIncludePinned)
+			if err != nil {
 				return fmt.Errorf("failed to reset storage: %w", err)
 			}
-			fmt.Println("Storage has been reset successfully")
+			infoln("Storage has been reset successfully")
+			var keepSessions, keepWorktrees []string
+			for _, data := range pinned {
+				infof("Kept pinned instance '%s'\n", data.Title)
+				keepSessions = append(keepSessions, tmux.NewTmuxSession(data.Title, data.Program, data.Path).Name())
+				keepWorktrees = append(keepWorktrees, data.Worktree.WorktreePath)
+			}
+			if len(pinned) == 0 {
+				if err := config.UnregisterRepo(repoPath); err != nil {
+					log.WarningLog.Printf("failed to unregister repo: %v", err)
+				}
+			}
 
 			// Get repo hash for cleanup
 			repoHash, err := config.GetRepoHash(repoPath)
@@ -143,22 +222,36 @@ var (
 			}
 
 			// Cleanup tmux sessions for this repo only
-			if err := tmux.CleanupSessionsByPrefix(cmd2.MakeExecutor(), tmux.TmuxPrefix+repoHash); err != nil {
+			killProgress := func(current, total int, name string) {
+				infof("Killing session %d/%d: %s\n", current, total, name)
+			}
+			if err := tmux.CleanupSessionsByPrefix(cmd2.MakeExecutor(), tmux.TmuxPrefix+repoHash, keepSessions,
+				killProgress); err != nil {
 				return fmt.Errorf("failed to cleanup tmux sessions: %w", err)
 			}
-			fmt.Println("Tmux sessions have been cleaned up")
+			infoln("Tmux sessions have been cleaned up")
 
 			// Cleanup worktrees for this repo
-			if err := git.CleanupWorktrees(repoPath); err != nil {
+			removeProgress := func(done, total int, name string) {
+				infof("Removed worktree %d/%d: %s\n", done, total, name)
+			}
+			if err := git.CleanupWorktrees(repoPath, keepWorktrees, removeProgress); err != nil {
 				return fmt.Errorf("failed to cleanup worktrees: %w", err)
 			}
-			fmt.Println("Worktrees have been cleaned up")
+			infoln("Worktrees have been cleaned up")
+
+			// The daemon keeps running for the pinned instances, but has to forget the others.
+			if len(pinned) > 0 {
+				reloadDaemon(repoPath)
+				infoln("daemon has been reloaded")
+				return nil
+			}
 
 			// Kill daemon for this repo
 			if err := daemon.StopDaemon(repoPath); err != nil {
 				return err
 			}
-			fmt.Println("daemon has been stopped")
+			infoln("daemon has been stopped")
 
 			return nil
 		},
@@ -173,18 +266,253 @@ var (
 
 			cfg := config.LoadConfig()
 
-			configDir, err := config.GetConfigDir()
+			configPath, err := config.GetConfigPath()
 			if err != nil {
-				return fmt.Errorf("failed to get config directory: %w", err)
+				return err
 			}
 			configJson, _ := json.MarshalIndent(cfg, "", "  ")
 
-			fmt.Printf("Config: %s\n%s\n", filepath.Join(configDir, config.ConfigFileName), configJson)
+			fmt.Printf("Config: %s\n%s\n", configPath, configJson)
+
+			if v, err := tmux.InstalledVersion(); err != nil {
+				fmt.Printf("tmux: %v\n", err)
+			} else {
+				fmt.Printf("tmux: %s\n", v)
+				for _, f := range v.MissingFeatures() {
+					fmt.Printf("  lacks %s, which needs tmux %s or later\n", f.Name, f.Since)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	selftestCmd = &cobra.Command{
+		Use:   "selftest",
+		Short: "Check that tmux, git and locking work together by running a throwaway instance",
+		Long: `Create an instance in a temporary git repository and take it through its life: lock the
+repository, start the instance, check its tmux session and worktree, save it, reload it (which
+reattaches to its session), change a file and check the diff stats, then kill it and check that its
+session and worktree are gone. Each step is reported as ok, FAIL or skip (after a failure), and
+everything is torn down at the end. Exits non-zero if a step failed.
+
+Unlike cs debug, which only prints the configuration, this exercises the installation end to end.
+The instance runs sh, so no agent is started.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			return runSelftest()
+		},
+	}
+
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Inspect or edit the claude-squad configuration",
+	}
+
+	configSchemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "Print a JSON Schema describing the config file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			schema, err := json.MarshalIndent(config.Schema(), "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal config schema: %w", err)
+			}
+			fmt.Println(string(schema))
+			return nil
+		},
+	}
+
+	configEditCmd = &cobra.Command{
+		Use:   "edit",
+		Short: "Open the config file in your editor",
+		Long: `Open the config file in the editor configured in it, or $EDITOR, creating the file with the
+default config if it doesn't exist. The edited file is validated when the editor exits; if it's
+invalid, you can edit it again or discard the changes. If no editor is set, the config file's
+path is printed instead.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			configPath, err := config.GetConfigPath()
+			if err != nil {
+				return err
+			}
+			original, err := os.ReadFile(configPath)
+			if os.IsNotExist(err) {
+				if err := config.SaveConfig(config.DefaultConfig()); err != nil {
+					return fmt.Errorf("failed to create config file: %w", err)
+				}
+				original, err = os.ReadFile(configPath)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read config file: %w", err)
+			}
+
+			editor := editorCommand()
+			editorArgs := strings.Fields(editor)
+			if len(editorArgs) == 0 {
+				fmt.Printf("No editor configured (set $EDITOR or \"editor\" in the config). Config file: %s\n", configPath)
+				return nil
+			}
+
+			stdin := bufio.NewReader(os.Stdin)
+			for {
+				editorCmd := exec.Command(editorArgs[0], append(editorArgs[1:], configPath)...)
+				editorCmd.Stdin = os.Stdin
+				editorCmd.Stdout = os.Stdout
+				editorCmd.Stderr = os.Stderr
+				if err := editorCmd.Run(); err != nil {
+					return fmt.Errorf("failed to run %s: %w", editor, err)
+				}
+
+				edited, err := os.ReadFile(configPath)
+				if err != nil {
+					return fmt.Errorf("failed to read config file: %w", err)
+				}
+				validateErr := config.ValidateConfig(edited)
+				if validateErr == nil {
+					return nil
+				}
+
+				fmt.Fprintln(os.Stderr, validateErr)
+				fmt.Fprint(os.Stderr, "Edit it again? Otherwise the changes are discarded. [Y/n]: ")
+				// EOF, e.g. from stdin not being a terminal, can't say yes, and would otherwise ask forever.
+				response, err := stdin.ReadString('\n')
+				if err != nil {
+					fmt.Fprintln(os.Stderr)
+				}
+				if response = strings.TrimSpace(response); err != nil || response == "n" || response == "N" {
+					if err := os.WriteFile(configPath, original, 0644); err != nil {
+						return fmt.Errorf("failed to restore config file: %w", err)
+					}
+					fmt.Println("Changes discarded")
+					return nil
+				}
+			}
+		},
+	}
+
+	daemonCmd = &cobra.Command{
+		Use:   "daemon",
+		Short: "Manage the daemon of the current repository",
+	}
+
+	daemonStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Report whether the autoyes daemon is running",
+		Long: `Report whether the autoyes daemon of the current repository is running.
+
+Exits with an error when the daemon is expected but not running: its PID file
+points at a dead process, or autoyes is enabled in the config and no cs is
+running in the repository.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			status, err := daemon.GetStatus(repoPath)
+			if err != nil {
+				return err
+			}
+
+			if daemonStatusJSON {
+				out, err := json.MarshalIndent(status, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal daemon status: %w", err)
+				}
+				fmt.Println(string(out))
+			} else {
+				printDaemonStatus(status, daemonStatusAbsolute)
+			}
+
+			if status.Running {
+				return nil
+			}
+			// The TUI stops the daemon while it runs and relaunches it on exit.
+			cfg := config.LoadConfig()
+			if status.Stale || ((cfg.AutoYes || cfg.KeepDaemonOnExit) && !repoLocked(repoPath)) {
+				return fmt.Errorf("daemon is expected to be running but isn't")
+			}
+			return nil
+		},
+	}
+
+	daemonStartCmd = &cobra.Command{
+		Use:   "start",
+		Short: "Start the daemon for the current repository in the background",
+		Long: `Start the daemon for the current repository in the background. By default it runs autoyes
+on the instances. With --monitor, it only tracks their diff stats and never accepts prompts.
+
+Starting cs in the repository stops the daemon.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+			if err := daemon.LaunchDaemon(repoPath, daemonMonitor); err != nil {
+				return err
+			}
+			infoln("daemon has been started")
+			return nil
+		},
+	}
+
+	daemonStopCmd = &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the daemon of the current repository",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
 
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+			if err := daemon.StopDaemon(repoPath); err != nil {
+				return err
+			}
+			infoln("daemon has been stopped")
 			return nil
 		},
 	}
 
+	daemonProbeCmd = &cobra.Command{
+		Use:   "probe",
+		Short: "Exit non-zero unless the autoyes daemon is alive, for health checks",
+		Long: `Check that the autoyes daemon of the current repository is running and has polled its
+instances recently. Prints nothing and exits 0 when healthy; otherwise prints the reason to
+stderr and exits 1. Meant for container liveness and readiness probes.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// A healthy probe prints nothing, not even where the logs went.
+			log.SetQuiet(true)
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+			return daemon.Probe(repoPath, daemonProbeAge)
+		},
+	}
+
 	versionCmd = &cobra.Command{
 		Use:   "version",
 		Short: "Print the version number of claude-squad",
@@ -194,59 +522,2595 @@ var (
 		},
 	}
 
-	cleanupCmd = &cobra.Command{
-		Use:   "cleanup",
-		Short: "List or clean up claude-squad tmux sessions",
-		Long: `List all claude-squad tmux sessions, or clean up orphaned sessions.
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the instances of the current repository with their diff stats",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
 
-Usage:
-  cs cleanup              List all sessions (default)
-  cs cleanup --kill-all   Kill all claude-squad sessions without prompting
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
 
-Orphaned sessions occur when:
-- A repository is deleted but tmux sessions remain
-- .claude-squad/ directory is removed manually
-- Sessions are left after repository moves`,
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+			instancesData, err := storage.LoadInstanceData()
+			if err != nil {
+				return fmt.Errorf("failed to load instances: %w", err)
+			}
+
+			live := session.LiveSessions()
+			summaries := make([]session.InstanceSummary, 0, len(instancesData))
+			for _, data := range instancesData {
+				if data.Archived && !listAllFlag {
+					continue
+				}
+				summaries = append(summaries, session.Summarize(data, live))
+			}
+
+			if listJSONFlag {
+				out, err := json.MarshalIndent(summaries, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal instances: %w", err)
+				}
+				fmt.Println(string(out))
+				return nil
+			}
+
+			printInstanceSummaries(summaries, listNotesFlag, listAbsoluteFlag)
+			if max := config.LoadConfig().MaxInstances; max > 0 {
+				// Warn once 80% of the limit is used, so runaway creation is noticed before it fails.
+				if active := session.CountActive(instancesData); active*5 >= max*4 {
+					fmt.Printf("\nWarning: %d of max_instances %d are active\n", active, max)
+				}
+			}
+			return nil
+		},
+	}
+
+	newCmd = &cobra.Command{
+		Use:   "new",
+		Short: "Create an instance without entering the TUI",
+		Long: `Create an instance in a new worktree and start its program in a detached tmux session.
+
+The agent keeps running after the command exits. Attach to it by running cs.
+
+--dry-run prints the branch, worktree, tmux session and program the instance would get,
+without creating anything. The worktree's name ends in a timestamp, which will differ.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log.Initialize(false)
 			defer log.Close()
 
-			if cleanupKillAll {
-				return killAllClaudeSquadSessions()
+			if newTitleFlag == "" {
+				return fmt.Errorf("--title is required")
 			}
 
-			// Default: list sessions and check for orphans
-			return cleanupOrphanedSessions()
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			switch newDiffBaseFlag {
+			case "", config.DiffBaseCommit, config.DiffBaseMergeBase, config.DiffBaseLastCommit, config.DiffBaseCommitted:
+			default:
+				return fmt.Errorf("invalid --diff-base %q", newDiffBaseFlag)
+			}
+			if newAgentFlag != "" {
+				if _, err := tmux.LookupAgent(newAgentFlag); err != nil {
+					return fmt.Errorf("invalid --agent: %w", err)
+				}
+			}
+
+			labels, err := parseLabels(newLabelFlags)
+			if err != nil {
+				return fmt.Errorf("invalid --label: %w", err)
+			}
+			for _, variable := range newEnvFlags {
+				if name, _, ok := strings.Cut(variable, "="); !ok || !envNameRegex.MatchString(name) {
+					return fmt.Errorf("invalid --env %q: it must look like NAME=value", variable)
+				}
+			}
+
+			seedDir := newSeedFlag
+			if seedDir != "" {
+				if seedDir, err = filepath.Abs(seedDir); err != nil {
+					return fmt.Errorf("invalid --seed: %w", err)
+				}
+			}
+
+			return createInstance(repoPath, session.InstanceOptions{
+				Title:    newTitleFlag,
+				Path:     repoPath,
+				Program:  config.ResolveProgram(programFlag, repoPath, config.LoadConfig()),
+				BaseRef:  newBaseFlag,
+				Subdir:   newSubdirFlag,
+				DiffBase: newDiffBaseFlag,
+				SeedDir:  seedDir,
+				Agent:    newAgentFlag,
+				Labels:   labels,
+				Env:      newEnvFlags,
+
+				WindowName: newWindowNameFlag,
+			}, nil, newDryRunFlag)
 		},
 	}
-)
 
-func init() {
-	rootCmd.Flags().StringVarP(&programFlag, "program", "p", "",
-		"Program to run in new instances (e.g. 'aider --model ollama_chat/gemma3:1b')")
-	rootCmd.Flags().BoolVarP(&autoYesFlag, "autoyes", "y", false,
-		"[experimental] If enabled, all instances will automatically accept prompts")
-	rootCmd.Flags().BoolVar(&daemonFlag, "daemon", false, "Run a program that loads all sessions"+
-		" and runs autoyes mode on them.")
-	rootCmd.Flags().StringVar(&repoPathFlag, "repo-path", "", "Repository path for daemon mode")
+	cloneCmd = &cobra.Command{
+		Use:   "clone <title>",
+		Short: "Create an instance with the same settings as an existing one",
+		Long: `Create an instance in a new worktree and branch, with the program, agent, subdirectory, diff base,
+window name, labels, environment and autoyes setting of an existing instance, e.g. to run another
+agent set up like one that works well.
 
-	// Hide the daemon flags as they're only for internal use
-	err := rootCmd.Flags().MarkHidden("daemon")
-	if err != nil {
-		panic(err)
+The new branch is created from --base, or HEAD, not from the existing instance's branch.
+--dry-run works as for cs new.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if cloneTitleFlag == "" {
+				return fmt.Errorf("--title is required")
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+			source, err := storage.FindInstanceData(args[0])
+			if err != nil {
+				return err
+			}
+
+			return createInstance(repoPath, source.CloneOptions(cloneTitleFlag, cloneBaseFlag),
+				source.AutoYesOverride, cloneDryRunFlag)
+		},
+	}
+
+	adoptCmd = &cobra.Command{
+		Use:   "adopt [session]",
+		Short: "Turn claude-squad tmux sessions missing from the state into instances",
+		Long: `List the claude-squad tmux sessions of this repository that no instance owns, e.g. ones left by an
+older version or a crash, or adopt one as an instance so it can be attached, paused and killed again.
+
+The instance's title is the one in the session's name, unless --title gives another, in which case
+the session is renamed to match. Its worktree and branch are those of the directory the session's
+pane is in, which must be a worktree in cs's worktree directory that no instance uses. Sessions
+that don't record the program they run, which older versions didn't, can't be adopted. --all
+adopts every session that can be.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if adoptAll && len(args) > 0 {
+				return fmt.Errorf("--all can't be combined with a session")
+			}
+			if adoptTitle != "" && len(args) == 0 {
+				return fmt.Errorf("--title needs a session to adopt")
+			}
+			if err := cmd2.CheckTmux(); err != nil {
+				return err
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+			return withRepoLock(repoPath, func() error {
+				state := config.LoadState(repoPath)
+				storage, err := session.NewStorage(state)
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				instancesData, err := storage.LoadInstanceData()
+				if err != nil {
+					return fmt.Errorf("failed to load instances: %w", err)
+				}
+				candidates, err := findAdoptableSessions(repoPath, instancesData)
+				if err != nil {
+					return err
+				}
+
+				if len(args) == 0 && !adoptAll {
+					if len(candidates) == 0 {
+						fmt.Println("No sessions to adopt")
+						return nil
+					}
+					fmt.Printf("Sessions that can be adopted (%d):\n", len(candidates))
+					for _, candidate := range candidates {
+						fmt.Printf("  - %s (as '%s')\n", candidate.Session, candidate.Title)
+					}
+					infoln("\nRun 'cs adopt <session>' to adopt one, or 'cs adopt --all' to adopt them all.")
+					return nil
+				}
+				if len(args) == 1 {
+					i := slices.IndexFunc(candidates, func(c adoptCandidate) bool { return c.Session == args[0] })
+					if i < 0 {
+						return fmt.Errorf("no session %s to adopt: run cs adopt to list them", args[0])
+					}
+					candidates = candidates[i : i+1]
+					if adoptTitle != "" {
+						candidates[0].Title = adoptTitle
+					}
+				}
+
+				adopted := 0
+				for _, candidate := range candidates {
+					if session.CountActive(instancesData) >= app.GlobalInstanceLimit {
+						return fmt.Errorf("you can't have more than %d instances", app.GlobalInstanceLimit)
+					}
+					data, err := adoptSession(repoPath, instancesData, candidate)
+					if err != nil {
+						if !adoptAll {
+							return err
+						}
+						fmt.Fprintf(os.Stderr, "Warning: not adopting session %s: %v\n", candidate.Session, err)
+						continue
+					}
+					instancesData = append(instancesData, data)
+					if err := storage.SaveInstanceData(instancesData); err != nil {
+						return fmt.Errorf("failed to save instance: %w", err)
+					}
+					adopted++
+					infof("Adopted session %s as instance '%s'\n  branch:   %s\n  worktree: %s\n",
+						candidate.Session, data.Title, data.Branch, data.Worktree.WorktreePath)
+				}
+				if adopted > 0 {
+					if err := config.RegisterRepo(repoPath); err != nil {
+						log.WarningLog.Printf("failed to register repo: %v", err)
+					}
+				}
+				if adoptAll {
+					infof("Adopted %d of %d session(s).\n", adopted, len(candidates))
+				}
+				return nil
+			})
+		},
+	}
+
+	archiveCmd = &cobra.Command{
+		Use:   "archive <title>",
+		Short: "Archive an instance: kill its tmux session but keep its worktree and branch",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			// Another process may be attached to the instance or squashing it.
+			instanceLock, err := lock.AcquireInstanceLock(repoPath, args[0])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := instanceLock.Release(); err != nil {
+					log.ErrorLog.Printf("failed to release instance lock: %v", err)
+				}
+			}()
+
+			return withRepoLock(repoPath, func() error {
+				state := config.LoadState(repoPath)
+				storage, err := session.NewStorage(state)
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				if err := storage.ArchiveInstance(args[0]); err != nil {
+					return err
+				}
+				// Otherwise a running daemon keeps polling the archived instance.
+				reloadDaemon(repoPath)
+				infof("Instance '%s' has been archived\n", args[0])
+				return nil
+			})
+		},
+	}
+
+	pinCmd = &cobra.Command{
+		Use:   "pin <title>",
+		Short: "Pin an instance so cs reset and bulk kills and cleanups skip it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setPinned(args[0], true)
+		},
+	}
+
+	unpinCmd = &cobra.Command{
+		Use:   "unpin <title>",
+		Short: "Unpin an instance",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setPinned(args[0], false)
+		},
+	}
+
+	noteCmd = &cobra.Command{
+		Use:   "note <title> [note]",
+		Short: "Set or print the note of an instance",
+		Long: `Attach a freeform note to an instance, e.g. what it's working on or what it's blocked on.
+Without a note, the instance's current note is printed. --clear removes it. Notes are shown by
+cs list --notes and in the TUI's preview.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if noteClear && len(args) == 2 {
+				return fmt.Errorf("--clear can't be combined with a note")
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 && !noteClear {
+				storage, err := session.NewStorage(config.LoadState(repoPath))
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				data, err := storage.FindInstanceData(args[0])
+				if err != nil {
+					return err
+				}
+				if data.Notes != "" {
+					fmt.Println(data.Notes)
+				}
+				return nil
+			}
+
+			return withRepoLock(repoPath, func() error {
+				storage, err := session.NewStorage(config.LoadState(repoPath))
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				var notes string
+				if len(args) == 2 {
+					notes = strings.TrimSpace(args[1])
+				}
+				if err := storage.SetNotes(args[0], notes); err != nil {
+					return err
+				}
+				if notes == "" {
+					infof("Cleared the note of instance '%s'\n", args[0])
+				} else {
+					infof("Set the note of instance '%s'\n", args[0])
+				}
+				return nil
+			})
+		},
+	}
+
+	labelCmd = &cobra.Command{
+		Use:   "label <title> [label...]",
+		Short: "Set or print the labels of an instance",
+		Long: `Tag an instance with labels, e.g. to run a command in a group of instances with cs exec --label.
+The given labels replace the instance's current ones. Without labels, the instance's current
+labels are printed, one per line. --clear removes them.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if labelClear && len(args) > 1 {
+				return fmt.Errorf("--clear can't be combined with labels")
+			}
+			labels, err := parseLabels(args[1:])
+			if err != nil {
+				return err
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 && !labelClear {
+				storage, err := session.NewStorage(config.LoadState(repoPath))
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				data, err := storage.FindInstanceData(args[0])
+				if err != nil {
+					return err
+				}
+				for _, label := range data.Labels {
+					fmt.Println(label)
+				}
+				return nil
+			}
+
+			return withRepoLock(repoPath, func() error {
+				storage, err := session.NewStorage(config.LoadState(repoPath))
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				if err := storage.SetLabels(args[0], labels); err != nil {
+					return err
+				}
+				if len(labels) == 0 {
+					infof("Cleared the labels of instance '%s'\n", args[0])
+				} else {
+					infof("Set the labels of instance '%s' to %s\n", args[0], strings.Join(labels, ", "))
+				}
+				return nil
+			})
+		},
+	}
+
+	killCmd = &cobra.Command{
+		Use:   "kill [title...]",
+		Short: "Kill instances: their tmux sessions, worktrees, branches and state",
+		Long: `Kill the given instances, or with --all-paused every paused instance: kill their tmux
+sessions, remove their worktrees and branches, and forget them. The instances are listed and
+you're asked to confirm first, unless --yes is passed. --keep-branch keeps their branches.
+--all-paused skips pinned instances unless --include-pinned is passed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if len(args) == 0 && !killAllPaused {
+				return fmt.Errorf("pass the titles of the instances to kill, or --all-paused")
+			}
+			if len(args) > 0 && killAllPaused {
+				return fmt.Errorf("--all-paused can't be combined with titles")
+			}
+			if killIncludePinned && !killAllPaused {
+				return fmt.Errorf("--include-pinned only applies to --all-paused")
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			return withRepoLock(repoPath, func() error {
+				state := config.LoadState(repoPath)
+				storage, err := session.NewStorage(state)
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				instancesData, err := storage.LoadInstanceData()
+				if err != nil {
+					return fmt.Errorf("failed to load instances: %w", err)
+				}
+
+				targets := make(map[string]bool)
+				if killAllPaused {
+					skippedPinned := 0
+					for _, data := range instancesData {
+						if data.Status != session.Paused {
+							continue
+						}
+						if data.Pinned && !killIncludePinned {
+							skippedPinned++
+							continue
+						}
+						targets[data.Title] = true
+					}
+					if skippedPinned > 0 {
+						infof("Skipping %d pinned instance(s); pass --include-pinned to kill them too.\n", skippedPinned)
+					}
+					if len(targets) == 0 {
+						infoln("No paused instances found")
+						return nil
+					}
+				} else {
+					for _, title := range args {
+						if _, err := storage.FindInstanceData(title); err != nil {
+							return err
+						}
+						targets[title] = true
+					}
+				}
+
+				// Without --yes, the list is part of the question, so it's printed with it on stderr, even with --quiet.
+				printf := infof
+				if !killYes {
+					printf = func(format string, a ...any) { fmt.Fprintf(os.Stderr, format, a...) }
+				}
+				printf("Instances to kill (%d):\n", len(targets))
+				for _, data := range instancesData {
+					if targets[data.Title] {
+						printf("  - %s (branch %s)\n", data.Title, data.Branch)
+					}
+				}
+				if killKeepBranch {
+					printf("Their branches will be kept.\n")
+				}
+				if config.SafeModeEnabled() {
+					return safeModeNoop("they were not killed")
+				}
+				if !killYes {
+					fmt.Fprint(os.Stderr, "Kill them? [y/N]: ")
+					var response string
+					fmt.Scanln(&response)
+					if response != "y" && response != "Y" {
+						infoln("Kill cancelled")
+						return nil
+					}
+				}
+
+				var errs []error
+				remaining := make([]session.InstanceData, 0, len(instancesData))
+				killed := 0
+				for _, data := range instancesData {
+					if !targets[data.Title] {
+						remaining = append(remaining, data)
+						continue
+					}
+					// Another process may be attached to the instance or squashing it.
+					instanceLock, err := lock.AcquireInstanceLock(repoPath, data.Title)
+					if err != nil {
+						errs = append(errs, err)
+						remaining = append(remaining, data)
+						continue
+					}
+					err = session.KillInstanceData(data, killKeepBranch)
+					if releaseErr := instanceLock.Release(); releaseErr != nil {
+						log.ErrorLog.Printf("failed to release instance lock: %v", releaseErr)
+					}
+					if err != nil {
+						errs = append(errs, fmt.Errorf("failed to kill %s: %w", data.Title, err))
+						remaining = append(remaining, data)
+						continue
+					}
+					killed++
+				}
+
+				if killed > 0 {
+					if err := storage.SaveInstanceData(remaining); err != nil {
+						return fmt.Errorf("failed to save instances: %w", err)
+					}
+					// Otherwise a running daemon keeps polling the killed instances.
+					reloadDaemon(repoPath)
+				}
+				infof("Killed %d instance(s).\n", killed)
+				return errors.Join(errs...)
+			})
+		},
+	}
+
+	whereCmd = &cobra.Command{
+		Use:   "where <title>",
+		Short: "Print an instance's worktree path and branch",
+		Long: `Print the absolute path of an instance's worktree and the name of its branch, to work on
+them from your own shell. --path-only prints just the path, e.g. for
+cd "$(cs where my-task --path-only)", and --json prints both as JSON.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if wherePathOnly && whereJSON {
+				return fmt.Errorf("--path-only and --json can't be combined")
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+			data, err := storage.FindInstanceData(args[0])
+			if err != nil {
+				return err
+			}
+			paused := data.Status == session.Paused
+
+			switch {
+			case whereJSON:
+				out, err := json.MarshalIndent(struct {
+					Title        string `json:"title"`
+					Branch       string `json:"branch"`
+					WorktreePath string `json:"worktree_path"`
+					Paused       bool   `json:"paused"`
+				}{data.Title, data.Branch, data.Worktree.WorktreePath, paused}, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal instance: %w", err)
+				}
+				fmt.Println(string(out))
+			case wherePathOnly:
+				if paused {
+					return fmt.Errorf("instance '%s' is paused, so its worktree was removed: resume it first", data.Title)
+				}
+				fmt.Println(data.Worktree.WorktreePath)
+			default:
+				worktree := data.Worktree.WorktreePath
+				if paused {
+					worktree += " (removed while paused)"
+				}
+				fmt.Printf("worktree: %s\nbranch:   %s\n", worktree, data.Branch)
+			}
+			return nil
+		},
+	}
+
+	openCmd = &cobra.Command{
+		Use:   "open <title>",
+		Short: "Open an instance's worktree in your editor",
+		Long: `Open an instance's worktree with the editor configured in the config file, or $EDITOR.
+If no editor is set, the worktree path is printed instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+			data, err := storage.FindInstanceData(args[0])
+			if err != nil {
+				return err
+			}
+			if data.Status == session.Paused {
+				return fmt.Errorf("instance '%s' is paused, so its worktree was removed: resume it first", data.Title)
+			}
+			worktreePath := data.Worktree.WorktreePath
+
+			editor := editorCommand()
+			editorArgs := strings.Fields(editor)
+			if len(editorArgs) == 0 {
+				fmt.Printf("No editor configured (set $EDITOR or \"editor\" in the config). Worktree: %s\n", worktreePath)
+				return nil
+			}
+
+			editorCmd := exec.Command(editorArgs[0], append(editorArgs[1:], worktreePath)...)
+			editorCmd.Dir = worktreePath
+			editorCmd.Stdin = os.Stdin
+			editorCmd.Stdout = os.Stdout
+			editorCmd.Stderr = os.Stderr
+			if err := editorCmd.Run(); err != nil {
+				fmt.Printf("Failed to run %s. Worktree: %s\n", editor, worktreePath)
+				return fmt.Errorf("failed to open editor: %w", err)
+			}
+			return nil
+		},
+	}
+
+	attachCmd = &cobra.Command{
+		Use:   "attach [title]",
+		Short: "Attach the terminal to an instance's tmux session",
+		Long: `Attach the terminal to an instance's tmux session. Without a title, pick the instance
+from a list. Detach with the tmux prefix key followed by d.
+
+When run inside tmux, the current tmux client is switched to the instance's session instead of
+nesting another client.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if err := cmd2.CheckTmux(); err != nil {
+				return err
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+
+			var data session.InstanceData
+			if len(args) == 1 {
+				data, err = storage.FindInstanceData(args[0])
+				if err != nil {
+					return err
+				}
+			} else {
+				data, err = pickInstance(storage)
+				if err != nil || data.Title == "" {
+					return err
+				}
+			}
+
+			if data.Archived {
+				return fmt.Errorf("%w: %s", session.ErrInstanceArchived, data.Title)
+			}
+			if data.Status == session.Paused {
+				return fmt.Errorf("instance '%s' is paused: resume it first", data.Title)
+			}
+
+			// Hold the instance while attached so it can't be squashed or archived from under us. Inside tmux,
+			// AttachTerminal only switches the client over, so the lock is held just for the switch.
+			instanceLock, err := lock.AcquireInstanceLock(repoPath, data.Title)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := instanceLock.Release(); err != nil {
+					log.ErrorLog.Printf("failed to release instance lock: %v", err)
+				}
+			}()
+			return tmux.NewTmuxSession(data.Title, data.Program, data.Path).AttachTerminal()
+		},
+	}
+
+	envCmd = &cobra.Command{
+		Use:   "env <title>",
+		Short: "Print the environment of an instance's tmux session",
+		Long: `Print the variables set in an instance's tmux session environment. Variables set by
+claude-squad or specifically for the session are marked with *; the rest are copied by tmux
+from the client environment.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if err := cmd2.CheckTmux(); err != nil {
+				return err
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+			data, err := storage.FindInstanceData(args[0])
+			if err != nil {
+				return err
+			}
+
+			tmuxSession := tmux.NewTmuxSession(data.Title, data.Program, data.Path)
+			if !tmuxSession.DoesSessionExist() {
+				return fmt.Errorf("instance '%s' has no running tmux session", data.Title)
+			}
+			vars, err := getSessionEnvAll(tmuxSession.Name())
+			if err != nil {
+				return fmt.Errorf("failed to read environment of tmux session %s: %w", tmuxSession.Name(), err)
+			}
+
+			for _, v := range vars {
+				marker := " "
+				if !tmuxDefaultEnv[v.Name] {
+					marker = "*"
+				}
+				fmt.Printf("%s %s=%s\n", marker, v.Name, v.Value)
+			}
+			return nil
+		},
+	}
+
+	topCmd = &cobra.Command{
+		Use:   "top",
+		Short: "Show a live view of the instances' status, diff stats and activity",
+		Long: `Show the repository's instances in a table refreshed every second, with their status, diff
+stats and how long ago each last printed something. It only reads the state, so it can run
+next to the main app. Press q to quit.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+			return app.Top(repoPath)
+		},
+	}
+
+	execCmd = &cobra.Command{
+		Use:   "exec [title...] [--label label...] -- <command> [args...]",
+		Short: "Run a command in the worktrees of several instances",
+		Long: `Run a command in the worktree of each given instance, or of every instance that has one, e.g.
+cs exec -- git fetch. Paused instances are skipped since their worktree was removed. Each
+instance's output is printed under its title, and cs exec fails if the command failed in any
+of them. The instance's title and branch are passed in the CLAUDE_SQUAD_INSTANCE and
+CLAUDE_SQUAD_BRANCH environment variables. With --plain, the command also gets NO_COLOR and the
+escape sequences, e.g. colors, are stripped from its output.
+
+--label only runs the command in the instances that have every given label, see cs label.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			dash := cmd.ArgsLenAtDash()
+			if dash < 0 || dash == len(args) {
+				return fmt.Errorf("no command given: pass it after --, e.g. cs exec -- git fetch")
+			}
+			if execParallel < 1 {
+				return fmt.Errorf("--parallel must be at least 1")
+			}
+			titles, command := args[:dash], args[dash:]
+			if len(titles) > 0 && len(execLabels) > 0 {
+				return fmt.Errorf("--label can't be combined with titles")
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+
+			var instancesData []session.InstanceData
+			if len(titles) > 0 {
+				for _, title := range titles {
+					data, err := storage.FindInstanceData(title)
+					if err != nil {
+						return err
+					}
+					if data.Status == session.Paused {
+						return fmt.Errorf("instance '%s' is paused, so its worktree was removed: resume it first", data.Title)
+					}
+					instancesData = append(instancesData, data)
+				}
+			} else {
+				all, err := storage.LoadInstanceData()
+				if err != nil {
+					return fmt.Errorf("failed to load instances: %w", err)
+				}
+				for _, data := range all {
+					if data.Status != session.Paused && data.HasLabels(execLabels) {
+						instancesData = append(instancesData, data)
+					}
+				}
+			}
+			if len(instancesData) == 0 {
+				if len(execLabels) > 0 {
+					return fmt.Errorf("no instances with a worktree and the labels %s to run the command in",
+						strings.Join(execLabels, ", "))
+				}
+				return fmt.Errorf("no instances with a worktree to run the command in")
+			}
+			return execInWorktrees(instancesData, command, execParallel)
+		},
+	}
+
+	gridCmd = &cobra.Command{
+		Use:   "grid [title...]",
+		Short: "Show several instances at once in a tiled tmux window",
+		Long: `Show the given instances, or all running ones, side by side in a temporary tmux session
+with a tiled layout. The panes are read-only views of the instances' sessions, so typing in the
+grid doesn't reach the agents. Detach with the tmux prefix key followed by d; the grid goes away
+and the instances keep running.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if err := cmd2.CheckTmux(); err != nil {
+				return err
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+
+			var instancesData []session.InstanceData
+			if len(args) > 0 {
+				for _, title := range args {
+					data, err := storage.FindInstanceData(title)
+					if err != nil {
+						return err
+					}
+					instancesData = append(instancesData, data)
+				}
+			} else {
+				all, err := storage.LoadInstanceData()
+				if err != nil {
+					return fmt.Errorf("failed to load instances: %w", err)
+				}
+				for _, data := range all {
+					if !data.Archived && data.Status != session.Paused {
+						instancesData = append(instancesData, data)
+					}
+				}
+			}
+
+			var sessions []*tmux.TmuxSession
+			for _, data := range instancesData {
+				tmuxSession := tmux.NewTmuxSession(data.Title, data.Program, data.Path)
+				if !tmuxSession.DoesSessionExist() {
+					if len(args) > 0 {
+						return fmt.Errorf("instance '%s' has no running tmux session", data.Title)
+					}
+					continue
+				}
+				sessions = append(sessions, tmuxSession)
+			}
+			if len(sessions) == 0 {
+				return fmt.Errorf("no running instances to show")
+			}
+			return tmux.AttachGrid(sessions)
+		},
+	}
+
+	squashCmd = &cobra.Command{
+		Use:   "squash <title>",
+		Short: "Squash the commits on an instance's branch into a single commit",
+		Long: `Squash the commits the agent made since the instance was created into a single commit.
+The worktree must not have uncommitted changes. Without --message, the commit message lists
+the squashed commits.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+			data, err := storage.FindInstanceData(args[0])
+			if err != nil {
+				return err
+			}
+			if data.Status == session.Paused {
+				return fmt.Errorf("instance '%s' is paused, so its worktree was removed: resume it first", data.Title)
+			}
+
+			instanceLock, err := lock.AcquireInstanceLock(repoPath, data.Title)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := instanceLock.Release(); err != nil {
+					log.ErrorLog.Printf("failed to release instance lock: %v", err)
+				}
+			}()
+
+			worktree := git.NewGitWorktreeFromStorage(
+				data.Worktree.RepoPath,
+				data.Worktree.WorktreePath,
+				data.Worktree.SessionName,
+				data.Worktree.BranchName,
+				data.Worktree.BaseCommitSHA,
+				data.Worktree.IsolationMode,
+			)
+			hash, err := worktree.Squash(squashMessage)
+			if err != nil {
+				return err
+			}
+			infof("Squashed branch %s into commit %s\n", data.Branch, hash)
+			return nil
+		},
+	}
+
+	compareCmd = &cobra.Command{
+		Use:   "compare <titleA> <titleB>",
+		Short: "Diff the branches of two instances",
+		Long: `Print the git diff from the branch of instance A to the branch of instance B, e.g. to pick the
+better of two agents given the same prompt. With --merge-base, print only what B changed since the
+branches diverged. With --stat, print a diffstat instead of the patch.
+
+Only committed work is compared: changes the agents haven't committed yet are in their worktrees,
+not on their branches. Paused instances can be compared, since pausing keeps the branch. Branches
+of instances isolated in a clone are compared as they are in the clone.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			state := config.LoadState(repoPath)
+			storage, err := session.NewStorage(state)
+			if err != nil {
+				return fmt.Errorf("failed to initialize storage: %w", err)
+			}
+			var worktrees [2]*git.GitWorktree
+			for i, title := range args {
+				data, err := storage.FindInstanceData(title)
+				if err != nil {
+					return err
+				}
+				if data.Branch == "" {
+					return fmt.Errorf("instance '%s' has no branch", data.Title)
+				}
+				worktrees[i] = git.NewGitWorktreeFromStorage(
+					repoPath,
+					data.Worktree.WorktreePath,
+					data.Worktree.SessionName,
+					data.Worktree.BranchName,
+					data.Worktree.BaseCommitSHA,
+					data.Worktree.IsolationMode,
+				)
+			}
+
+			diff, err := git.CompareBranches(worktrees[0], worktrees[1], compareMergeBaseFlag, compareStatFlag)
+			if err != nil {
+				return err
+			}
+			if diff == "" {
+				infof("No differences between %s and %s\n", worktrees[0].GetBranchName(), worktrees[1].GetBranchName())
+				return nil
+			}
+			if plainOutput() {
+				// color.ui=always makes git color the diff even though it isn't writing to a terminal.
+				diff = humanize.StripEscapes(diff)
+			}
+			fmt.Print(diff)
+			return nil
+		},
+	}
+
+	logsCmd = &cobra.Command{
+		Use:   "logs [title]",
+		Short: "Print the claude-squad log, or an instance's output",
+		Long: `Print the log written by cs and its daemons.
+
+--since accepts a duration (e.g. 10m, 2h) to show the lines from that long ago, or an
+RFC3339 timestamp (e.g. 2025-01-02T15:04:05Z).
+
+Given an instance title, print the instance's output instead: the last --lines lines of its
+tmux pane, scrollback included. --full prints the whole scrollback.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				if logsSince != "" {
+					return fmt.Errorf("--since only applies to the claude-squad log")
+				}
+				lines := logsLines
+				if logsFull {
+					lines = 0
+				}
+				return printInstanceOutput(args[0], lines)
+			}
+
+			since, err := parseSince(logsSince)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(log.FilePath())
+			if err != nil {
+				if os.IsNotExist(err) {
+					fmt.Println("No logs found")
+					return nil
+				}
+				return fmt.Errorf("failed to open log file: %w", err)
+			}
+			defer f.Close()
+
+			// Lines without a timestamp continue the previous message, so they share its fate.
+			include := since.IsZero()
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if t, ok := log.ParseLineTime(line); ok && !since.IsZero() {
+					include = !t.Before(since.Truncate(time.Second))
+				}
+				if include {
+					fmt.Println(line)
+				}
+			}
+			return scanner.Err()
+		},
+	}
+
+	eventsCmd = &cobra.Command{
+		Use:   "events",
+		Short: "Print the actions the daemon took on instances",
+		Long: `Print the events the repository's daemon recorded, oldest first: the prompts autoyes accepted,
+the instances it paused or killed for exceeding max_runtime, and the errors doing so. Each prompt
+is recorded once, however many polls it stayed on screen for. Only the last 5-10 MB of events are
+kept.
+
+--action is one of confirm, pause, kill or error. --since accepts a duration (e.g. 10m, 2h)
+or an RFC3339 timestamp, like cs logs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			since, err := parseSince(eventsSince)
+			if err != nil {
+				return err
+			}
+			actions := []string{daemon.EventConfirm, daemon.EventPause, daemon.EventKill, daemon.EventError}
+			if eventsAction != "" && !slices.Contains(actions, eventsAction) {
+				return fmt.Errorf("invalid --action %q: use one of %s", eventsAction, strings.Join(actions, ", "))
+			}
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+			events, err := daemon.ReadEvents(repoPath)
+			if err != nil {
+				return err
+			}
+			events = slices.DeleteFunc(events, func(event daemon.Event) bool {
+				return (eventsInstance != "" && event.Instance != eventsInstance) ||
+					(eventsAction != "" && event.Action != eventsAction) ||
+					(!since.IsZero() && event.Time.Before(since))
+			})
+
+			if eventsJSON {
+				if events == nil {
+					events = []daemon.Event{}
+				}
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(events)
+			}
+			if len(events) == 0 {
+				fmt.Println("No events found")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tINSTANCE\tACTION\tDETAIL")
+			for _, event := range events {
+				detail := event.Prompt
+				if event.Error != "" {
+					detail = event.Error
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", event.Time.Local().Format("2006-01-02 15:04:05"), event.Instance,
+					event.Action, detail)
+			}
+			return w.Flush()
+		},
+	}
+
+	reposCmd = &cobra.Command{
+		Use:   "repos",
+		Short: "List the repositories claude-squad has created instances in",
+		Long: `List the repositories claude-squad has created instances in, from the global index.
+
+--prune removes the repositories that no longer exist or are no longer git repositories from the
+index, e.g. after they were deleted or moved, and prints what it removed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if reposPrune {
+				pruned, err := config.PruneRepos(checkRepo)
+				if err != nil {
+					return err
+				}
+				if len(pruned) == 0 {
+					infoln("No dead repos found")
+					return nil
+				}
+				infof("Pruned %d dead repo(s):\n", len(pruned))
+				for _, repo := range pruned {
+					infof("  - %s (%s)\n", repo.Path, repo.Reason)
+				}
+				return nil
+			}
+
+			repos, err := config.ListRepos()
+			if err != nil {
+				return err
+			}
+			if len(repos) == 0 {
+				fmt.Println("No repositories found")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REPO\tINSTANCES\tDAEMON\tLAST USED")
+			dead := 0
+			for _, repo := range repos {
+				lastUsed := repo.LastUsed.Format("2006-01-02 15:04")
+				if reason := checkRepo(repo.Path); reason != "" {
+					fmt.Fprintf(w, "%s\t-\t%s\t%s\n", repo.Path, reason, lastUsed)
+					dead++
+					continue
+				}
+				status, err := daemon.GetStatus(repo.Path)
+				if err != nil {
+					log.WarningLog.Printf("failed to get status of %s: %v", repo.Path, err)
+					fmt.Fprintf(w, "%s\t?\t?\t%s\n", repo.Path, lastUsed)
+					continue
+				}
+				daemonStatus := "stopped"
+				if status.Running {
+					daemonStatus = fmt.Sprintf("running (PID %d)", status.PID)
+				} else if status.Stale {
+					daemonStatus = "dead"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", repo.Path, status.Instances, daemonStatus, lastUsed)
+			}
+			w.Flush()
+			if dead > 0 {
+				fmt.Println("\nRun 'cs repos --prune' to remove the dead repos from the list.")
+			}
+			return nil
+		},
+	}
+
+	syncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Mark instances whose branch was merged on the remote",
+		Long: `Fetch origin and mark the instances whose branch was merged into origin's default branch,
+e.g. after merging a pull request on GitHub. A branch counts as merged if its commits are
+reachable from the default branch; in clone mode, as the branch is in the instance's clone.
+Squash and rebase merges leave no commit of the branch behind, so they aren't detected.
+
+With --archive, merged instances are archived. The merge_hook command from the config runs
+for each newly merged instance.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			return withRepoLock(repoPath, func() error {
+				if !syncNoFetch {
+					if err := git.FetchRemote(repoPath); err != nil {
+						return err
+					}
+				}
+				target, err := git.RemoteDefaultBranch(repoPath)
+				if err != nil {
+					return err
+				}
+
+				state := config.LoadState(repoPath)
+				storage, err := session.NewStorage(state)
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				instancesData, err := storage.LoadInstanceData()
+				if err != nil {
+					return fmt.Errorf("failed to load instances: %w", err)
+				}
+
+				hook := config.LoadConfig().MergeHook
+				var merged int
+				for i := range instancesData {
+					data := &instancesData[i]
+					if data.Archived || data.Merged || data.Worktree.BranchName == "" {
+						continue
+					}
+					worktree := git.NewGitWorktreeFromStorage(
+						data.Worktree.RepoPath,
+						data.Worktree.WorktreePath,
+						data.Worktree.SessionName,
+						data.Worktree.BranchName,
+						data.Worktree.BaseCommitSHA,
+						data.Worktree.IsolationMode,
+					)
+					isMerged, err := worktree.IsMergedInto(target)
+					if err != nil {
+						log.WarningLog.Printf("skipping instance %s: %v", data.Title, err)
+						continue
+					}
+					if !isMerged {
+						continue
+					}
+
+					merged++
+					data.Merged = true
+					data.UpdatedAt = time.Now()
+					infof("Instance '%s': branch %s was merged into %s\n", data.Title, data.Branch, target)
+					if syncArchive {
+						if err := session.ArchiveInstanceData(data); err != nil {
+							log.ErrorLog.Printf("failed to archive instance %s: %v", data.Title, err)
+						} else {
+							infof("Instance '%s' has been archived\n", data.Title)
+						}
+					}
+					if hook != "" {
+						runMergeHook(hook, data)
+					}
+				}
+
+				if merged == 0 {
+					infof("No newly merged instances (checked against %s).\n", target)
+					return nil
+				}
+				if err := storage.SaveInstanceData(instancesData); err != nil {
+					return err
+				}
+				if syncArchive {
+					// Otherwise a running daemon keeps polling the archived instances.
+					reloadDaemon(repoPath)
+				}
+				return nil
+			})
+		},
+	}
+
+	fetchCmd = &cobra.Command{
+		Use:   "fetch [title...]",
+		Short: "Fetch origin and show how far instances' branches are behind its default branch",
+		Long: `Fetch origin once in the repository, whose objects the worktrees share, and show how many
+commits the branch of each given instance, or of every instance, is ahead of and behind
+origin's default branch. Instances isolated in a clone are fetched in their clone.
+
+With --rebase, the branches that are behind are rebased onto the default branch in their
+worktrees, setting uncommitted changes aside meanwhile. A rebase that conflicts is aborted and
+its conflicting files are reported, and the other instances are still rebased. Paused
+instances have no worktree, so they aren't rebased.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			fetch := func() error {
+				state := config.LoadState(repoPath)
+				storage, err := session.NewStorage(state)
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				var instancesData []session.InstanceData
+				if len(args) > 0 {
+					for _, title := range args {
+						data, err := storage.FindInstanceData(title)
+						if err != nil {
+							return err
+						}
+						instancesData = append(instancesData, data)
+					}
+				} else {
+					all, err := storage.LoadInstanceData()
+					if err != nil {
+						return fmt.Errorf("failed to load instances: %w", err)
+					}
+					for _, data := range all {
+						if !data.Archived && data.Worktree.BranchName != "" {
+							instancesData = append(instancesData, data)
+						}
+					}
+				}
+				if len(instancesData) == 0 {
+					fmt.Println("No instances found")
+					return nil
+				}
+
+				if err := git.FetchRemote(repoPath); err != nil {
+					return err
+				}
+				target, err := git.RemoteDefaultBranch(repoPath)
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				if fetchRebase {
+					fmt.Fprintf(w, "INSTANCE\tBRANCH\tAHEAD\tBEHIND %s\tREBASE\n", target)
+				} else {
+					fmt.Fprintf(w, "INSTANCE\tBRANCH\tAHEAD\tBEHIND %s\n", target)
+				}
+				var failed []string
+				for _, data := range instancesData {
+					result := fetchInstance(repoPath, data, target, fetchRebase)
+					if result.err == nil && result.baseCommitSHA != "" {
+						if err := storage.SetBaseCommit(data.Title, result.baseCommitSHA); err != nil {
+							result.err = err
+							result.rebase = "rebased, but " + err.Error()
+						}
+					}
+					if result.err != nil {
+						log.ErrorLog.Printf("cs fetch failed for instance %s: %v", data.Title, result.err)
+						failed = append(failed, data.Title)
+						if !fetchRebase {
+							fmt.Fprintf(os.Stderr, "%s: %v\n", data.Title, result.err)
+						}
+					}
+					if fetchRebase {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", data.Title, data.Branch, result.ahead, result.behind,
+							result.rebase)
+					} else {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", data.Title, data.Branch, result.ahead, result.behind)
+					}
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				if len(failed) > 0 {
+					return fmt.Errorf("failed for %d instance(s): %s", len(failed), strings.Join(failed, ", "))
+				}
+				return nil
+			}
+			if !fetchRebase {
+				return fetch()
+			}
+			// Rebasing moves the branches' base commits, which a running cs would overwrite on exit.
+			return withRepoLock(repoPath, fetch)
+		},
+	}
+
+	gcCmd = &cobra.Command{
+		Use:   "gc",
+		Short: "Find and remove state left behind by crashed or removed instances",
+		Long: `Audit the repository's state directory (.claude-squad by default) and list what's left behind:
+
+- the PID file of a daemon that is no longer running
+- instance lock files no process holds
+- corrupted or foreign state files set aside when loading state
+- worktree directories that no instance uses
+
+Nothing is removed unless --yes is passed. Branches of orphaned worktrees are kept.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			// A running cs may be creating worktrees that aren't in the saved state yet.
+			return withRepoLock(repoPath, func() error {
+				artifacts, err := findGCArtifacts(repoPath)
+				if err != nil {
+					return err
+				}
+				if len(artifacts) == 0 {
+					fmt.Println("Nothing to clean up.")
+					return nil
+				}
+
+				fmt.Printf("Found %d orphaned artifact(s):\n", len(artifacts))
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				for _, artifact := range artifacts {
+					fmt.Fprintf(w, "  %s\t%s\n", artifact.kind, artifact.path)
+				}
+				w.Flush()
+
+				if !gcYes {
+					fmt.Println("\nRun 'cs gc --yes' to remove them.")
+					return nil
+				}
+				if config.SafeModeEnabled() {
+					infoln()
+					return safeModeNoop("nothing was removed")
+				}
+
+				var errs []error
+				for _, artifact := range artifacts {
+					if err := artifact.remove(); err != nil {
+						errs = append(errs, err)
+					}
+				}
+				// The removed state may have been the daemon's, e.g. the worktree of an instance it polls.
+				reloadDaemon(repoPath)
+				if len(errs) > 0 {
+					return errors.Join(errs...)
+				}
+				infof("Removed %d artifact(s).\n", len(artifacts))
+				return nil
+			})
+		},
+	}
+
+	repairCmd = &cobra.Command{
+		Use:   "repair",
+		Short: "Repair instances whose worktree was deleted and worktrees whose instance was never saved",
+		Long: `Find instances whose worktree was deleted outside of cs, or never created because cs crashed,
+prune the dangling git worktree registration and kill their tmux session. Repaired instances
+are paused and can be resumed from their branch, or recreated right away with --recreate.
+
+Worktrees left behind by a creation that crashed before the instance was saved are removed,
+keeping their branch. If the instance's tmux session is running, the worktree is kept so the
+session can be turned into an instance with cs adopt. cs does both of these on startup too.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			return withRepoLock(repoPath, func() error {
+				state := config.LoadState(repoPath)
+				storage, err := session.NewStorage(state)
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				interrupted, err := storage.RecoverInterruptedCreations(repoPath)
+				if err != nil {
+					return err
+				}
+				for _, creation := range interrupted {
+					if creation.SessionRunning {
+						infof("Kept worktree of unsaved instance '%s': its session is running, adopt it with cs adopt\n",
+							creation.Title)
+					} else if creation.SafeMode {
+						infof("Kept worktree of unsaved instance '%s', as safe mode is on: %s\n", creation.Title,
+							creation.WorktreePath)
+					} else {
+						infof("Removed worktree of unsaved instance '%s': %s\n", creation.Title, creation.WorktreePath)
+					}
+				}
+
+				repaired, err := storage.RepairInstances()
+				if err != nil {
+					return err
+				}
+				if len(repaired) == 0 {
+					if len(interrupted) == 0 {
+						infoln("No broken instances found")
+					}
+					return nil
+				}
+				for _, title := range repaired {
+					infof("Paused instance '%s': its worktree was missing\n", title)
+				}
+
+				if !repairRecreate {
+					return nil
+				}
+				return recreateInstances(storage, repaired)
+			})
+		},
+	}
+
+	resumeAllCmd = &cobra.Command{
+		Use:   "resume-all",
+		Short: "Recreate the tmux sessions of instances whose session is gone, e.g. after a reboot",
+		Long: `Recreate the tmux session of every running instance whose session no longer exists, e.g.
+after a reboot, running the instance's program in its existing worktree. Instances whose
+session is still running are skipped, as are paused and archived ones. Instances whose
+worktree is gone too are repaired and paused first, as cs repair does.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			repoPath, err := getRepoPath()
+			if err != nil {
+				return err
+			}
+
+			return withRepoLock(repoPath, func() error {
+				state := config.LoadState(repoPath)
+				storage, err := session.NewStorage(state)
+				if err != nil {
+					return fmt.Errorf("failed to initialize storage: %w", err)
+				}
+				repaired, err := storage.RepairInstances()
+				if err != nil {
+					return err
+				}
+				for _, title := range repaired {
+					infof("Paused instance '%s': its worktree was missing\n", title)
+				}
+				return resumeAllInstances(repoPath, storage)
+			})
+		},
+	}
+
+	cleanupCmd = &cobra.Command{
+		Use:   "cleanup",
+		Short: "List or clean up claude-squad tmux sessions",
+		Long: `List all claude-squad tmux sessions, or clean up orphaned sessions.
+
+Usage:
+  cs cleanup              List all sessions (default)
+  cs cleanup --json       Print the sessions as JSON, without prompting
+  cs cleanup --fail-on-orphans
+                          Exit with an error instead of prompting if orphans are found (for CI)
+  cs cleanup --kill-all   Kill all claude-squad sessions without prompting
+  cs cleanup --kill-all --repo-only
+                          Kill only the current repo's sessions, holding its lock
+
+--kill-all leaves the sessions of pinned instances running unless --include-pinned is passed.
+
+Orphaned sessions occur when:
+- A repository is deleted but tmux sessions remain
+- The state directory (.claude-squad/ by default) is removed manually
+- Sessions are left after repository moves`,
+		// --fail-on-orphans errors are results, not usage mistakes.
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if cleanupKillAll && (cleanupJSON || cleanupFailOnOrphans) {
+				return fmt.Errorf("--json and --fail-on-orphans can't be used with --kill-all")
+			}
+			if cleanupKillAll && cleanupRepo {
+				return killRepoClaudeSquadSessions()
+			}
+			if cleanupKillAll {
+				return killAllClaudeSquadSessions()
+			}
+			if cleanupRepo {
+				return fmt.Errorf("--repo-only can only be used with --kill-all")
+			}
+			if cleanupIncludePinned {
+				return fmt.Errorf("--include-pinned can only be used with --kill-all")
+			}
+
+			if cleanupJSON {
+				return printCleanupReportJSON(cleanupFailOnOrphans)
+			}
+			// Default: list sessions and check for orphans
+			return cleanupOrphanedSessions(cleanupFailOnOrphans)
+		},
+	}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&repoFlag, "repo", "",
+		"Path of the git repository to operate on (defaults to the current directory)")
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "",
+		"Path of the config file (defaults to ~/.claude-squad/config.json)")
+	rootCmd.PersistentFlags().BoolVar(&plainFlag, "plain", false,
+		"Print command output without colors or other styling (also enabled by the NO_COLOR environment variable)")
+	rootCmd.PersistentFlags().BoolVar(&plainFlag, "no-color", false, "Same as --plain")
+	rootCmd.PersistentFlags().BoolVarP(&quietFlag, "quiet", "q", false,
+		"Only print errors and results such as --json output, not progress or confirmations (for scripts)")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		config.SetConfigPath(configFlag)
+		log.SetQuiet(quietFlag)
+		if quietFlag {
+			// main prints the error once; scripts don't need cobra's copy and the usage on top.
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+		}
+		// The TUI keeps its colors, which carry meaning there.
+		if cmd != rootCmd && plainOutput() {
+			lipgloss.SetColorProfile(termenv.Ascii)
+		}
+	}
+	rootCmd.Flags().StringVarP(&programFlag, "program", "p", "",
+		"Program to run in new instances (e.g. 'aider --model ollama_chat/gemma3:1b'), or the name of one in the programs config")
+	rootCmd.Flags().BoolVarP(&autoYesFlag, "autoyes", "y", false,
+		"[experimental] If enabled, all instances will automatically accept prompts")
+	rootCmd.Flags().BoolVar(&daemonFlag, "daemon", false, "Run a program that loads all sessions"+
+		" and runs autoyes mode on them.")
+	rootCmd.Flags().BoolVar(&noDaemonFlag, "no-daemon", false,
+		"Don't launch a daemon on exit (e.g. in containers or CI)")
+	rootCmd.Flags().StringVar(&repoPathFlag, "repo-path", "", "Repository path for daemon mode")
+	rootCmd.Flags().BoolVar(&daemonMonitor, "monitor", false, "In daemon mode, don't accept prompts")
+
+	// Hide the daemon flags as they're only for internal use
+	err := rootCmd.Flags().MarkHidden("daemon")
+	if err != nil {
+		panic(err)
+	}
+	err = rootCmd.Flags().MarkHidden("repo-path")
+	if err != nil {
+		panic(err)
+	}
+	err = rootCmd.Flags().MarkHidden("monitor")
+	if err != nil {
+		panic(err)
+	}
+
+	// Cleanup command flags
+	cleanupCmd.Flags().BoolVar(&cleanupKillAll, "kill-all", false, "Kill all claude-squad sessions without prompting")
+	cleanupCmd.Flags().BoolVar(&cleanupRepo, "repo-only", false,
+		"With --kill-all, only kill the current repository's sessions")
+	cleanupCmd.Flags().BoolVar(&cleanupJSON, "json", false,
+		"Print the active, orphaned and unknown sessions as JSON instead of prompting")
+	cleanupCmd.Flags().BoolVar(&cleanupIncludePinned, "include-pinned", false,
+		"With --kill-all, kill the sessions of pinned instances too")
+	cleanupCmd.Flags().BoolVar(&cleanupFailOnOrphans, "fail-on-orphans", false,
+		"Exit with an error if orphaned sessions are found, instead of offering to kill them")
+
+	// Squash command flags
+	squashCmd.Flags().StringVarP(&squashMessage, "message", "m", "", "Message of the squashed commit")
+
+	// Logs command flags
+	logsCmd.Flags().StringVar(&logsSince, "since", "", "Only show lines since a duration ago (e.g. 10m) or an RFC3339 timestamp")
+	logsCmd.Flags().IntVar(&logsLines, "lines", tmux.DefaultCaptureLines, "With a title, how many lines of the instance's output to print")
+	logsCmd.Flags().BoolVar(&logsFull, "full", false, "With a title, print the instance's whole scrollback")
+
+	// Events command flags
+	eventsCmd.Flags().StringVar(&eventsInstance, "instance", "", "Only show the events of the instance with this title")
+	eventsCmd.Flags().StringVar(&eventsAction, "action", "", "Only show events of this action (confirm, pause, kill or error)")
+	eventsCmd.Flags().StringVar(&eventsSince, "since", "", "Only show events since a duration ago (e.g. 10m) or an RFC3339 timestamp")
+	eventsCmd.Flags().BoolVar(&eventsJSON, "json", false, "Print the events as JSON")
+
+	// Sync command flags
+	syncCmd.Flags().BoolVar(&syncArchive, "archive", false, "Archive the instances found merged")
+	syncCmd.Flags().BoolVar(&syncNoFetch, "no-fetch", false, "Check against the remote-tracking branches without fetching")
+
+	// Fetch command flags
+	fetchCmd.Flags().BoolVar(&fetchRebase, "rebase", false,
+		"Rebase the branches that are behind onto origin's default branch")
+
+	// GC command flags
+	gcCmd.Flags().BoolVar(&gcYes, "yes", false, "Remove the orphaned artifacts instead of only listing them")
+
+	resetCmd.Flags().BoolVar(&resetIncludePinned, "include-pinned", false, "Reset pinned instances too")
+
+	// Repair command flags
+	repairCmd.Flags().BoolVar(&repairRecreate, "recreate", false,
+		"Recreate the worktrees of repaired instances instead of leaving them paused")
+
+	// New command flags
+	newCmd.Flags().StringVarP(&newTitleFlag, "title", "t", "", "Title of the new instance")
+	newCmd.Flags().StringVarP(&programFlag, "program", "p", "",
+		"Program to run in the new instance, or the name of one in the programs config (defaults to the configured program)")
+	newCmd.Flags().StringVar(&newBaseFlag, "base", "", "Ref to create the instance's branch from (defaults to HEAD)")
+	newCmd.Flags().StringVar(&newSubdirFlag, "subdir", "",
+		"Directory within the worktree to start the program in (defaults to the worktree root)")
+
+	newCmd.Flags().StringVar(&newDiffBaseFlag, "diff-base", "",
+		"What the instance's diff is computed against: base, merge-base, last-commit or committed "+
+			"(defaults to the configured diff_base)")
+	newCmd.Flags().StringVar(&newSeedFlag, "seed", "",
+		"Directory whose contents are copied, uncommitted, into the new worktree before the program starts")
+	newCmd.Flags().BoolVar(&newDryRunFlag, "dry-run", false,
+		"Print the branch, worktree, tmux session and program the instance would get, without creating it")
+	newCmd.Flags().StringVar(&newAgentFlag, "agent", "", fmt.Sprintf(
+		"Agent whose prompts autoyes recognizes (%s); defaults to the one matching the program",
+		strings.Join(tmux.AgentNames(), ", ")))
+
+	newCmd.Flags().StringArrayVar(&newLabelFlags, "label", nil,
+		"Label to tag the instance with, e.g. for cs exec --label (repeatable)")
+	newCmd.Flags().StringArrayVar(&newEnvFlags, "env", nil,
+		"NAME=value variable to set for the instance's program, also when it's resumed (repeatable)")
+
+	// Repos command flags
+	reposCmd.Flags().BoolVar(&reposPrune, "prune", false,
+		"Remove the repositories that were deleted, moved or are no longer git repositories from the list")
+
+	newCmd.Flags().StringVar(&newWindowNameFlag, "window-name", "",
+		"Name of the instance's tmux window, where {title} and {branch} stand for the instance's "+
+			"(defaults to the configured window_name)")
+
+	// Clone command flags
+	cloneCmd.Flags().StringVarP(&cloneTitleFlag, "title", "t", "", "Title of the new instance")
+	cloneCmd.Flags().StringVar(&cloneBaseFlag, "base", "", "Ref to create the new instance's branch from (defaults to HEAD)")
+	cloneCmd.Flags().BoolVar(&cloneDryRunFlag, "dry-run", false,
+		"Print the branch, worktree, tmux session and program the instance would get, without creating it")
+
+	// Adopt command flags
+	adoptCmd.Flags().StringVarP(&adoptTitle, "title", "t", "",
+		"Title of the instance, instead of the one in the session's name (the session is renamed to match)")
+	adoptCmd.Flags().BoolVar(&adoptAll, "all", false, "Adopt every session that can be adopted")
+
+	// Compare command flags
+	compareCmd.Flags().BoolVar(&compareStatFlag, "stat", false, "Print a diffstat instead of the patch")
+	compareCmd.Flags().BoolVar(&compareMergeBaseFlag, "merge-base", false,
+		"Diff from the branches' merge base, showing only what the second instance changed")
+
+	// Kill command flags
+	killCmd.Flags().BoolVar(&killAllPaused, "all-paused", false, "Kill every paused instance")
+	killCmd.Flags().BoolVar(&killKeepBranch, "keep-branch", false, "Keep the branches of the killed instances")
+	killCmd.Flags().BoolVarP(&killYes, "yes", "y", false, "Don't ask for confirmation")
+	killCmd.Flags().BoolVar(&killIncludePinned, "include-pinned", false, "With --all-paused, kill pinned instances too")
+
+	// List command flags
+	whereCmd.Flags().BoolVar(&wherePathOnly, "path-only", false, "Only print the worktree path")
+	whereCmd.Flags().BoolVar(&whereJSON, "json", false, "Print the worktree path and branch as JSON")
+
+	listCmd.Flags().BoolVar(&listJSONFlag, "json", false, "Print instances as JSON")
+	listCmd.Flags().BoolVar(&listAllFlag, "all", false, "Include archived instances")
+	listCmd.Flags().BoolVar(&listNotesFlag, "notes", false, "Show the instances' notes")
+	listCmd.Flags().BoolVar(&listAbsoluteFlag, "absolute", false,
+		"Show exact creation and update times instead of how long ago they were (--json always has exact times)")
+
+	rootCmd.AddCommand(debugCmd)
+	rootCmd.AddCommand(selftestCmd)
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(resetCmd)
+	rootCmd.AddCommand(cleanupCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(archiveCmd)
+	rootCmd.AddCommand(killCmd)
+	rootCmd.AddCommand(pinCmd)
+	rootCmd.AddCommand(unpinCmd)
+	noteCmd.Flags().BoolVar(&noteClear, "clear", false, "Remove the instance's note")
+	rootCmd.AddCommand(noteCmd)
+	labelCmd.Flags().BoolVar(&labelClear, "clear", false, "Remove the instance's labels")
+	rootCmd.AddCommand(labelCmd)
+	rootCmd.AddCommand(newCmd)
+	rootCmd.AddCommand(cloneCmd)
+	rootCmd.AddCommand(adoptCmd)
+	rootCmd.AddCommand(repairCmd)
+	rootCmd.AddCommand(resumeAllCmd)
+	rootCmd.AddCommand(gcCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(fetchCmd)
+	rootCmd.AddCommand(reposCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(eventsCmd)
+	rootCmd.AddCommand(openCmd)
+	rootCmd.AddCommand(whereCmd)
+	rootCmd.AddCommand(squashCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(attachCmd)
+	rootCmd.AddCommand(envCmd)
+	rootCmd.AddCommand(gridCmd)
+	execCmd.Flags().IntVar(&execParallel, "parallel", 1, "Run the command in up to this many worktrees at once")
+	execCmd.Flags().StringArrayVar(&execLabels, "label", nil,
+		"Only run the command in the instances with this label (repeatable; they must have all of them)")
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(topCmd)
+	daemonStatusCmd.Flags().BoolVar(&daemonStatusJSON, "json", false, "Print the status as JSON")
+	daemonStatusCmd.Flags().BoolVar(&daemonStatusAbsolute, "absolute", false,
+		"Show the exact time of the last heartbeat instead of how long ago it was")
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonProbeCmd.Flags().DurationVar(&daemonProbeAge, "max-age", 30*time.Second,
+		"How old the daemon's last heartbeat may be")
+	daemonCmd.AddCommand(daemonProbeCmd)
+	daemonStartCmd.Flags().BoolVar(&daemonMonitor, "monitor", false,
+		"Only track diff stats; never accept prompts")
+	daemonCmd.AddCommand(daemonStartCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configCmd.AddCommand(configEditCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// createInstance creates an instance for cs new and cs clone, leaving its program running in a detached tmux session.
+// autoYes, if set, overrides the global autoyes setting for the instance. With dryRun, it only prints what the
+// instance would get.
+func createInstance(repoPath string, opts session.InstanceOptions, autoYes *bool, dryRun bool) error {
+	create := func() error {
+		cfg := config.LoadConfig()
+		state := config.LoadState(repoPath)
+		storage, err := session.NewStorage(state)
+		if err != nil {
+			return fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		instancesData, err := storage.LoadInstanceData()
+		if err != nil {
+			return fmt.Errorf("failed to load instances: %w", err)
+		}
+
+		active := session.CountActive(instancesData)
+		if active >= app.GlobalInstanceLimit {
+			return fmt.Errorf("you can't create more than %d instances", app.GlobalInstanceLimit)
+		}
+		if err := session.CheckInstanceLimit(active, cfg.MaxInstances); err != nil {
+			return err
+		}
+		if err := storage.CheckTitleAvailable(opts.Title); err != nil {
+			return err
+		}
+
+		instance, err := session.NewInstance(opts)
+		if err != nil {
+			return err
+		}
+		instance.AutoYesOverride = autoYes
+		if dryRun {
+			plan, err := instance.Plan()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Would create instance '%s'\n  branch:   %s (from %s)\n  worktree: %s\n",
+				instance.Title, plan.Branch, plan.BaseRef, plan.WorktreePath)
+			if plan.WorkDir != plan.WorktreePath {
+				fmt.Printf("  workdir:  %s\n", plan.WorkDir)
+			}
+			fmt.Printf("  tmux:     %s\n", plan.TmuxSession)
+			if plan.Window != "" {
+				fmt.Printf("  window:   %s\n", plan.Window)
+			}
+			fmt.Printf("  program:  %s (agent %s)\n", plan.Program, plan.Agent)
+			if len(opts.Env) > 0 {
+				// Only the names: the values may be secrets.
+				names := make([]string, len(opts.Env))
+				for i, variable := range opts.Env {
+					names[i], _, _ = strings.Cut(variable, "=")
+				}
+				fmt.Printf("  env:      %s\n", strings.Join(names, ", "))
+			}
+			if len(opts.Labels) > 0 {
+				fmt.Printf("  labels:   %s\n", strings.Join(opts.Labels, ", "))
+			}
+			if opts.SeedDir != "" {
+				fmt.Printf("  seed:     %s\n", opts.SeedDir)
+			}
+			if plan.PostCreateHook != "" {
+				fmt.Printf("  hook:     %s\n", plan.PostCreateHook)
+			}
+			return nil
+		}
+		if err := instance.Start(true); err != nil {
+			return err
+		}
+
+		instancesData = append(instancesData, instance.ToInstanceData())
+		if err := storage.SaveInstanceData(instancesData); err != nil {
+			if killErr := instance.Kill(); killErr != nil {
+				log.ErrorLog.Printf("failed to kill instance after save error: %v", killErr)
+			}
+			return fmt.Errorf("failed to save instance: %w", err)
+		}
+		instance.CreationSaved()
+		if err := config.RegisterRepo(repoPath); err != nil {
+			log.WarningLog.Printf("failed to register repo: %v", err)
+		}
+
+		// Leave the agent running in its tmux session.
+		if err := instance.Disconnect(); err != nil {
+			log.WarningLog.Printf("failed to disconnect from tmux session: %v", err)
+		}
+
+		worktree, err := instance.GetGitWorktree()
+		if err != nil {
+			return err
+		}
+		infof("Created instance '%s'\n  branch:   %s\n  worktree: %s\n",
+			instance.Title, instance.Branch, worktree.GetWorktreePath())
+		switch worktree.ExistingBranch() {
+		case config.OnExistingReuse:
+			infoln("  the branch already existed and was reused")
+		case config.OnExistingRecreate:
+			infoln("  the branch already existed and was recreated")
+		}
+		if skipped := instance.SkippedSeedFiles(); len(skipped) > 0 {
+			infof("  not seeded (ignored by git): %s\n", strings.Join(skipped, ", "))
+		}
+		return nil
+	}
+	if dryRun {
+		// A dry run doesn't change the state, so it doesn't need to wait for a running cs.
+		return create()
+	}
+	if err := cmd2.CheckTmux(); err != nil {
+		return err
+	}
+	return withRepoLock(repoPath, create)
+}
+
+// fetchResult is how an instance's branch compares with the default branch, as cs fetch reports it.
+type fetchResult struct {
+	// ahead and behind are the commit counts, or "-" if they couldn't be determined.
+	ahead, behind string
+	// rebase describes what --rebase did, including why it failed.
+	rebase string
+	// baseCommitSHA is the commit the branch forks from after --rebase rebased it, or empty if it didn't.
+	baseCommitSHA string
+	err           error
+}
+
+// fetchInstance compares the instance's branch with target, fetching origin in the instance's clone first if it has
+// one, and with rebase, rebases the branch onto target if it's behind.
+func fetchInstance(repoPath string, data session.InstanceData, target string, rebase bool) fetchResult {
+	result := fetchResult{ahead: "-", behind: "-"}
+	fail := func(err error) fetchResult {
+		result.err = err
+		result.rebase = err.Error()
+		return result
+	}
+
+	worktree := git.NewGitWorktreeFromStorage(
+		data.Worktree.RepoPath,
+		data.Worktree.WorktreePath,
+		data.Worktree.SessionName,
+		data.Worktree.BranchName,
+		data.Worktree.BaseCommitSHA,
+		data.Worktree.IsolationMode,
+	)
+	hasWorktree := data.Status != session.Paused
+	if _, err := os.Stat(data.Worktree.WorktreePath); err != nil {
+		hasWorktree = false
+	}
+	if hasWorktree && data.Worktree.IsolationMode == config.IsolationClone {
+		if err := git.FetchRemote(data.Worktree.WorktreePath); err != nil {
+			return fail(err)
+		}
+	}
+
+	ahead, behind, err := worktree.AheadBehind(target)
+	if err != nil {
+		return fail(err)
+	}
+	result.ahead, result.behind = strconv.Itoa(ahead), strconv.Itoa(behind)
+	if !rebase {
+		return result
+	}
+	switch {
+	case behind == 0:
+		result.rebase = "up to date"
+		return result
+	case !hasWorktree:
+		result.rebase = "paused, not rebased"
+		return result
+	}
+
+	// Another process may be attached to the instance or squashing it.
+	instanceLock, err := lock.AcquireInstanceLock(repoPath, data.Title)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() {
+		if err := instanceLock.Release(); err != nil {
+			log.ErrorLog.Printf("failed to release instance lock: %v", err)
+		}
+	}()
+	if err := worktree.Rebase(target); err != nil {
+		return fail(err)
+	}
+	result.rebase = "rebased"
+	result.baseCommitSHA = worktree.GetBaseCommitSHA()
+	if ahead, behind, err := worktree.AheadBehind(target); err == nil {
+		result.ahead, result.behind = strconv.Itoa(ahead), strconv.Itoa(behind)
+	}
+	return result
+}
+
+// execInWorktrees runs command in the worktree of each instance, at most parallel at a time, and prints each
+// instance's output under its title once the command finishes there. Returns an error naming the instances the
+// command failed in.
+func execInWorktrees(instancesData []session.InstanceData, command []string, parallel int) error {
+	type result struct {
+		output []byte
+		err    error
+	}
+	results := make([]chan result, len(instancesData))
+	sem := make(chan struct{}, parallel)
+	for i, data := range instancesData {
+		results[i] = make(chan result, 1)
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			execCmd := exec.Command(command[0], command[1:]...)
+			execCmd.Dir = data.Worktree.WorktreePath
+			execCmd.Env = append(os.Environ(),
+				"CLAUDE_SQUAD_INSTANCE="+data.Title,
+				"CLAUDE_SQUAD_BRANCH="+data.Branch,
+			)
+			if plainOutput() {
+				execCmd.Env = append(execCmd.Env, "NO_COLOR=1")
+			}
+			output, err := execCmd.CombinedOutput()
+			results[i] <- result{output: output, err: err}
+		}()
+	}
+
+	// Print in the instances' order, whatever order they finish in.
+	var failed []string
+	for i, data := range instancesData {
+		res := <-results[i]
+		fmt.Printf("==> %s (%s)\n", data.Title, data.Worktree.WorktreePath)
+		if plainOutput() {
+			// Not every program honors NO_COLOR.
+			res.output = []byte(humanize.StripEscapes(string(res.output)))
+		}
+		os.Stdout.Write(res.output)
+		if len(res.output) > 0 && res.output[len(res.output)-1] != '\n' {
+			fmt.Println()
+		}
+		if res.err != nil {
+			fmt.Printf("==> %s failed: %v\n", data.Title, res.err)
+			failed = append(failed, data.Title)
+		}
+	}
+
+	fmt.Printf("\nRan in %d instance(s), %d failed.\n", len(instancesData), len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("command failed in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runMergeHook runs the configured merge hook for a merged instance. Failures are reported but don't stop cs sync.
+func runMergeHook(hook string, data *session.InstanceData) {
+	hookCmd := exec.Command("sh", "-c", hook)
+	hookCmd.Dir = data.Worktree.RepoPath
+	hookCmd.Env = append(os.Environ(),
+		"CLAUDE_SQUAD_INSTANCE="+data.Title,
+		"CLAUDE_SQUAD_BRANCH="+data.Branch,
+	)
+	hookCmd.Stdout = os.Stdout
+	hookCmd.Stderr = os.Stderr
+	if err := hookCmd.Run(); err != nil {
+		fmt.Printf("Merge hook failed for instance '%s': %v\n", data.Title, err)
+		log.ErrorLog.Printf("merge hook failed for instance %s: %v", data.Title, err)
+	}
+}
+
+// gcArtifact is something cs gc found left behind in a repository.
+type gcArtifact struct {
+	kind   string
+	path   string
+	remove func() error
+}
+
+// findGCArtifacts lists the orphaned artifacts of a repository. The caller must hold the repo lock.
+func findGCArtifacts(repoPath string) ([]gcArtifact, error) {
+	var artifacts []gcArtifact
+	addFiles := func(kind string, paths []string) {
+		for _, path := range paths {
+			artifacts = append(artifacts, gcArtifact{kind: kind, path: path, remove: func() error {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to remove %s: %w", path, err)
+				}
+				return nil
+			}})
+		}
+	}
+
+	daemonFiles, err := daemon.StaleFiles(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	addFiles("dead daemon", daemonFiles)
+
+	lockFiles, err := lock.StaleInstanceLocks(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	addFiles("stale lock", lockFiles)
+
+	stateFiles, err := config.LeftoverStateFiles(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	addFiles("old state", stateFiles)
+
+	storage, err := session.NewStorage(config.LoadState(repoPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load instances: %w", err)
+	}
+	inUse := make([]string, 0, len(instancesData))
+	for _, data := range instancesData {
+		inUse = append(inUse, data.Worktree.WorktreePath)
+	}
+	worktrees, err := git.OrphanedWorktrees(repoPath, inUse)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range worktrees {
+		artifacts = append(artifacts, gcArtifact{kind: "orphaned worktree", path: path, remove: func() error {
+			return git.RemoveOrphanedWorktree(repoPath, path)
+		}})
+	}
+
+	return artifacts, nil
+}
+
+// printDaemonStatus prints a human-readable daemon status, with the last heartbeat relative to now unless absolute is
+// set.
+func printDaemonStatus(status *daemon.Status, absolute bool) {
+	switch {
+	case status.Running:
+		uptime := time.Duration(status.UptimeSeconds) * time.Second
+		fmt.Printf("Daemon:         running (PID %d, up %s)\n", status.PID, uptime)
+	case status.Stale:
+		fmt.Printf("Daemon:         not running (stale PID file for PID %d)\n", status.PID)
+	default:
+		fmt.Println("Daemon:         not running")
+	}
+	fmt.Printf("Instances:      %d\n", status.Instances)
+	if status.LastHeartbeat != nil {
+		fmt.Printf("Last heartbeat: %s\n", humanize.Time(*status.LastHeartbeat, time.Now(), absolute))
+	}
+}
+
+// withRepoLock runs fn holding the repository lock. Commands that change the state take it because a running cs
+// would overwrite their changes on exit. Fails with a *lock.LockHeldError, without running fn, if another cs holds it.
+func withRepoLock(repoPath string, fn func() error) error {
+	repoLock, err := lock.AcquireLock(repoPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := repoLock.Release(); err != nil {
+			log.ErrorLog.Printf("failed to release lock: %v", err)
+		}
+	}()
+	return fn()
+}
+
+// repoLocked returns true if another cs process holds the repository lock.
+func repoLocked(repoPath string) bool {
+	l, err := lock.AcquireLock(repoPath)
+	if err != nil {
+		var held *lock.LockHeldError
+		return errors.As(err, &held)
+	}
+	if err := l.Release(); err != nil {
+		log.ErrorLog.Printf("failed to release lock: %v", err)
+	}
+	return false
+}
+
+// parseSince parses a --since value: a duration ago (e.g. 10m) or an RFC3339 timestamp. An empty value gives the zero
+// time.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use a duration like 10m or an RFC3339 timestamp", value)
+}
+
+// getRepoPath returns the canonical path of the git repository the command operates on: the one given with
+// --repo, or the one containing the current directory.
+func getRepoPath() (string, error) {
+	if repoFlag != "" {
+		dir, err := filepath.Abs(repoFlag)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve --repo path: %w", err)
+		}
+		if !git.IsGitRepo(dir) {
+			return "", fmt.Errorf("error: %s is %w", repoFlag, git.ErrNotGitRepo)
+		}
+		return canonicalRepoPath(dir)
+	}
+
+	currentDir, err := filepath.Abs(".")
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	if !git.IsGitRepo(currentDir) {
+		return "", fmt.Errorf("error: must be run from within a git repository (or pass --repo): %w", git.ErrNotGitRepo)
+	}
+	return canonicalRepoPath(currentDir)
+}
+
+// worktreeRedirectNoted is whether canonicalRepoPath already said it's using an instance worktree's repository, so
+// commands that resolve the repository more than once say so once.
+var worktreeRedirectNoted bool
+
+func canonicalRepoPath(dir string) (string, error) {
+	// Inside an instance's worktree, operate on the repository it belongs to rather than nesting a second state
+	// directory in the worktree.
+	if repoPath, ok := git.ManagedWorktreeRepo(dir); ok {
+		if !worktreeRedirectNoted {
+			noticef("Note: %s is the worktree of a claude-squad instance; using its repository %s\n", dir, repoPath)
+			worktreeRedirectNoted = true
+		}
+		dir = repoPath
+	}
+	repoPath, err := config.GetCanonicalRepoPath(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get canonical repo path: %w", err)
+	}
+	return repoPath, nil
+}
+
+// checkRepo returns why a repository in the global index is dead, or "" if it's still a git repository. A
+// repository that can't be checked, e.g. for lack of permissions, isn't considered dead.
+func checkRepo(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "missing"
+		}
+		return ""
+	}
+	if !info.IsDir() || !git.IsGitRepo(path) {
+		return "not a git repo"
+	}
+	return ""
+}
+
+// envNameRegex matches the environment variable names cs new --env accepts.
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseLabels checks the given labels, dropping duplicates. Labels can't be empty or contain whitespace or
+// commas, so they print unambiguously.
+func parseLabels(labels []string) ([]string, error) {
+	var parsed []string
+	for _, label := range labels {
+		if label == "" || strings.ContainsFunc(label, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			return nil, fmt.Errorf("invalid label %q: labels can't be empty or contain whitespace or commas", label)
+		}
+		if !slices.Contains(parsed, label) {
+			parsed = append(parsed, label)
+		}
+	}
+	return parsed, nil
+}
+
+// editorCommand returns the command to open files with: the editor from the config file, or $EDITOR.
+func editorCommand() string {
+	if editor := config.LoadConfig().Editor; editor != "" {
+		return editor
+	}
+	return os.Getenv("EDITOR")
+}
+
+// plainOutput reports whether command output should be printed without styling, because of --plain or
+// NO_COLOR (see https://no-color.org).
+func plainOutput() bool {
+	return plainFlag || os.Getenv("NO_COLOR") != ""
+}
+
+// infof prints progress and confirmations, which --quiet suppresses. Results, e.g. what cs list lists or --json
+// output, and warnings are printed regardless.
+func infof(format string, a ...any) {
+	if !quietFlag {
+		fmt.Printf(format, a...)
+	}
+}
+
+// infoln is infof for a line.
+func infoln(a ...any) {
+	if !quietFlag {
+		fmt.Println(a...)
+	}
+}
+
+// noticef is infof for notes about how the command runs rather than what it did. They go to stderr so they don't mix
+// with results, e.g. --json output.
+func noticef(format string, a ...any) {
+	if !quietFlag {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+// reloadDaemon has the repository's running daemon reload its instances after a command removed or changed some, so
+// it doesn't keep polling them. The command itself succeeded, so a failure is only a warning.
+func reloadDaemon(repoPath string) {
+	if err := daemon.ReloadDaemon(repoPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// safeModeNoop reports that safe mode kept a command from doing what it was asked to, e.g. "nothing was removed".
+// With --quiet, the report wouldn't be seen, so it's returned as an error instead, failing the command.
+func safeModeNoop(what string) error {
+	if quietFlag {
+		return fmt.Errorf("%w, so %s", config.ErrSafeMode, what)
+	}
+	fmt.Printf("Safe mode is on, so %s.\n", what)
+	return nil
+}
+
+// pickInstance lets the user choose one of the attachable instances. Returns empty data if the user cancelled.
+func pickInstance(storage *session.Storage) (session.InstanceData, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return session.InstanceData{}, fmt.Errorf("no instance title given and stdin is not a terminal: pass the title")
+	}
+
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return session.InstanceData{}, fmt.Errorf("failed to load instances: %w", err)
+	}
+	var candidates []session.InstanceData
+	var items []string
+	for _, data := range instancesData {
+		if data.Archived || data.Status == session.Paused {
+			continue
+		}
+		candidates = append(candidates, data)
+		items = append(items, fmt.Sprintf("%s (%s)", data.Title, data.Branch))
+	}
+	if len(candidates) == 0 {
+		return session.InstanceData{}, fmt.Errorf("no running instances to attach to")
+	}
+
+	idx, err := app.Pick("Attach to which instance?", items)
+	if err != nil || idx < 0 {
+		return session.InstanceData{}, err
+	}
+	return candidates[idx], nil
+}
+
+// recreateInstances resumes the given paused instances, recreating their worktrees and tmux sessions
+func recreateInstances(storage *session.Storage, titles []string) error {
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+
+	var errs []error
+	for _, title := range titles {
+		for i, data := range instancesData {
+			if data.Title != title {
+				continue
+			}
+			instance, err := session.FromInstanceData(data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to load instance %s: %w", title, err))
+				break
+			}
+			if err := instance.Resume(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to recreate instance %s: %w", title, err))
+				break
+			}
+			// Leave the agent running in its tmux session.
+			if err := instance.Disconnect(); err != nil {
+				log.WarningLog.Printf("failed to disconnect from tmux session: %v", err)
+			}
+			instancesData[i] = instance.ToInstanceData()
+			infof("Recreated instance '%s'\n", title)
+			break
+		}
+	}
+
+	if err := storage.SaveInstanceData(instancesData); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save instances: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// printInstanceOutput prints the last maxLines lines of an instance's tmux pane, or its whole scrollback if
+// maxLines is 0.
+func printInstanceOutput(title string, maxLines int) error {
+	log.Initialize(false)
+	defer log.Close()
+
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return err
+	}
+	storage, err := session.NewStorage(config.LoadState(repoPath))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	data, err := storage.FindInstanceData(title)
+	if err != nil {
+		return err
+	}
+	if data.Status == session.Paused || data.Archived {
+		return fmt.Errorf("instance '%s' has no running session", title)
+	}
+
+	tmuxSession := tmux.NewTmuxSession(data.Title, data.Program, data.Path)
+	if !tmuxSession.DoesSessionExist() {
+		return fmt.Errorf("tmux session of instance '%s' is gone: recreate it with cs resume-all", title)
+	}
+	output, err := tmuxSession.CaptureHistory(maxLines)
+	if err != nil {
+		return err
+	}
+	fmt.Print(output)
+	return nil
+}
+
+// resumeAllInstances recreates the tmux sessions of the stored running instances whose session is gone and
+// reports what it did.
+func resumeAllInstances(repoPath string, storage *session.Storage) error {
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+
+	var errs []error
+	var recreated, running int
+	for i, data := range instancesData {
+		if data.Status == session.Paused || data.Archived {
+			continue
+		}
+		if tmux.NewTmuxSession(data.Title, data.Program, data.Path).DoesSessionExist() {
+			running++
+			continue
+		}
+
+		// Another process may be attached to the instance or squashing it.
+		instanceLock, err := lock.AcquireInstanceLock(repoPath, data.Title)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = func() error {
+			instance, err := session.FromInstanceData(data)
+			if err != nil {
+				return fmt.Errorf("failed to load instance %s: %w", data.Title, err)
+			}
+			if err := instance.Recreate(); err != nil {
+				return fmt.Errorf("failed to recreate instance %s: %w", data.Title, err)
+			}
+			// Leave the agent running in its tmux session.
+			if err := instance.Disconnect(); err != nil {
+				log.WarningLog.Printf("failed to disconnect from tmux session: %v", err)
+			}
+			instancesData[i] = instance.ToInstanceData()
+			return nil
+		}()
+		if releaseErr := instanceLock.Release(); releaseErr != nil {
+			log.ErrorLog.Printf("failed to release instance lock: %v", releaseErr)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		recreated++
+		infof("Recreated instance '%s' running %s\n", data.Title, data.Program)
 	}
-	err = rootCmd.Flags().MarkHidden("repo-path")
-	if err != nil {
-		panic(err)
+
+	if recreated > 0 {
+		if err := storage.SaveInstanceData(instancesData); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save instances: %w", err))
+		}
 	}
+	infof("Recreated %d instance(s), %d already running.\n", recreated, running)
+	return errors.Join(errs...)
+}
 
-	// Cleanup command flags
-	cleanupCmd.Flags().BoolVar(&cleanupKillAll, "kill-all", false, "Kill all claude-squad sessions without prompting")
+// printInstanceSummaries prints the summaries as a table, with their notes if showNotes is set, and with when the
+// instances were created and last updated relative to now unless absolute is set.
+func printInstanceSummaries(summaries []session.InstanceSummary, showNotes bool, absolute bool) {
+	if len(summaries) == 0 {
+		fmt.Println("No instances found")
+		return
+	}
 
-	rootCmd.AddCommand(debugCmd)
-	rootCmd.AddCommand(versionCmd)
-	rootCmd.AddCommand(resetCmd)
-	rootCmd.AddCommand(cleanupCmd)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "TITLE\tSTATUS\tPROGRAM\tBRANCH\tADDED\tREMOVED\tFILES\tCREATED\tUPDATED"
+	if showNotes {
+		header += "\tNOTES"
+	}
+	fmt.Fprintln(w, header)
+	now := time.Now()
+	for _, s := range summaries {
+		status := s.Status
+		if s.Archived {
+			status = "archived"
+		}
+		if s.Merged {
+			status += " (merged)"
+		}
+		title := s.Title
+		if s.Pinned {
+			title += " [pinned]"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t+%d\t-%d\t%d\t%s\t%s",
+			title, status, s.Program, s.Branch, s.Added, s.Removed, s.FilesChanged,
+			humanize.Time(s.CreatedAt, now, absolute), humanize.Time(s.UpdatedAt, now, absolute))
+		if showNotes {
+			// Keep each instance on one line of the table.
+			fmt.Fprintf(w, "\t%s", strings.Join(strings.Fields(s.Notes), " "))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
 }
 
 // findClaudeSquadSessions returns a list of all claude-squad tmux sessions
@@ -282,77 +3146,499 @@ func groupSessionsByHash(sessions []string) map[string][]string {
 
 // getSessionRepoPath queries tmux for the repo path stored in the session environment
 func getSessionRepoPath(sessionName string) (string, error) {
-	cmd := exec.Command("tmux", "show-environment", "-t", sessionName, "CLAUDE_SQUAD_REPO")
+	return getSessionEnv(sessionName, "CLAUDE_SQUAD_REPO")
+}
+
+// getSessionProgram queries tmux for the program stored in the session environment
+func getSessionProgram(sessionName string) (string, error) {
+	return getSessionEnv(sessionName, "CLAUDE_SQUAD_PROGRAM")
+}
+
+// sessionEnvVar is a variable set in a tmux session environment
+type sessionEnvVar struct {
+	Name  string
+	Value string
+}
+
+// getSessionEnv reads a variable from the tmux session environment
+func getSessionEnv(sessionName, name string) (string, error) {
+	cmd := exec.Command("tmux", "show-environment", "-t", sessionName, name)
 	output, err := cmd2.MakeExecutor().Output(cmd)
 	if err != nil {
 		return "", err
 	}
 
-	// Parse "CLAUDE_SQUAD_REPO=<path>" format
-	parts := strings.SplitN(string(output), "=", 2)
-	if len(parts) != 2 {
+	vars := parseSessionEnv(string(output))
+	if len(vars) != 1 || vars[0].Name != name {
 		return "", fmt.Errorf("unexpected environment variable format")
 	}
-
-	return strings.TrimSpace(parts[1]), nil
+	return vars[0].Value, nil
 }
 
-// cleanupOrphanedSessions lists sessions and identifies orphaned ones using tmux env vars
-func cleanupOrphanedSessions() error {
-	sessions, err := findClaudeSquadSessions()
+// getSessionEnvAll reads every variable set in the tmux session environment
+func getSessionEnvAll(sessionName string) ([]sessionEnvVar, error) {
+	cmd := exec.Command("tmux", "show-environment", "-t", sessionName)
+	output, err := cmd2.MakeExecutor().Output(cmd)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return parseSessionEnv(string(output)), nil
+}
 
-	if len(sessions) == 0 {
-		fmt.Println("No claude-squad tmux sessions found")
-		return nil
+// parseSessionEnv parses the "NAME=<value>" lines printed by tmux show-environment. Lines of the form "-NAME"
+// mark variables removed from the session environment and are skipped.
+func parseSessionEnv(output string) []sessionEnvVar {
+	var vars []sessionEnvVar
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "-") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		vars = append(vars, sessionEnvVar{Name: parts[0], Value: strings.TrimSpace(parts[1])})
 	}
+	return vars
+}
+
+// tmuxDefaultEnv lists the variables tmux copies into every session through its default update-environment
+// option. Anything else in a session environment was set for that session specifically.
+var tmuxDefaultEnv = map[string]bool{
+	"DISPLAY":              true,
+	"KRB5CCNAME":           true,
+	"SSH_ASKPASS":          true,
+	"SSH_AUTH_SOCK":        true,
+	"SSH_AGENT_PID":        true,
+	"SSH_CONNECTION":       true,
+	"WINDOWID":             true,
+	"XAUTHORITY":           true,
+	"TERM":                 true,
+	"TERM_PROGRAM":         true,
+	"TERM_PROGRAM_VERSION": true,
+	"COLORTERM":            true,
+}
+
+// cleanupSession is a claude-squad tmux session found by cs cleanup
+type cleanupSession struct {
+	Name     string `json:"name"`
+	RepoPath string `json:"repo_path,omitempty"`
+	Program  string `json:"program"`
+}
+
+// cleanupReport groups the claude-squad tmux sessions by whether their repository still exists
+type cleanupReport struct {
+	// Active sessions belong to a repository that still exists.
+	Active []cleanupSession `json:"active"`
+	// Orphaned sessions belong to a repository that no longer exists.
+	Orphaned []cleanupSession `json:"orphaned"`
+	// Unknown sessions were created before the repository was tracked in the session environment.
+	Unknown []cleanupSession `json:"unknown"`
+}
 
-	// Categorize sessions
-	type SessionInfo struct {
-		name     string
-		repoPath string
-		status   string // "active", "orphaned", or "unknown"
+// categorizeSessions lists the claude-squad tmux sessions and identifies orphaned ones using tmux env vars
+func categorizeSessions() (*cleanupReport, error) {
+	sessions, err := findClaudeSquadSessions()
+	if err != nil {
+		return nil, err
 	}
 
-	var infos []SessionInfo
+	report := &cleanupReport{
+		Active:   []cleanupSession{},
+		Orphaned: []cleanupSession{},
+		Unknown:  []cleanupSession{},
+	}
 	for _, sess := range sessions {
+		// Sessions created before the program was tracked don't have it
+		program, err := getSessionProgram(sess)
+		if err != nil {
+			program = "(unknown)"
+		}
+
 		repoPath, err := getSessionRepoPath(sess)
 		if err != nil {
 			// Can't get repo path - old session or error
-			infos = append(infos, SessionInfo{name: sess, repoPath: "(unknown)", status: "unknown"})
+			report.Unknown = append(report.Unknown, cleanupSession{Name: sess, Program: program})
 			continue
 		}
 
 		// Check if repo path still exists
+		info := cleanupSession{Name: sess, RepoPath: repoPath, Program: program}
 		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-			infos = append(infos, SessionInfo{name: sess, repoPath: repoPath, status: "orphaned"})
+			report.Orphaned = append(report.Orphaned, info)
 		} else {
-			infos = append(infos, SessionInfo{name: sess, repoPath: repoPath, status: "active"})
+			report.Active = append(report.Active, info)
+		}
+	}
+	return report, nil
+}
+
+// adoptCandidate is a claude-squad tmux session of the repository that no stored instance owns.
+type adoptCandidate struct {
+	Session string
+	// Title is the title the session's instance gets: the one in the session's name, unless --title overrides it.
+	Title string
+}
+
+// sessionTitleRegex matches the title part of claude-squad tmux session names.
+var sessionTitleRegex = regexp.MustCompile(`^claudesquad_[a-f0-9]{8}_(.+)$`)
+
+// findAdoptableSessions returns the repository's claude-squad tmux sessions that none of the stored instances owns.
+// Sessions belong to the repository recorded in their environment or, for sessions from before it was recorded, to
+// the one whose hash is in their name.
+func findAdoptableSessions(repoPath string, instancesData []session.InstanceData) ([]adoptCandidate, error) {
+	sessions, err := findClaudeSquadSessions()
+	if err != nil {
+		return nil, err
+	}
+	repoHash, err := config.GetRepoHash(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repo hash: %w", err)
+	}
+	owned := make(map[string]bool)
+	for _, data := range instancesData {
+		owned[tmux.SessionName(data.Title, repoPath)] = true
+	}
+
+	var candidates []adoptCandidate
+	for _, sess := range sessions {
+		if owned[sess] {
+			continue
+		}
+		if sessionRepo, err := getSessionRepoPath(sess); err == nil {
+			if sessionRepo != repoPath {
+				continue
+			}
+		} else if !strings.HasPrefix(sess, tmux.TmuxPrefix+repoHash+"_") {
+			continue
+		}
+		title := sess
+		if match := sessionTitleRegex.FindStringSubmatch(sess); match != nil {
+			title = match[1]
+		}
+		candidates = append(candidates, adoptCandidate{Session: sess, Title: title})
+	}
+	return candidates, nil
+}
+
+// adoptSession returns the stored data of an instance for the candidate's session, running in the worktree the
+// session's pane is in, which none of the stored instances may use. The session is renamed if the instance's title
+// calls for another name, and gets the environment of the sessions cs starts.
+func adoptSession(repoPath string, instancesData []session.InstanceData, candidate adoptCandidate) (session.InstanceData, error) {
+	if err := session.CheckTitleAvailable(candidate.Title, instancesData); err != nil {
+		return session.InstanceData{}, err
+	}
+	panePath, err := tmuxSessionFormat(candidate.Session, "#{pane_current_path}")
+	if err != nil {
+		return session.InstanceData{}, fmt.Errorf("failed to get the directory of session %s: %w", candidate.Session, err)
+	}
+	worktree, err := git.AdoptWorktree(repoPath, panePath, candidate.Title)
+	if err != nil {
+		return session.InstanceData{}, err
+	}
+	// Killing the instance removes its worktree and branch, which would pull them from under their instance.
+	for _, other := range instancesData {
+		if other.Worktree.WorktreePath == worktree.GetWorktreePath() {
+			return session.InstanceData{}, fmt.Errorf("worktree %s belongs to instance %s", worktree.GetWorktreePath(),
+				other.Title)
+		}
+		if other.Worktree.BranchName == worktree.GetBranchName() {
+			return session.InstanceData{}, fmt.Errorf("branch %s belongs to instance %s", worktree.GetBranchName(),
+				other.Title)
+		}
+	}
+	// The pane's current command is whatever runs in the foreground, e.g. a shell the program started, so it's no
+	// substitute for the program the session was started with.
+	program, err := getSessionProgram(candidate.Session)
+	if err != nil || program == "" {
+		return session.InstanceData{}, fmt.Errorf("session %s doesn't record the program it runs", candidate.Session)
+	}
+	created := time.Now()
+	if value, err := tmuxSessionFormat(candidate.Session, "#{session_created}"); err == nil {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			created = time.Unix(seconds, 0)
+		}
+	}
+
+	name := tmux.SessionName(candidate.Title, repoPath)
+	if name != candidate.Session {
+		renameCmd := exec.Command("tmux", "rename-session", "-t", candidate.Session, name)
+		if err := cmd2.MakeExecutor().Run(renameCmd); err != nil {
+			return session.InstanceData{}, fmt.Errorf("failed to rename session %s to %s: %w", candidate.Session, name, err)
+		}
+	}
+	for _, env := range []sessionEnvVar{{"CLAUDE_SQUAD_REPO", repoPath}, {"CLAUDE_SQUAD_PROGRAM", program}} {
+		if err := cmd2.MakeExecutor().Run(exec.Command("tmux", "setenv", "-t", name, env.Name, env.Value)); err != nil {
+			log.WarningLog.Printf("failed to set %s for session %s: %v", env.Name, name, err)
+		}
+	}
+
+	return session.InstanceData{
+		Title:        candidate.Title,
+		Path:         repoPath,
+		Branch:       worktree.GetBranchName(),
+		Status:       session.Running,
+		CreatedAt:    created,
+		UpdatedAt:    time.Now(),
+		RunningSince: created,
+		Started:      true,
+		Program:      program,
+		Worktree: session.GitWorktreeData{
+			RepoPath:      worktree.GetRepoPath(),
+			WorktreePath:  worktree.GetWorktreePath(),
+			SessionName:   candidate.Title,
+			BranchName:    worktree.GetBranchName(),
+			BaseCommitSHA: worktree.GetBaseCommitSHA(),
+			IsolationMode: worktree.GetIsolationMode(),
+		},
+	}, nil
+}
+
+// tmuxSessionFormat expands a tmux format, e.g. "#{pane_current_path}", for the session's active pane.
+func tmuxSessionFormat(sessionName, format string) (string, error) {
+	output, err := cmd2.MakeExecutor().Output(exec.Command("tmux", "display-message", "-p", "-t", sessionName, format))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// selftestStep is one step of cs selftest.
+type selftestStep struct {
+	name string
+	run  func() error
+}
+
+// selftestTitle is the title of the instance cs selftest runs.
+const selftestTitle = "selftest"
+
+// runSelftest runs the steps of cs selftest in a temporary repository, printing the outcome of each, and tears
+// everything down afterwards. The steps share the repository and the instance, so a failed step skips the rest.
+func runSelftest() error {
+	if err := config.CheckSafeMode("running the self-test"); err != nil {
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp("", "cs-selftest-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	// The repository path is hashed into tmux session names, so it has to be the canonical one.
+	if tempDir, err = filepath.EvalSymlinks(tempDir); err != nil {
+		return fmt.Errorf("failed to resolve temporary directory: %w", err)
+	}
+	repoPath := filepath.Join(tempDir, "repo")
+
+	var (
+		repoLock *lock.Lock
+		storage  *session.Storage
+		instance *session.Instance
+		worktree string
+		killed   bool
+	)
+	defer func() {
+		if instance != nil && !killed {
+			if err := instance.Kill(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to kill the self-test instance: %v\n", err)
+			}
 		}
+		if repoLock != nil {
+			if err := repoLock.Release(); err != nil {
+				log.ErrorLog.Printf("failed to release lock: %v", err)
+			}
+		}
+		if err := os.RemoveAll(tempDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", tempDir, err)
+		}
+	}()
+
+	steps := []selftestStep{
+		{"tmux is installed", func() error {
+			if err := cmd2.CheckTmux(); err != nil {
+				return err
+			}
+			if v, err := tmux.InstalledVersion(); err == nil {
+				if missing := v.MissingFeatures(); len(missing) > 0 {
+					return fmt.Errorf("tmux %s lacks %s, which needs tmux %s or later", v, missing[0].Name,
+						missing[0].Since)
+				}
+			}
+			return nil
+		}},
+		{"create a git repository", func() error {
+			if err := os.Mkdir(repoPath, 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("cs selftest\n"), 0644); err != nil {
+				return err
+			}
+			// Commit with an identity of our own, so a machine without one configured still passes.
+			for _, args := range [][]string{
+				{"init", "-q"},
+				{"add", "README.md"},
+				{"-c", "user.name=cs selftest", "-c", "user.email=selftest@localhost", "commit", "-q", "-m", "selftest"},
+			} {
+				gitCmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+				if output, err := gitCmd.CombinedOutput(); err != nil {
+					return fmt.Errorf("git %s: %s (%w)", args[0], strings.TrimSpace(string(output)), err)
+				}
+			}
+			return nil
+		}},
+		{"lock the repository", func() error {
+			if repoLock, err = lock.AcquireLock(repoPath); err != nil {
+				return err
+			}
+			// The lock must keep out everyone else, including another handle in this process.
+			if second, err := lock.AcquireLock(repoPath); err == nil {
+				_ = second.Release()
+				return fmt.Errorf("the lock could be taken twice")
+			}
+			return nil
+		}},
+		{"start an instance", func() error {
+			instance, err = session.NewInstance(session.InstanceOptions{
+				Title:   selftestTitle,
+				Path:    repoPath,
+				Program: "sh",
+			})
+			if err != nil {
+				return err
+			}
+			return instance.Start(true)
+		}},
+		{"check its tmux session", func() error {
+			if !instance.TmuxAlive() {
+				return fmt.Errorf("tmux session %s doesn't exist", tmux.SessionName(selftestTitle, repoPath))
+			}
+			return nil
+		}},
+		{"check its worktree", func() error {
+			gitWorktree, err := instance.GetGitWorktree()
+			if err != nil {
+				return err
+			}
+			worktree = gitWorktree.GetWorktreePath()
+			if _, err := os.Stat(filepath.Join(worktree, "README.md")); err != nil {
+				return fmt.Errorf("worktree %s isn't checked out: %w", worktree, err)
+			}
+			return nil
+		}},
+		{"save it and reattach", func() error {
+			if storage, err = session.NewStorage(config.LoadState(repoPath)); err != nil {
+				return err
+			}
+			if err := storage.SaveInstances([]*session.Instance{instance}); err != nil {
+				return err
+			}
+			if err := instance.Disconnect(); err != nil {
+				return err
+			}
+			// Loading restores the instance, attaching a new client to its session.
+			instances, err := storage.LoadInstances()
+			if err != nil {
+				return err
+			}
+			if len(instances) != 1 || instances[0].Title != selftestTitle {
+				return fmt.Errorf("expected to load instance '%s', got %d instances", selftestTitle, len(instances))
+			}
+			instance = instances[0]
+			if _, err := instance.Preview(); err != nil {
+				return fmt.Errorf("failed to capture its pane: %w", err)
+			}
+			return nil
+		}},
+		{"check the diff stats", func() error {
+			if err := os.WriteFile(filepath.Join(worktree, "selftest.txt"), []byte("one\ntwo\n"), 0644); err != nil {
+				return err
+			}
+			if err := instance.UpdateDiffStats(); err != nil {
+				return err
+			}
+			if stats := instance.GetDiffStats(); stats == nil || stats.Added != 2 || stats.Removed != 0 {
+				return fmt.Errorf("expected +2 -0, got %+v", stats)
+			}
+			return nil
+		}},
+		{"kill it", func() error {
+			killed = true
+			if err := instance.Kill(); err != nil {
+				return err
+			}
+			if instance.TmuxAlive() {
+				return fmt.Errorf("its tmux session is still running")
+			}
+			if _, err := os.Stat(worktree); err == nil {
+				return fmt.Errorf("its worktree %s is still there", worktree)
+			}
+			return nil
+		}},
 	}
 
-	// Group by status
-	var active, orphaned, unknown []SessionInfo
-	for _, info := range infos {
-		switch info.status {
-		case "active":
-			active = append(active, info)
-		case "orphaned":
-			orphaned = append(orphaned, info)
-		case "unknown":
-			unknown = append(unknown, info)
+	failed := false
+	for _, step := range steps {
+		if failed {
+			fmt.Printf("  skip  %s\n", step.name)
+			continue
+		}
+		if err := step.run(); err != nil {
+			fmt.Printf("  FAIL  %s: %v\n", step.name, err)
+			failed = true
+			continue
 		}
+		fmt.Printf("  ok    %s\n", step.name)
+	}
+	if failed {
+		return fmt.Errorf("self-test failed")
+	}
+	infoln("Self-test passed.")
+	return nil
+}
+
+// errOrphanedSessions is returned by cs cleanup --fail-on-orphans when orphaned sessions are found
+var errOrphanedSessions = errors.New("orphaned sessions found")
+
+// printCleanupReportJSON prints the categorized sessions as JSON. With failOnOrphans, it returns an error if any
+// session is orphaned.
+func printCleanupReportJSON(failOnOrphans bool) error {
+	report, err := categorizeSessions()
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sessions: %w", err)
+	}
+	fmt.Println(string(out))
+	if failOnOrphans && len(report.Orphaned) > 0 {
+		return fmt.Errorf("%w: %d", errOrphanedSessions, len(report.Orphaned))
+	}
+	return nil
+}
+
+// cleanupOrphanedSessions lists sessions and identifies orphaned ones using tmux env vars. Unless failOnOrphans is
+// set, it offers to kill the orphaned ones; with it, finding any is an error instead.
+func cleanupOrphanedSessions(failOnOrphans bool) error {
+	report, err := categorizeSessions()
+	if err != nil {
+		return err
+	}
+	active, orphaned, unknown := report.Active, report.Orphaned, report.Unknown
+	total := len(active) + len(orphaned) + len(unknown)
+
+	if total == 0 {
+		fmt.Println("No claude-squad tmux sessions found")
+		return nil
 	}
 
 	// Display results
-	fmt.Printf("Found %d claude-squad session(s):\n\n", len(sessions))
+	fmt.Printf("Found %d claude-squad session(s):\n\n", total)
 
 	if len(active) > 0 {
 		fmt.Printf("Active sessions (%d):\n", len(active))
 		for _, info := range active {
-			fmt.Printf("  - %s\n    repo: %s\n", info.name, info.repoPath)
+			fmt.Printf("  - %s\n    repo: %s\n    program: %s\n", info.Name, info.RepoPath, info.Program)
 		}
 		fmt.Println()
 	}
@@ -360,7 +3646,7 @@ func cleanupOrphanedSessions() error {
 	if len(unknown) > 0 {
 		fmt.Printf("Unknown sessions (%d) - created before repo tracking:\n", len(unknown))
 		for _, info := range unknown {
-			fmt.Printf("  - %s\n", info.name)
+			fmt.Printf("  - %s\n    program: %s\n", info.Name, info.Program)
 		}
 		fmt.Println()
 	}
@@ -376,11 +3662,18 @@ func cleanupOrphanedSessions() error {
 	// Found orphaned sessions - ask user
 	fmt.Printf("Orphaned sessions (%d) - repository no longer exists:\n", len(orphaned))
 	for _, info := range orphaned {
-		fmt.Printf("  - %s\n    repo: %s (not found)\n", info.name, info.repoPath)
+		fmt.Printf("  - %s\n    repo: %s (not found)\n    program: %s\n", info.Name, info.RepoPath, info.Program)
 	}
 	fmt.Println()
 
-	fmt.Print("Kill orphaned sessions? [y/N]: ")
+	if failOnOrphans {
+		return fmt.Errorf("%w: %d", errOrphanedSessions, len(orphaned))
+	}
+	if config.SafeModeEnabled() {
+		return safeModeNoop("the orphaned sessions can't be killed")
+	}
+
+	fmt.Fprint(os.Stderr, "Kill orphaned sessions? [y/N]: ")
 	var response string
 	fmt.Scanln(&response)
 
@@ -390,17 +3683,17 @@ func cleanupOrphanedSessions() error {
 	}
 
 	// Kill orphaned sessions
-	fmt.Println("\nKilling orphaned sessions...")
-	for _, info := range orphaned {
-		fmt.Printf("  Killing: %s\n", info.name)
-		killCmd := exec.Command("tmux", "kill-session", "-t", info.name)
+	infoln("\nKilling orphaned sessions...")
+	for i, info := range orphaned {
+		infof("  Killing session %d/%d: %s\n", i+1, len(orphaned), info.Name)
+		killCmd := exec.Command("tmux", "kill-session", "-t", info.Name)
 		if err := cmd2.MakeExecutor().Run(killCmd); err != nil {
-			log.WarningLog.Printf("failed to kill session %s: %v", info.name, err)
-			fmt.Printf("  Warning: Failed to kill %s\n", info.name)
+			log.WarningLog.Printf("failed to kill session %s: %v", info.Name, err)
+			fmt.Printf("  Warning: Failed to kill %s\n", info.Name)
 		}
 	}
 
-	fmt.Println("\nCleanup complete!")
+	infoln("\nCleanup complete!")
 	return nil
 }
 
@@ -416,9 +3709,154 @@ func killAllClaudeSquadSessions() error {
 		return nil
 	}
 
-	fmt.Printf("Killing %d session(s)...\n", len(sessions))
+	repoPaths := make(map[string]bool)
+	for _, sess := range sessions {
+		if repoPath, err := getSessionRepoPath(sess); err == nil {
+			repoPaths[repoPath] = true
+		}
+	}
+	if !cleanupIncludePinned {
+		pinned := make(map[string]bool)
+		for repoPath := range repoPaths {
+			for name := range pinnedSessionNames(repoPath) {
+				pinned[name] = true
+			}
+		}
+		if sessions = skipPinnedSessions(sessions, pinned); len(sessions) == 0 {
+			fmt.Println("No sessions to clean up")
+			return nil
+		}
+	}
+
+	// Other repos aren't locked, so a running cs elsewhere will lose its instances.
+	fmt.Println("Warning: this kills sessions of every repository, including active instances of running cs processes.")
+	fmt.Println("Use --repo-only to only kill the current repository's sessions.")
+	if err := killSessions(sessions); err != nil {
+		return err
+	}
+	// Otherwise the repositories' running daemons keep polling the killed sessions.
+	for repoPath := range repoPaths {
+		if _, err := os.Stat(repoPath); err == nil {
+			reloadDaemon(repoPath)
+		}
+	}
+	return nil
+}
+
+// setPinned pins or unpins an instance of the current repository.
+func setPinned(title string, pinned bool) error {
+	log.Initialize(false)
+	defer log.Close()
+
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return err
+	}
+
+	return withRepoLock(repoPath, func() error {
+		storage, err := session.NewStorage(config.LoadState(repoPath))
+		if err != nil {
+			return fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		if err := storage.SetPinned(title, pinned); err != nil {
+			return err
+		}
+		if pinned {
+			infof("Instance '%s' has been pinned\n", title)
+		} else {
+			infof("Instance '%s' has been unpinned\n", title)
+		}
+		return nil
+	})
+}
+
+// pinnedSessionNames returns the tmux session names of the pinned instances of the repository. Repositories that
+// no longer exist have none.
+func pinnedSessionNames(repoPath string) map[string]bool {
+	names := make(map[string]bool)
+	if _, err := os.Stat(repoPath); err != nil {
+		return names
+	}
+	storage, err := session.NewStorage(config.LoadState(repoPath))
+	if err != nil {
+		return names
+	}
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		log.WarningLog.Printf("failed to load instances of %s: %v", repoPath, err)
+		return names
+	}
+	for _, data := range instancesData {
+		if data.Pinned {
+			names[tmux.NewTmuxSession(data.Title, data.Program, data.Path).Name()] = true
+		}
+	}
+	return names
+}
+
+// skipPinnedSessions returns the sessions not in pinned, telling the user about the ones it leaves out.
+func skipPinnedSessions(sessions []string, pinned map[string]bool) []string {
+	var kept []string
 	for _, sess := range sessions {
-		fmt.Printf("  Killing: %s\n", sess)
+		if pinned[sess] {
+			infof("Skipping session of pinned instance: %s\n", sess)
+			continue
+		}
+		kept = append(kept, sess)
+	}
+	if len(kept) < len(sessions) {
+		infoln("Pass --include-pinned to kill them too.")
+	}
+	return kept
+}
+
+// killRepoClaudeSquadSessions kills the sessions of the current repository while holding its lock, so it can't race
+// with a cs instance that is creating sessions.
+func killRepoClaudeSquadSessions() error {
+	repoPath, err := getRepoPath()
+	if err != nil {
+		return err
+	}
+
+	return withRepoLock(repoPath, func() error {
+		repoHash, err := config.GetRepoHash(repoPath)
+		if err != nil {
+			return fmt.Errorf("failed to get repo hash: %w", err)
+		}
+
+		sessions, err := findClaudeSquadSessions()
+		if err != nil {
+			return err
+		}
+		repoSessions := groupSessionsByHash(sessions)[repoHash]
+		if !cleanupIncludePinned {
+			repoSessions = skipPinnedSessions(repoSessions, pinnedSessionNames(repoPath))
+		}
+
+		if len(repoSessions) == 0 {
+			infoln("No sessions to clean up")
+			return nil
+		}
+		if err := killSessions(repoSessions); err != nil {
+			return err
+		}
+		// Otherwise a running daemon keeps polling the killed sessions.
+		reloadDaemon(repoPath)
+		return nil
+	})
+}
+
+// killSessions kills the given tmux sessions, warning about the ones that couldn't be killed
+func killSessions(sessions []string) error {
+	if config.SafeModeEnabled() {
+		for _, sess := range sessions {
+			infof("  - %s\n", sess)
+		}
+		return safeModeNoop(fmt.Sprintf("these %d session(s) were not killed", len(sessions)))
+	}
+	infof("Killing %d session(s)...\n", len(sessions))
+	for i, sess := range sessions {
+		infof("  Killing session %d/%d: %s\n", i+1, len(sessions), sess)
 		killCmd := exec.Command("tmux", "kill-session", "-t", sess)
 		if err := cmd2.MakeExecutor().Run(killCmd); err != nil {
 			log.WarningLog.Printf("failed to kill session %s: %v", sess, err)
@@ -426,12 +3864,13 @@ func killAllClaudeSquadSessions() error {
 		}
 	}
 
-	fmt.Println("\nCleanup complete!")
+	infoln("\nCleanup complete!")
 	return nil
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,175 @@
+package session
+
+import (
+	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"claude-squad/session/tmux"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// creationMarkersDirName is the directory in the state directory holding the markers of instances being created.
+const creationMarkersDirName = "creating"
+
+// creationMarker records that an instance's worktree is being created. It outlives a crash between creating the
+// worktree and saving the instance, so the next cs can tell such a worktree apart from those of saved instances (see
+// RecoverInterruptedCreations). Creation and recovery both hold the repository lock, so they never overlap.
+type creationMarker struct {
+	Title         string    `json:"title"`
+	WorktreePath  string    `json:"worktree_path"`
+	BranchName    string    `json:"branch_name"`
+	IsolationMode string    `json:"isolation_mode,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// creationMarkerPath returns the path of the marker of the worktree. Worktree directory names are unique, unlike
+// titles, which a later instance may reuse.
+func creationMarkerPath(repoPath, worktreePath string) (string, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get state directory: %w", err)
+	}
+	return filepath.Join(stateDir, creationMarkersDirName, filepath.Base(worktreePath)+".json"), nil
+}
+
+// writeCreationMarker records that the instance's worktree is being created.
+func (i *Instance) writeCreationMarker() error {
+	path, err := creationMarkerPath(i.Path, i.gitWorktree.GetWorktreePath())
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(creationMarker{
+		Title:         i.Title,
+		WorktreePath:  i.gitWorktree.GetWorktreePath(),
+		BranchName:    i.gitWorktree.GetBranchName(),
+		IsolationMode: i.gitWorktree.GetIsolationMode(),
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal creation marker: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create creation markers directory: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// CreationSaved is called once a newly started instance has been saved, so its creation can no longer be
+// interrupted. Markers it isn't called for are cleaned up by RecoverInterruptedCreations.
+func (i *Instance) CreationSaved() {
+	if i.gitWorktree != nil {
+		i.removeCreationMarker()
+	}
+}
+
+// removeCreationMarker removes the marker of the instance's worktree, e.g. once a failed creation was cleaned up.
+func (i *Instance) removeCreationMarker() {
+	path, err := creationMarkerPath(i.Path, i.gitWorktree.GetWorktreePath())
+	if err == nil {
+		err = os.Remove(path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.WarningLog.Printf("failed to remove creation marker of %s: %v", i.Title, err)
+	}
+}
+
+// InterruptedCreation is an instance whose creation stopped, e.g. because cs crashed, after its worktree was created
+// but before the instance was saved.
+type InterruptedCreation struct {
+	Title        string
+	WorktreePath string
+	// SessionRunning is true if the instance's program was already running in its tmux session. The worktree is
+	// then left alone, so the session can be turned into an instance with cs adopt.
+	SessionRunning bool
+	// SafeMode is true if the worktree was left alone because safe mode is on. It's recovered again once it's off.
+	SafeMode bool
+}
+
+// RecoverInterruptedCreations undoes the creations of the repository's instances that were interrupted before the
+// instance was saved: their worktree is removed unless their tmux session is running or safe mode is on, keeping the
+// branch in case it holds work. A clone's branch is pushed back to the repository first. Markers of creations that
+// completed are cleaned up. It must be called with the repository lock held,
+// so no creation is under way. Saved instances whose worktree is missing are left to RepairInstances.
+func (s *Storage) RecoverInterruptedCreations(repoPath string) ([]InterruptedCreation, error) {
+	stateDir, err := config.GetStateDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state directory: %w", err)
+	}
+	markersDir := filepath.Join(stateDir, creationMarkersDirName)
+	entries, err := os.ReadDir(markersDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read creation markers: %w", err)
+	}
+
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[string]bool, len(instancesData))
+	for _, data := range instancesData {
+		saved[filepath.Clean(data.Worktree.WorktreePath)] = true
+	}
+
+	var interrupted []InterruptedCreation
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(markersDir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return interrupted, fmt.Errorf("failed to read creation marker %s: %w", path, err)
+		}
+		var marker creationMarker
+		if err := json.Unmarshal(content, &marker); err != nil || marker.WorktreePath == "" {
+			log.WarningLog.Printf("removing unreadable creation marker %s: %v", path, err)
+			_ = os.Remove(path)
+			continue
+		}
+
+		if !saved[filepath.Clean(marker.WorktreePath)] {
+			if _, err := os.Stat(marker.WorktreePath); err == nil {
+				creation := InterruptedCreation{Title: marker.Title, WorktreePath: marker.WorktreePath}
+				creation.SessionRunning = tmux.NewTmuxSession(marker.Title, "", repoPath).DoesSessionExist()
+				if !creation.SessionRunning {
+					err := config.CheckSafeMode("removing worktree " + marker.WorktreePath)
+					creation.SafeMode = err != nil
+					if !creation.SafeMode {
+						if err := removeInterruptedWorktree(repoPath, marker); err != nil {
+							return interrupted, err
+						}
+					}
+				}
+				log.WarningLog.Printf("creation of instance %s was interrupted: %+v", marker.Title, creation)
+				interrupted = append(interrupted, creation)
+				if creation.SafeMode {
+					// Keep the marker, so the worktree is removed once safe mode is off.
+					continue
+				}
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return interrupted, fmt.Errorf("failed to remove creation marker %s: %w", path, err)
+		}
+	}
+	return interrupted, nil
+}
+
+// removeInterruptedWorktree removes the worktree of an interrupted creation, keeping its branch.
+func removeInterruptedWorktree(repoPath string, marker creationMarker) error {
+	if marker.IsolationMode != config.IsolationClone {
+		return git.RemoveOrphanedWorktree(repoPath, marker.WorktreePath)
+	}
+	// The clone's commits exist nowhere else until its branch is pushed back.
+	clone := git.NewGitWorktreeFromStorage(repoPath, marker.WorktreePath, marker.Title, marker.BranchName, "",
+		marker.IsolationMode)
+	return clone.Remove()
+}
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"claude-squad/config"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// AdoptWorktree returns the GitWorktree of an existing worktree of the repository at repoPath: the one containing
+// path, e.g. the directory a tmux session left by an older cs runs in. sessionName is the title of the instance
+// adopting it. The worktree must be a linked worktree in the repository's worktree directory with a branch checked
+// out, since killing the instance removes both. Its base commit is taken to be the branch's merge base with the repository's HEAD.
+func AdoptWorktree(repoPath, path, sessionName string) (*GitWorktree, error) {
+	g := &GitWorktree{repoPath: repoPath, sessionName: sessionName, isolationMode: config.IsolationWorktree}
+	toplevel, err := g.runGitCommand(path, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git worktree: %w", path, err)
+	}
+	g.worktreePath = strings.TrimSpace(toplevel)
+
+	output, err := g.runGitCommand(repoPath, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+	// Worktrees are listed as blocks of lines, the repository's own working tree first.
+	found := false
+	for i, block := range strings.Split(strings.TrimSpace(output), "\n\n") {
+		lines := strings.Split(block, "\n")
+		if lines[0] != "worktree "+g.worktreePath {
+			continue
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("%s is the repository itself, not one of its worktrees", g.worktreePath)
+		}
+		found = true
+		for _, line := range lines[1:] {
+			if branch, ok := strings.CutPrefix(line, "branch refs/heads/"); ok {
+				g.branchName = branch
+			}
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not a worktree of %s", g.worktreePath, repoPath)
+	}
+	// Worktrees elsewhere weren't created by cs, and killing the instance would delete someone's checkout.
+	worktreeDir, err := worktreeDirectory(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(worktreeDir, g.worktreePath); err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("%s is not in the worktree directory %s", g.worktreePath, worktreeDir)
+	}
+	if g.branchName == "" {
+		return nil, fmt.Errorf("worktree %s has no branch checked out", g.worktreePath)
+	}
+
+	base, err := g.runGitCommand(repoPath, "merge-base", "HEAD", g.branchName)
+	if err != nil {
+		// The branch shares no history with HEAD: count its changes from its tip on.
+		if base, err = g.runGitCommand(repoPath, "rev-parse", g.branchName); err != nil {
+			return nil, fmt.Errorf("failed to find the base commit of branch %s: %w", g.branchName, err)
+		}
+	}
+	g.baseCommitSHA = strings.TrimSpace(base)
+	return g, nil
+}
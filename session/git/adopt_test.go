@@ -0,0 +1,56 @@
+package git
+
+import (
+	"claude-squad/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdoptWorktree(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	base := strings.TrimSpace(runGit(t, repoPath, "rev-parse", "HEAD"))
+	worktreesDir, err := getWorktreeDirectory(repoPath)
+	require.NoError(t, err)
+
+	_, err = AdoptWorktree(repoPath, repoPath, "task")
+	require.ErrorContains(t, err, "the repository itself")
+
+	worktree := filepath.Join(worktreesDir, "task_1")
+	runGit(t, repoPath, "worktree", "add", "-q", "-b", "test/task", worktree)
+	runGit(t, worktree, "commit", "-q", "--allow-empty", "-m", "work")
+	require.NoError(t, os.Mkdir(filepath.Join(worktree, "sub"), 0755))
+	g, err := AdoptWorktree(repoPath, filepath.Join(worktree, "sub"), "task")
+	require.NoError(t, err)
+	require.Equal(t, worktree, g.GetWorktreePath())
+	require.Equal(t, "test/task", g.GetBranchName())
+	require.Equal(t, base, g.GetBaseCommitSHA())
+	require.Equal(t, config.IsolationWorktree, g.GetIsolationMode())
+
+	detached := filepath.Join(worktreesDir, "detached_1")
+	runGit(t, repoPath, "worktree", "add", "-q", "--detach", detached)
+	_, err = AdoptWorktree(repoPath, detached, "detached")
+	require.ErrorContains(t, err, "no branch checked out")
+
+	outside := filepath.Join(repoPath, "..", filepath.Base(repoPath)+"-outside")
+	runGit(t, repoPath, "worktree", "add", "-q", "-b", "test/outside", outside)
+	_, err = AdoptWorktree(repoPath, outside, "outside")
+	require.ErrorContains(t, err, "not in the worktree directory")
+
+	other, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	runGit(t, other, "init", "-q")
+	_, err = AdoptWorktree(repoPath, other, "other")
+	require.ErrorContains(t, err, "not a worktree of")
+}
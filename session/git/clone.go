@@ -0,0 +1,59 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cloneSourceRemote is the remote of a clone that points back at the repository it was cloned from. The clone's
+// origin points at the repository's own origin so pushing works the same as from a worktree.
+const cloneSourceRemote = "source"
+
+// setupClone creates a local clone of the repository instead of a worktree. If the branch already exists in the
+// repository (e.g. when resuming a paused instance), the clone checks it out; otherwise a new branch is created.
+func (g *GitWorktree) setupClone(branchExists bool) error {
+	// Clean up any leftover clone first
+	if err := os.RemoveAll(g.worktreePath); err != nil {
+		return fmt.Errorf("failed to remove existing clone: %w", err)
+	}
+
+	if _, err := g.runGitCommand(g.repoPath, "clone", "--origin", cloneSourceRemote, "--no-checkout", g.repoPath, g.worktreePath); err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	if originURL, err := g.runGitCommand(g.repoPath, "remote", "get-url", "origin"); err == nil {
+		if _, err := g.runGitCommand(g.worktreePath, "remote", "add", "origin", strings.TrimSpace(originURL)); err != nil {
+			return fmt.Errorf("failed to add origin remote to clone: %w", err)
+		}
+	}
+
+	if branchExists {
+		if _, err := g.runGitCommand(g.worktreePath, "checkout", "-b", g.branchName, cloneSourceRemote+"/"+g.branchName); err != nil {
+			return fmt.Errorf("failed to check out branch %s in clone: %w", g.branchName, err)
+		}
+		return nil
+	}
+
+	baseCommit, err := g.resolveBaseCommit()
+	if err != nil {
+		return err
+	}
+	g.baseCommitSHA = baseCommit
+
+	if _, err := g.runGitCommand(g.worktreePath, "checkout", "-b", g.branchName, baseCommit); err != nil {
+		return fmt.Errorf("failed to create branch %s in clone: %w", g.branchName, err)
+	}
+	return nil
+}
+
+// removeClone pushes the branch back to the repository so it survives, then deletes the clone.
+func (g *GitWorktree) removeClone() error {
+	if _, err := g.runGitCommand(g.worktreePath, "push", "--force", cloneSourceRemote, g.branchName); err != nil {
+		return fmt.Errorf("failed to push branch %s back to the repository: %w", g.branchName, err)
+	}
+	if err := os.RemoveAll(g.worktreePath); err != nil {
+		return fmt.Errorf("failed to remove clone: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package git
+
+import (
+	"claude-squad/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// runGit runs a git command in dir and fails the test if it errors
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, output)
+	return string(output)
+}
+
+func TestCloneIsolationLifecycle(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "README"), []byte("hello\n"), 0644))
+	runGit(t, repoPath, "add", ".")
+	runGit(t, repoPath, "commit", "-q", "-m", "initial")
+
+	clonePath := filepath.Join(t.TempDir(), "clone")
+	tree := NewGitWorktreeFromStorage(repoPath, clonePath, "task", "test/task", "", config.IsolationClone)
+
+	require.NoError(t, tree.Setup())
+	require.NotEmpty(t, tree.GetBaseCommitSHA())
+
+	// A clone has its own .git directory rather than a worktree's .git file.
+	info, err := os.Stat(filepath.Join(clonePath, ".git"))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+
+	// Commit in the clone, then pause: the branch must survive in the repository.
+	require.NoError(t, os.WriteFile(filepath.Join(clonePath, "change.txt"), []byte("change\n"), 0644))
+	require.NoError(t, tree.CommitChanges("agent work"))
+	require.NoError(t, tree.Remove())
+	_, err = os.Stat(clonePath)
+	require.True(t, os.IsNotExist(err))
+	runGit(t, repoPath, "rev-parse", "--verify", "test/task")
+
+	// Resuming checks the branch out again with the agent's work.
+	require.NoError(t, tree.Setup())
+	_, err = os.Stat(filepath.Join(clonePath, "change.txt"))
+	require.NoError(t, err)
+
+	require.NoError(t, tree.Cleanup())
+	_, err = os.Stat(clonePath)
+	require.True(t, os.IsNotExist(err))
+}
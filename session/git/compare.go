@@ -0,0 +1,63 @@
+package git
+
+import (
+	"claude-squad/config"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CompareBranches returns the git diff from the tip of the branch of worktree a to the tip of the branch of worktree b,
+// e.g. to compare the work of two instances given the same task. With mergeBase set, it's the diff from the merge
+// base of the branches to b instead (git diff a...b): only what b changed since they diverged. With stat set, it's
+// a diffstat instead of the patch. The diff is run in a's repository.
+func CompareBranches(a, b *GitWorktree, mergeBase, stat bool) (string, error) {
+	var revs [2]string
+	for i, g := range []*GitWorktree{a, b} {
+		rev, err := g.branchTip(a.repoPath)
+		if err != nil {
+			return "", err
+		}
+		revs[i] = rev
+	}
+
+	args := []string{"-C", a.repoPath, "--no-pager", "diff"}
+	if stat {
+		args = append(args, "--stat")
+	}
+	if mergeBase {
+		args = append(args, revs[0]+"..."+revs[1])
+	} else {
+		args = append(args, revs[0], revs[1])
+	}
+	output, err := exec.Command("git", append(args, "--")...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s and %s: %s (%w)", a.branchName, b.branchName, output, err)
+	}
+	return string(output), nil
+}
+
+// branchTip returns the commit at the tip of the worktree's branch, for use in the repository at repoPath. A clone
+// only pushes its branch back to the repository when it's removed, so while it exists, its tip is fetched from it.
+func (g *GitWorktree) branchTip(repoPath string) (string, error) {
+	if g.isolationMode == config.IsolationClone {
+		if _, err := os.Stat(g.worktreePath); err == nil {
+			if _, err := g.runGitCommand(repoPath, "fetch", "--quiet", "--no-tags", g.worktreePath,
+				"refs/heads/"+g.branchName); err != nil {
+				return "", fmt.Errorf("failed to fetch branch %s from its clone: %w", g.branchName, err)
+			}
+			rev, err := g.runGitCommand(repoPath, "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+			if err != nil {
+				return "", fmt.Errorf("failed to fetch branch %s from its clone: %w", g.branchName, err)
+			}
+			return strings.TrimSpace(rev), nil
+		}
+	}
+	// The full ref name, so a branch can't be mistaken for a commit or a file.
+	rev, err := g.runGitCommand(repoPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+g.branchName+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("branch %s doesn't exist in %s", g.branchName, repoPath)
+	}
+	return strings.TrimSpace(rev), nil
+}
@@ -0,0 +1,66 @@
+package git
+
+import (
+	"claude-squad/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareBranches(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	initial := strings.TrimSpace(runGit(t, repoPath, "rev-parse", "HEAD"))
+	// Both branches start from the initial commit.
+	commitFile := func(branch, name, content string) {
+		runGit(t, repoPath, "checkout", "-q", "-B", branch, initial)
+		require.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0644))
+		runGit(t, repoPath, "add", name)
+		runGit(t, repoPath, "commit", "-q", "-m", branch)
+	}
+	commitFile("agent/a", "a.txt", "from a\n")
+	commitFile("agent/b", "b.txt", "from b\n")
+
+	branch := func(name string) *GitWorktree {
+		return NewGitWorktreeFromStorage(repoPath, filepath.Join(repoPath, "missing"), name, name, initial,
+			config.IsolationWorktree)
+	}
+	a, b := branch("agent/a"), branch("agent/b")
+
+	diff, err := CompareBranches(a, b, false, false)
+	require.NoError(t, err)
+	require.Contains(t, diff, "-from a")
+	require.Contains(t, diff, "+from b")
+
+	// From the merge base, a's changes don't show.
+	diff, err = CompareBranches(a, b, true, false)
+	require.NoError(t, err)
+	require.NotContains(t, diff, "a.txt")
+	require.Contains(t, diff, "+from b")
+
+	stat, err := CompareBranches(a, b, false, true)
+	require.NoError(t, err)
+	require.Contains(t, stat, "2 files changed")
+
+	_, err = CompareBranches(a, branch("agent/missing"), false, false)
+	require.ErrorContains(t, err, "branch agent/missing doesn't exist")
+
+	// A clone's branch is compared as it is in the clone, which hasn't pushed it back yet.
+	clonePath := filepath.Join(t.TempDir(), "clone")
+	runGit(t, repoPath, "clone", "-q", "--origin", cloneSourceRemote, "--branch", "agent/b", repoPath, clonePath)
+	require.NoError(t, os.WriteFile(filepath.Join(clonePath, "b.txt"), []byte("from the clone\n"), 0644))
+	runGit(t, clonePath, "commit", "-q", "-am", "clone work")
+	clone := NewGitWorktreeFromStorage(repoPath, clonePath, "agent/b", "agent/b", initial, config.IsolationClone)
+	diff, err = CompareBranches(a, clone, true, false)
+	require.NoError(t, err)
+	require.Contains(t, diff, "+from the clone")
+}
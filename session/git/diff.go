@@ -1,6 +1,8 @@
 package git
 
 import (
+	"claude-squad/config"
+	"fmt"
 	"strings"
 )
 
@@ -12,6 +14,8 @@ type DiffStats struct {
 	Added int
 	// Removed is the number of removed lines
 	Removed int
+	// FilesChanged is the number of files touched by the diff
+	FilesChanged int
 	// Error holds any error that occurred during diff computation
 	// This allows propagating setup errors (like missing base commit) without breaking the flow
 	Error error
@@ -21,7 +25,7 @@ func (d *DiffStats) IsEmpty() bool {
 	return d.Added == 0 && d.Removed == 0 && d.Content == ""
 }
 
-// Diff returns the git diff between the worktree and the base branch along with statistics
+// Diff returns the git diff between the worktree and its diff base (see SetDiffBase) along with statistics
 func (g *GitWorktree) Diff() *DiffStats {
 	stats := &DiffStats{}
 
@@ -32,14 +36,23 @@ func (g *GitWorktree) Diff() *DiffStats {
 		return stats
 	}
 
-	content, err := g.runGitCommand(g.worktreePath, "--no-pager", "diff", g.GetBaseCommitSHA())
+	diffArgs, err := g.diffArgs()
+	if err != nil {
+		stats.Error = err
+		return stats
+	}
+	args := append([]string{"--no-pager", "diff"}, diffArgs...)
+	args = append(args, g.diffPathspecs()...)
+	content, err := g.runGitCommand(g.worktreePath, args...)
 	if err != nil {
 		stats.Error = err
 		return stats
 	}
 	lines := strings.Split(content, "\n")
 	for _, line := range lines {
-		if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
+		if strings.HasPrefix(line, "diff --git ") {
+			stats.FilesChanged++
+		} else if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
 			stats.Added++
 		} else if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
 			stats.Removed++
@@ -49,3 +62,41 @@ func (g *GitWorktree) Diff() *DiffStats {
 
 	return stats
 }
+
+// diffArgs returns the git diff arguments that compare against the worktree's diff base.
+func (g *GitWorktree) diffArgs() ([]string, error) {
+	switch g.diffBase {
+	case config.DiffBaseMergeBase:
+		target, err := RemoteDefaultBranch(g.repoPath)
+		if err != nil {
+			// Without a remote, the commit the instance started from is the best approximation.
+			return []string{g.GetBaseCommitSHA()}, nil
+		}
+		mergeBase, err := g.runGitCommand(g.worktreePath, "merge-base", "HEAD", target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find merge base with %s: %w", target, err)
+		}
+		return []string{strings.TrimSpace(mergeBase)}, nil
+	case config.DiffBaseLastCommit:
+		return []string{"HEAD~1"}, nil
+	case config.DiffBaseCommitted:
+		return []string{g.GetBaseCommitSHA(), "HEAD"}, nil
+	default:
+		return []string{g.GetBaseCommitSHA()}, nil
+	}
+}
+
+// diffPathspecs returns the pathspec arguments that leave the ignored paths out of the diff, or none if nothing is
+// ignored.
+func (g *GitWorktree) diffPathspecs() []string {
+	if len(g.diffIgnore) == 0 {
+		return nil
+	}
+	pathspecs := []string{"--", "."}
+	for _, pattern := range g.diffIgnore {
+		if pattern != "" {
+			pathspecs = append(pathspecs, ":(exclude)"+pattern)
+		}
+	}
+	return pathspecs
+}
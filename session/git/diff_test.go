@@ -0,0 +1,70 @@
+package git
+
+import (
+	"claude-squad/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffBase(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	baseCommit := strings.TrimSpace(runGit(t, repoPath, "rev-parse", "HEAD"))
+
+	tree := NewGitWorktreeFromStorage(repoPath, repoPath, "task", "", baseCommit, "")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(name+"\n"), 0644))
+		require.NoError(t, tree.CommitChanges("add "+name))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "c.txt"), []byte("c\n"), 0644))
+
+	for diffBase, files := range map[string]int{
+		config.DiffBaseCommit:     3,
+		config.DiffBaseLastCommit: 2,
+		config.DiffBaseCommitted:  2,
+	} {
+		tree.SetDiffBase(diffBase)
+		stats := tree.Diff()
+		require.NoError(t, stats.Error, diffBase)
+		require.Equal(t, files, stats.FilesChanged, diffBase)
+	}
+}
+
+func TestDiffIgnore(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	baseCommit := strings.TrimSpace(runGit(t, repoPath, "rev-parse", "HEAD"))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(repoPath, "dist"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "main.go"), []byte("package main\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "package-lock.json"), []byte("{\n}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "dist", "app.js"), []byte("a\nb\nc\n"), 0644))
+
+	tree := NewGitWorktreeFromStorage(repoPath, repoPath, "task", "", baseCommit, "")
+	stats := tree.Diff()
+	require.NoError(t, stats.Error)
+	require.Equal(t, 3, stats.FilesChanged)
+
+	tree.SetDiffIgnore([]string{"package-lock.json", "dist/**"})
+	stats = tree.Diff()
+	require.NoError(t, stats.Error)
+	require.Equal(t, 1, stats.FilesChanged)
+	require.Equal(t, 1, stats.Added)
+	require.NotContains(t, stats.Content, "package-lock.json")
+}
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"claude-squad/config"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RebaseConflictError is returned by Rebase when the branch doesn't rebase cleanly. The rebase has been aborted.
+type RebaseConflictError struct {
+	Target string
+	// Files are the files that conflicted.
+	Files []string
+}
+
+func (e *RebaseConflictError) Error() string {
+	return fmt.Sprintf("rebasing onto %s conflicts in %s, so it was aborted", e.Target, strings.Join(e.Files, ", "))
+}
+
+// AheadBehind counts the commits the branch has that target doesn't (ahead), and the ones target has that the branch
+// doesn't (behind). A clone is compared in the clone itself, so its origin should have been fetched there.
+func (g *GitWorktree) AheadBehind(target string) (ahead int, behind int, err error) {
+	path, rev := g.repoPath, g.branchName
+	if g.isolationMode == config.IsolationClone {
+		if _, err := os.Stat(g.worktreePath); err == nil {
+			path, rev = g.worktreePath, "HEAD"
+		}
+	}
+	output, err := g.runGitCommand(path, "rev-list", "--left-right", "--count", rev+"..."+target)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compare %s with %s: %w", g.branchName, target, err)
+	}
+	counts := strings.Fields(output)
+	if len(counts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output: %q", output)
+	}
+	if ahead, err = strconv.Atoi(counts[0]); err != nil {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output: %q", output)
+	}
+	if behind, err = strconv.Atoi(counts[1]); err != nil {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output: %q", output)
+	}
+	return ahead, behind, nil
+}
+
+// Rebase rebases the worktree's branch onto target, setting uncommitted changes aside meanwhile, and moves the base
+// commit to where the branch now forks from target. If it conflicts, the rebase is aborted, leaving the worktree as
+// it was, and a *RebaseConflictError lists the conflicting files.
+func (g *GitWorktree) Rebase(target string) error {
+	// Unlike cs's own commits, the rebased ones are the user's, so they're committed as the user, not commit_author.
+	_, err := g.runGitCommand(g.worktreePath, "rebase", "--autostash", target)
+	if err == nil {
+		base, err := g.runGitCommand(g.worktreePath, "merge-base", "HEAD", target)
+		if err != nil {
+			return fmt.Errorf("rebased onto %s, but failed to find the new base commit: %w", target, err)
+		}
+		g.baseCommitSHA = strings.TrimSpace(base)
+		return nil
+	}
+
+	output, diffErr := g.runGitCommand(g.worktreePath, "diff", "--name-only", "--diff-filter=U")
+	if _, abortErr := g.runGitCommand(g.worktreePath, "rebase", "--abort"); abortErr != nil {
+		// Nothing to abort means the rebase didn't even start, e.g. because target doesn't exist.
+		return fmt.Errorf("failed to rebase onto %s: %w", target, err)
+	}
+	if output = strings.TrimSpace(output); diffErr == nil && output != "" {
+		return &RebaseConflictError{Target: target, Files: strings.Split(output, "\n")}
+	}
+	return fmt.Errorf("failed to rebase onto %s: %w", target, err)
+}
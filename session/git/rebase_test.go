@@ -0,0 +1,67 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebase(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("a\n"), 0644))
+	runGit(t, repoPath, "add", "a.txt")
+	runGit(t, repoPath, "commit", "-q", "-m", "initial")
+
+	newTree := func(branch string, file string) *GitWorktree {
+		worktreePath := filepath.Join(t.TempDir(), branch)
+		runGit(t, repoPath, "worktree", "add", "-q", "-b", branch, worktreePath)
+		require.NoError(t, os.WriteFile(filepath.Join(worktreePath, file), []byte(branch+"\n"), 0644))
+		runGit(t, worktreePath, "add", file)
+		runGit(t, worktreePath, "commit", "-q", "-m", branch)
+		return NewGitWorktreeFromStorage(repoPath, worktreePath, branch, branch, "", "")
+	}
+	clean := newTree("clean", "b.txt")
+	conflicting := newTree("conflicting", "a.txt")
+
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("main\n"), 0644))
+	runGit(t, repoPath, "commit", "-q", "-am", "main")
+
+	ahead, behind, err := clean.AheadBehind("main")
+	require.NoError(t, err)
+	require.Equal(t, 1, ahead)
+	require.Equal(t, 1, behind)
+
+	// Uncommitted changes are set aside during the rebase.
+	require.NoError(t, os.WriteFile(filepath.Join(clean.GetWorktreePath(), "b.txt"), []byte("dirty\n"), 0644))
+	require.NoError(t, clean.Rebase("main"))
+	// The branch now forks from main's tip.
+	require.Equal(t, strings.TrimSpace(runGit(t, repoPath, "rev-parse", "main")), clean.GetBaseCommitSHA())
+	ahead, behind, err = clean.AheadBehind("main")
+	require.NoError(t, err)
+	require.Equal(t, 1, ahead)
+	require.Equal(t, 0, behind)
+	content, err := os.ReadFile(filepath.Join(clean.GetWorktreePath(), "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "dirty\n", string(content))
+
+	tip := runGit(t, conflicting.GetWorktreePath(), "rev-parse", "HEAD")
+	err = conflicting.Rebase("main")
+	var conflictErr *RebaseConflictError
+	require.True(t, errors.As(err, &conflictErr), err)
+	require.Equal(t, []string{"a.txt"}, conflictErr.Files)
+	// The rebase was aborted.
+	require.Equal(t, tip, runGit(t, conflicting.GetWorktreePath(), "rev-parse", "HEAD"))
+	require.Empty(t, strings.TrimSpace(runGit(t, conflicting.GetWorktreePath(), "status", "--porcelain")))
+
+	require.Error(t, clean.Rebase("no-such-branch"))
+}
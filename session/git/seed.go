@@ -0,0 +1,119 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Seed copies the contents of dir into the worktree, e.g. prompt or config files the agent should start with.
+// The files are left uncommitted. Files the repository's .gitignore rules ignore are skipped, as are .git
+// directories; the skipped paths are returned relative to dir. Existing files in the worktree are overwritten.
+func (g *GitWorktree) Seed(dir string) (skipped []string, err error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("seed path %s is not a directory", dir)
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed directory: %w", err)
+	}
+
+	ignored, err := g.ignoredPaths(files)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range files {
+		if ignored[filepath.ToSlash(rel)] {
+			skipped = append(skipped, rel)
+			continue
+		}
+		if err := copyFile(filepath.Join(dir, rel), filepath.Join(g.worktreePath, rel)); err != nil {
+			return skipped, fmt.Errorf("failed to seed %s: %w", rel, err)
+		}
+	}
+	return skipped, nil
+}
+
+// ignoredPaths returns which of the worktree-relative paths the worktree's ignore rules match.
+func (g *GitWorktree) ignoredPaths(paths []string) (map[string]bool, error) {
+	ignored := make(map[string]bool)
+	if len(paths) == 0 {
+		return ignored, nil
+	}
+
+	var input strings.Builder
+	for _, path := range paths {
+		input.WriteString(filepath.ToSlash(path))
+		input.WriteByte(0)
+	}
+	// --no-index checks the rules even for paths that happen to be tracked.
+	cmd := exec.Command("git", "-C", g.worktreePath, "check-ignore", "--no-index", "-z", "--stdin")
+	cmd.Stdin = strings.NewReader(input.String())
+	output, err := cmd.Output()
+	if err != nil {
+		// check-ignore exits with 1 when no path is ignored.
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return ignored, nil
+		}
+		return nil, fmt.Errorf("failed to check ignored seed files: %w", err)
+	}
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path != "" {
+			ignored[path] = true
+		}
+	}
+	return ignored, nil
+}
+
+// copyFile copies src to dst, creating dst's parent directories and keeping src's permissions.
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, ".gitignore"), []byte("*.log\n"), 0644))
+
+	seedDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(seedDir, "prompts", "my dir"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(seedDir, ".git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "AGENTS.md"), []byte("be nice"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "prompts", "my dir", "task.md"), []byte("do it"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "run.sh"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "debug.log"), []byte("noise"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, ".git", "HEAD"), []byte("ref"), 0644))
+
+	tree := NewGitWorktreeFromStorage(repoPath, repoPath, "task", "", "", "")
+	skipped, err := tree.Seed(seedDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"debug.log"}, skipped)
+
+	content, err := os.ReadFile(filepath.Join(repoPath, "prompts", "my dir", "task.md"))
+	require.NoError(t, err)
+	require.Equal(t, "do it", string(content))
+	info, err := os.Stat(filepath.Join(repoPath, "run.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	require.NoFileExists(t, filepath.Join(repoPath, "debug.log"))
+	head, err := os.ReadFile(filepath.Join(repoPath, ".git", "HEAD"))
+	require.NoError(t, err)
+	require.NotEqual(t, "ref", string(head))
+
+	// Seeded files are left uncommitted.
+	require.Contains(t, runGit(t, repoPath, "status", "--porcelain"), "?? AGENTS.md")
+
+	_, err = tree.Seed(filepath.Join(seedDir, "AGENTS.md"))
+	require.ErrorContains(t, err, "not a directory")
+}
@@ -1,6 +1,9 @@
 package git
 
 import (
+	"claude-squad/config"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"os/exec"
 	"path/filepath"
@@ -35,6 +38,21 @@ func sanitizeBranchName(s string) string {
 	return s
 }
 
+// branchNameFromTitle returns the sanitized name used for an instance's branch and worktree directory. Titles that
+// sanitize to nothing, e.g. ones written only in emoji or non-Latin scripts, get a stable name derived from a hash.
+func branchNameFromTitle(title string) string {
+	if sanitized := sanitizeBranchName(title); sanitized != "" {
+		return sanitized
+	}
+	hash := sha256.Sum256([]byte(title))
+	return fmt.Sprintf("session-%x", hash[:4])
+}
+
+// BranchNameForTitle returns the branch a new instance with the title gets, including the configured branch prefix.
+func BranchNameForTitle(title string) string {
+	return config.LoadConfig().BranchPrefix + branchNameFromTitle(title)
+}
+
 // checkGHCLI checks if GitHub CLI is installed and configured
 func checkGHCLI() error {
 	// Check if gh is installed
@@ -51,6 +69,9 @@ func checkGHCLI() error {
 	return nil
 }
 
+// ErrNotGitRepo is returned when a path isn't inside a git repository.
+var ErrNotGitRepo = errors.New("not a git repository")
+
 // IsGitRepo checks if the given path is within a git repository
 func IsGitRepo(path string) bool {
 	for {
@@ -67,6 +88,16 @@ func IsGitRepo(path string) bool {
 	}
 }
 
+// IsBareRepo reports whether path is (inside) a bare repository, one without a working tree of its own. Bare
+// repositories can still host worktrees, so instances work in them the same way.
+func IsBareRepo(path string) (bool, error) {
+	output, err := exec.Command("git", "-C", path, "rev-parse", "--is-bare-repository").CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("failed to check if %s is a bare repository: %s (%w)", path, output, err)
+	}
+	return strings.TrimSpace(string(output)) == "true", nil
+}
+
 func findGitRepoRoot(path string) (string, error) {
 	currentPath := path
 	for {
@@ -79,7 +110,7 @@ func findGitRepoRoot(path string) (string, error) {
 		parent := filepath.Dir(currentPath)
 		if parent == currentPath {
 			// Reached the filesystem root without finding a repository
-			return "", fmt.Errorf("failed to find Git repository root from path: %s", path)
+			return "", fmt.Errorf("failed to find Git repository root from path %s: %w", path, ErrNotGitRepo)
 		}
 		currentPath = parent
 	}
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -71,3 +72,23 @@ func TestSanitizeBranchName(t *testing.T) {
 		})
 	}
 }
+
+func TestBranchNameFromTitle(t *testing.T) {
+	if got := branchNameFromTitle("Fix 🐛 login"); got != "fix-login" {
+		t.Errorf("branchNameFromTitle(%q) = %q, want %q", "Fix 🐛 login", got, "fix-login")
+	}
+
+	cjk := branchNameFromTitle("日本語")
+	emoji := branchNameFromTitle("🚀🔥")
+	for _, got := range []string{cjk, emoji} {
+		if !strings.HasPrefix(got, "session-") || sanitizeBranchName(got) != got {
+			t.Errorf("expected a sanitized fallback branch name, got %q", got)
+		}
+	}
+	if cjk == emoji {
+		t.Errorf("expected different titles to get different branch names, both got %q", cjk)
+	}
+	if branchNameFromTitle("日本語") != cjk {
+		t.Errorf("expected branch name to be stable for the same title")
+	}
+}
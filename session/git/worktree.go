@@ -5,20 +5,18 @@ import (
 	"claude-squad/log"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 func getWorktreeDirectory(repoPath string) (string, error) {
-	// Get canonical repo path to handle symlinks
-	canonical, err := config.GetCanonicalRepoPath(repoPath)
+	worktreeBaseDir, err := worktreeDirectory(repoPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get canonical repo path: %w", err)
+		return "", err
 	}
 
-	// Worktrees are now stored locally: <repo>/.claude-squad/worktrees/
-	worktreeBaseDir := filepath.Join(canonical, config.StateDirName, "worktrees")
-
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(worktreeBaseDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create worktree directory: %w", err)
@@ -27,6 +25,18 @@ func getWorktreeDirectory(repoPath string) (string, error) {
 	return worktreeBaseDir, nil
 }
 
+// worktreeDirectory returns the directory the repository's worktrees are created in, without creating it.
+func worktreeDirectory(repoPath string) (string, error) {
+	// Get canonical repo path to handle symlinks
+	canonical, err := config.GetCanonicalRepoPath(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get canonical repo path: %w", err)
+	}
+
+	// Worktrees are now stored locally: <repo>/.claude-squad/worktrees/
+	return filepath.Join(canonical, config.StateDirName(canonical), "worktrees"), nil
+}
+
 // GitWorktree manages git worktree operations for a session
 type GitWorktree struct {
 	// Path to the repository
@@ -39,23 +49,73 @@ type GitWorktree struct {
 	branchName string
 	// Base commit hash for the worktree
 	baseCommitSHA string
+	// baseRef is the ref new worktrees branch off from. Empty means HEAD. Only used during setup.
+	baseRef string
+	// isolationMode is config.IsolationWorktree or config.IsolationClone. Empty means worktree.
+	isolationMode string
+	// onExisting is the config.OnExisting* policy of new worktrees for a branch that already exists. Empty means
+	// reuse, which is what resuming a paused instance relies on. Only used during setup.
+	onExisting string
+	// existingBranch is how setup dealt with the branch already existing, one of config.OnExistingReuse and
+	// config.OnExistingRecreate, or empty if it didn't exist.
+	existingBranch string
+	// diffBase is one of the config.DiffBase* values Diff compares against. Empty means config.DiffBaseCommit.
+	diffBase string
+	// diffIgnore are pathspecs Diff leaves out.
+	diffIgnore []string
 }
 
-func NewGitWorktreeFromStorage(repoPath string, worktreePath string, sessionName string, branchName string, baseCommitSHA string) *GitWorktree {
+func NewGitWorktreeFromStorage(repoPath string, worktreePath string, sessionName string, branchName string, baseCommitSHA string, isolationMode string) *GitWorktree {
 	return &GitWorktree{
 		repoPath:      repoPath,
 		worktreePath:  worktreePath,
 		sessionName:   sessionName,
 		branchName:    branchName,
 		baseCommitSHA: baseCommitSHA,
+		isolationMode: isolationMode,
 	}
 }
 
-// NewGitWorktree creates a new GitWorktree instance
+// NewGitWorktree creates a new GitWorktree instance that branches off from HEAD
 func NewGitWorktree(repoPath string, sessionName string) (tree *GitWorktree, branchname string, err error) {
+	return NewGitWorktreeFromRef(repoPath, sessionName, "")
+}
+
+// NewGitWorktreeFromRef creates a new GitWorktree instance that branches off from baseRef (e.g. "main").
+// An empty baseRef means HEAD.
+func NewGitWorktreeFromRef(repoPath string, sessionName string, baseRef string) (tree *GitWorktree, branchname string, err error) {
 	cfg := config.LoadConfig()
-	sanitizedName := sanitizeBranchName(sessionName)
-	branchName := fmt.Sprintf("%s%s", cfg.BranchPrefix, sanitizedName)
+	repoPath, branchName, worktreePath, err := planWorktree(repoPath, sessionName, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := getWorktreeDirectory(repoPath); err != nil {
+		return nil, "", err
+	}
+
+	return &GitWorktree{
+		repoPath:      repoPath,
+		sessionName:   sessionName,
+		branchName:    branchName,
+		worktreePath:  worktreePath,
+		baseRef:       baseRef,
+		isolationMode: cfg.IsolationMode,
+		onExisting:    cfg.OnExistingWorktree,
+	}, branchName, nil
+}
+
+// PlanGitWorktree returns the branch and worktree path NewGitWorktreeFromRef would pick for sessionName, without
+// creating anything. The worktree path ends in a timestamp, so NewGitWorktreeFromRef's will differ in that suffix.
+func PlanGitWorktree(repoPath string, sessionName string) (branchName string, worktreePath string, err error) {
+	_, branchName, worktreePath, err = planWorktree(repoPath, sessionName, config.LoadConfig())
+	return branchName, worktreePath, err
+}
+
+// planWorktree works out the repository root, branch name and worktree path of a new worktree for sessionName.
+func planWorktree(repoPath string, sessionName string, cfg *config.Config) (repoRoot, branchName, worktreePath string,
+	err error) {
+	sanitizedName := branchNameFromTitle(sessionName)
+	branchName = fmt.Sprintf("%s%s", cfg.BranchPrefix, sanitizedName)
 
 	// Convert repoPath to absolute path
 	absPath, err := filepath.Abs(repoPath)
@@ -65,25 +125,19 @@ func NewGitWorktree(repoPath string, sessionName string) (tree *GitWorktree, bra
 		absPath = repoPath
 	}
 
-	repoPath, err = findGitRepoRoot(absPath)
+	repoRoot, err = findGitRepoRoot(absPath)
 	if err != nil {
-		return nil, "", err
+		return "", "", "", err
 	}
 
-	worktreeDir, err := getWorktreeDirectory(repoPath)
+	worktreeDir, err := worktreeDirectory(repoRoot)
 	if err != nil {
-		return nil, "", err
+		return "", "", "", err
 	}
 
-	worktreePath := filepath.Join(worktreeDir, sanitizedName)
+	worktreePath = filepath.Join(worktreeDir, sanitizedName)
 	worktreePath = worktreePath + "_" + fmt.Sprintf("%x", time.Now().UnixNano())
-
-	return &GitWorktree{
-		repoPath:     repoPath,
-		sessionName:  sessionName,
-		branchName:   branchName,
-		worktreePath: worktreePath,
-	}, branchName, nil
+	return repoRoot, branchName, worktreePath, nil
 }
 
 // GetWorktreePath returns the path to the worktree
@@ -110,3 +164,60 @@ func (g *GitWorktree) GetRepoName() string {
 func (g *GitWorktree) GetBaseCommitSHA() string {
 	return g.baseCommitSHA
 }
+
+// ExistingBranch returns how Setup dealt with the branch already existing: config.OnExistingReuse or
+// config.OnExistingRecreate, or "" if the branch was new.
+func (g *GitWorktree) ExistingBranch() string {
+	return g.existingBranch
+}
+
+// GetIsolationMode returns how the worktree is isolated from the repository (see config.IsolationMode)
+func (g *GitWorktree) GetIsolationMode() string {
+	return g.isolationMode
+}
+
+// SetDiffBase sets what Diff compares the worktree against, one of the config.DiffBase* values.
+func (g *GitWorktree) SetDiffBase(diffBase string) {
+	g.diffBase = diffBase
+}
+
+// SetDiffIgnore sets pathspecs (e.g. "package-lock.json", "dist/**") of files Diff leaves out.
+func (g *GitWorktree) SetDiffIgnore(patterns []string) {
+	g.diffIgnore = patterns
+}
+
+// ManagedWorktreeRepo reports whether path is inside a worktree, or clone, that cs created for an instance, and if so
+// returns the repository the instance belongs to. Running cs there would otherwise treat the worktree as a
+// repository of its own, with its own nested state directory.
+func ManagedWorktreeRepo(path string) (string, bool) {
+	output, err := exec.Command("git", "-C", path, "rev-parse", "--show-toplevel", "--git-common-dir").Output()
+	if err != nil {
+		return "", false
+	}
+	fields := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(fields) != 2 {
+		return "", false
+	}
+	toplevel, commonDir := fields[0], fields[1]
+	if !filepath.IsAbs(commonDir) {
+		// Older git prints it relative to path.
+		commonDir = filepath.Join(path, commonDir)
+	}
+
+	// Worktrees and clones live in <repo>/.claude-squad/worktrees/<name>.
+	worktreesDir := filepath.Dir(toplevel)
+	if filepath.Base(worktreesDir) != "worktrees" {
+		return "", false
+	}
+	repoPath := filepath.Dir(filepath.Dir(worktreesDir))
+	if filepath.Base(filepath.Dir(worktreesDir)) != config.StateDirName(repoPath) || !IsGitRepo(repoPath) {
+		return "", false
+	}
+	// A worktree shares the git directory of the repository, or is the repository's if it's bare. A clone has its
+	// own.
+	switch filepath.Clean(commonDir) {
+	case filepath.Join(repoPath, ".git"), repoPath, filepath.Join(toplevel, ".git"):
+		return repoPath, true
+	}
+	return "", false
+}
@@ -1,10 +1,16 @@
 package git
 
 import (
+	"claude-squad/config"
 	"claude-squad/log"
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 )
 
 // runGitCommand executes a git command and returns any error
@@ -20,6 +26,25 @@ func (g *GitWorktree) runGitCommand(path string, args ...string) (string, error)
 	return string(output), nil
 }
 
+// identityArgs returns the git options that make commits use the configured commit_author and commit_email, if any.
+// Without them, git uses the repository's user.name and user.email.
+func identityArgs() []string {
+	cfg := config.LoadConfig()
+	var args []string
+	if cfg.CommitAuthor != "" {
+		args = append(args, "-c", "user.name="+cfg.CommitAuthor)
+	}
+	if cfg.CommitEmail != "" {
+		args = append(args, "-c", "user.email="+cfg.CommitEmail)
+	}
+	return args
+}
+
+// commitArgs returns the arguments of a git command committing the staged changes with message, skipping hooks.
+func commitArgs(message string) []string {
+	return append(identityArgs(), "commit", "-m", message, "--no-verify")
+}
+
 // PushChanges commits and pushes changes in the worktree to the remote branch
 func (g *GitWorktree) PushChanges(commitMessage string, open bool) error {
 	if err := checkGHCLI(); err != nil {
@@ -40,7 +65,7 @@ func (g *GitWorktree) PushChanges(commitMessage string, open bool) error {
 		}
 
 		// Create commit
-		if _, err := g.runGitCommand(g.worktreePath, "commit", "-m", commitMessage, "--no-verify"); err != nil {
+		if _, err := g.runGitCommand(g.worktreePath, commitArgs(commitMessage)...); err != nil {
 			log.ErrorLog.Print(err)
 			return fmt.Errorf("failed to commit changes: %w", err)
 		}
@@ -94,7 +119,7 @@ func (g *GitWorktree) CommitChanges(commitMessage string) error {
 		}
 
 		// Create commit (local only)
-		if _, err := g.runGitCommand(g.worktreePath, "commit", "-m", commitMessage, "--no-verify"); err != nil {
+		if _, err := g.runGitCommand(g.worktreePath, commitArgs(commitMessage)...); err != nil {
 			log.ErrorLog.Print(err)
 			return fmt.Errorf("failed to commit changes: %w", err)
 		}
@@ -103,6 +128,45 @@ func (g *GitWorktree) CommitChanges(commitMessage string) error {
 	return nil
 }
 
+// Squash replaces the commits on the branch since the base commit with a single commit. If message is empty, one
+// is generated from the squashed commit subjects. Returns the short hash of the new commit.
+func (g *GitWorktree) Squash(message string) (string, error) {
+	isDirty, err := g.IsDirty()
+	if err != nil {
+		return "", fmt.Errorf("failed to check for changes: %w", err)
+	}
+	if isDirty {
+		return "", fmt.Errorf("worktree has uncommitted changes: commit or discard them before squashing")
+	}
+
+	subjects, err := g.runGitCommand(g.worktreePath, "log", "--reverse", "--format=%s", g.baseCommitSHA+"..HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to list commits: %w", err)
+	}
+	commits := strings.Split(strings.TrimSpace(subjects), "\n")
+	if strings.TrimSpace(subjects) == "" {
+		return "", fmt.Errorf("no commits to squash on branch %s", g.branchName)
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("%s\n\nSquashed %d commit(s):\n- %s", g.sessionName, len(commits),
+			strings.Join(commits, "\n- "))
+	}
+
+	if _, err := g.runGitCommand(g.worktreePath, "reset", "--soft", g.baseCommitSHA); err != nil {
+		return "", fmt.Errorf("failed to reset to base commit: %w", err)
+	}
+	if _, err := g.runGitCommand(g.worktreePath, commitArgs(message)...); err != nil {
+		return "", fmt.Errorf("failed to commit squashed changes: %w", err)
+	}
+
+	hash, err := g.runGitCommand(g.worktreePath, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to get squashed commit: %w", err)
+	}
+	return strings.TrimSpace(hash), nil
+}
+
 // IsDirty checks if the worktree has uncommitted changes
 func (g *GitWorktree) IsDirty() (bool, error) {
 	output, err := g.runGitCommand(g.worktreePath, "status", "--porcelain")
@@ -112,8 +176,14 @@ func (g *GitWorktree) IsDirty() (bool, error) {
 	return len(output) > 0, nil
 }
 
-// IsBranchCheckedOut checks if the instance branch is currently checked out
+// IsBranchCheckedOut checks if the instance branch is currently checked out in the repository. Nothing is ever
+// checked out in a bare repository, whatever its HEAD says.
 func (g *GitWorktree) IsBranchCheckedOut() (bool, error) {
+	if bare, err := IsBareRepo(g.repoPath); err != nil {
+		return false, err
+	} else if bare {
+		return false, nil
+	}
 	output, err := g.runGitCommand(g.repoPath, "branch", "--show-current")
 	if err != nil {
 		return false, fmt.Errorf("failed to get current branch: %w", err)
@@ -135,3 +205,122 @@ func (g *GitWorktree) OpenBranchURL() error {
 	}
 	return nil
 }
+
+// FetchRemote fetches origin in the repository, pruning remote branches that were deleted.
+func FetchRemote(repoPath string) error {
+	if output, err := exec.Command("git", "-C", repoPath, "fetch", "--prune", "origin").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to fetch origin: %s (%w)", output, err)
+	}
+	return nil
+}
+
+// defaultBranches caches RemoteDefaultBranch per repository, since the diff stats look it up on every refresh.
+var defaultBranches = struct {
+	sync.Mutex
+	refs map[string]defaultBranch
+}{refs: make(map[string]defaultBranch)}
+
+type defaultBranch struct {
+	ref string
+	err error
+	// failedAt is when the lookup failed, if it did.
+	failedAt time.Time
+}
+
+const (
+	// defaultBranchRetry is how long RemoteDefaultBranch keeps returning a failed lookup before it tries again, so
+	// that an unreachable remote isn't asked on every diff refresh.
+	defaultBranchRetry = time.Minute
+	// lsRemoteTimeout is how long RemoteDefaultBranch waits for the remote to say which branch is its default.
+	lsRemoteTimeout = 10 * time.Second
+)
+
+// RemoteDefaultBranch returns the remote-tracking ref of origin's default branch, e.g. "origin/main" or
+// "origin/develop". The result is cached for the life of the process; a failure only for defaultBranchRetry.
+func RemoteDefaultBranch(repoPath string) (string, error) {
+	defaultBranches.Lock()
+	cached, ok := defaultBranches.refs[repoPath]
+	defaultBranches.Unlock()
+	if ok && (cached.err == nil || time.Since(cached.failedAt) < defaultBranchRetry) {
+		return cached.ref, cached.err
+	}
+
+	// Resolving may ask the remote, which other lookups shouldn't wait for.
+	ref, err := resolveRemoteDefaultBranch(repoPath)
+	result := defaultBranch{ref: ref, err: err}
+	if err != nil {
+		result.failedAt = time.Now()
+	}
+	defaultBranches.Lock()
+	defaultBranches.refs[repoPath] = result
+	defaultBranches.Unlock()
+	return ref, err
+}
+
+func resolveRemoteDefaultBranch(repoPath string) (string, error) {
+	output, err := exec.Command("git", "-C", repoPath, "symbolic-ref", "--short", "refs/remotes/origin/HEAD").Output()
+	if err == nil {
+		return strings.TrimSpace(string(output)), nil
+	}
+	if exec.Command("git", "-C", repoPath, "remote", "get-url", "origin").Run() != nil {
+		return "", fmt.Errorf("failed to find the default branch of origin: the repository has no origin remote")
+	}
+
+	// origin/HEAD is only set by clone, so ask the remote which branch its HEAD points to.
+	candidates := []string{"origin/main", "origin/master", "origin/develop"}
+	if output, err := lsRemoteHead(repoPath); err == nil {
+		// The first line reads "ref: refs/heads/<branch>\tHEAD".
+		line, _, _ := strings.Cut(string(output), "\n")
+		if target, ok := strings.CutPrefix(line, "ref: refs/heads/"); ok {
+			branch, _, _ := strings.Cut(target, "\t")
+			candidates = append([]string{"origin/" + branch}, candidates...)
+		}
+	} else {
+		log.WarningLog.Printf("failed to ask origin of %s for its default branch: %v", repoPath, err)
+	}
+	// Failing that, fall back to the usual names.
+	for _, ref := range candidates {
+		if exec.Command("git", "-C", repoPath, "rev-parse", "--verify", "--quiet", ref).Run() == nil {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find the default branch of origin")
+}
+
+// lsRemoteHead asks origin which branch its HEAD points to. It runs in the background of the TUI and the daemon, so
+// it never prompts for credentials and gives up after lsRemoteTimeout.
+func lsRemoteHead(repoPath string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lsRemoteTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "ls-remote", "--symref", "origin", "HEAD")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		// A custom ssh command is left alone, as it may be what authenticates with the remote.
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	return cmd.Output()
+}
+
+// IsMergedInto returns true if the branch was merged into target: the branch has commits of its own and they are
+// all reachable from target. In clone mode, the branch is checked as it is in the clone, which may be ahead of the
+// repository. A deleted upstream isn't taken as a merge, as the branch may have been deleted without merging, so a
+// squash merge isn't detected.
+func (g *GitWorktree) IsMergedInto(target string) (bool, error) {
+	tip, err := g.branchTip(g.repoPath)
+	if err != nil {
+		return false, err
+	}
+	// A branch without commits of its own is trivially reachable from target, but there was nothing to merge.
+	if tip == g.baseCommitSHA {
+		return false, nil
+	}
+
+	if _, err := g.runGitCommand(g.repoPath, "merge-base", "--is-ancestor", tip, target); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check whether %s is merged into %s: %w", g.branchName, target, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,179 @@
+package git
+
+import (
+	"claude-squad/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSquash(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "README"), []byte("hello\n"), 0644))
+	runGit(t, repoPath, "add", ".")
+	runGit(t, repoPath, "commit", "-q", "-m", "initial")
+	baseCommit := strings.TrimSpace(runGit(t, repoPath, "rev-parse", "HEAD"))
+
+	tree := NewGitWorktreeFromStorage(repoPath, repoPath, "task", "", baseCommit, "")
+
+	_, err := tree.Squash("")
+	require.ErrorContains(t, err, "no commits to squash")
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(repoPath, name), []byte(name), 0644))
+		require.NoError(t, tree.CommitChanges("add "+name))
+	}
+
+	// Uncommitted changes must be committed or discarded first.
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "dirty.txt"), []byte("dirty"), 0644))
+	_, err = tree.Squash("")
+	require.ErrorContains(t, err, "uncommitted changes")
+	require.NoError(t, os.Remove(filepath.Join(repoPath, "dirty.txt")))
+
+	hash, err := tree.Squash("")
+	require.NoError(t, err)
+	require.NotEmpty(t, hash)
+
+	require.Equal(t, "1", strings.TrimSpace(runGit(t, repoPath, "rev-list", "--count", baseCommit+"..HEAD")))
+	message := runGit(t, repoPath, "log", "-1", "--format=%B")
+	require.Contains(t, message, "Squashed 3 commit(s)")
+	require.Contains(t, message, "- add b.txt")
+	require.Equal(t, "a.txt\nb.txt\nc.txt\n", runGit(t, repoPath, "diff", "--name-only", baseCommit, "HEAD"))
+}
+
+func TestIsMergedInto(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q", "-b", "main")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	baseCommit := strings.TrimSpace(runGit(t, repoPath, "rev-parse", "HEAD"))
+	runGit(t, repoPath, "branch", "task")
+
+	tree := NewGitWorktreeFromStorage(repoPath, "", "task", "task", baseCommit, "")
+
+	// A branch without commits of its own hasn't been merged, even though main contains it.
+	merged, err := tree.IsMergedInto("main")
+	require.NoError(t, err)
+	require.False(t, merged)
+
+	runGit(t, repoPath, "checkout", "-q", "task")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "work")
+	merged, err = tree.IsMergedInto("main")
+	require.NoError(t, err)
+	require.False(t, merged)
+
+	runGit(t, repoPath, "checkout", "-q", "main")
+	runGit(t, repoPath, "merge", "-q", "--no-ff", "-m", "merge task", "task")
+	merged, err = tree.IsMergedInto("main")
+	require.NoError(t, err)
+	require.True(t, merged)
+
+	// A clone's branch is checked as it is in the clone, where it has moved on since the merge.
+	clonePath := filepath.Join(t.TempDir(), "clone")
+	runGit(t, repoPath, "clone", "-q", "--origin", cloneSourceRemote, "--branch", "task", repoPath, clonePath)
+	runGit(t, clonePath, "commit", "-q", "--allow-empty", "-m", "more work")
+	clone := NewGitWorktreeFromStorage(repoPath, clonePath, "task", "task", baseCommit, config.IsolationClone)
+	merged, err = clone.IsMergedInto("main")
+	require.NoError(t, err)
+	require.False(t, merged)
+
+	// A branch whose upstream was deleted without merging isn't merged.
+	runGit(t, repoPath, "checkout", "-q", "-b", "abandoned", baseCommit)
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "abandoned work")
+	runGit(t, repoPath, "remote", "add", "origin", repoPath)
+	runGit(t, repoPath, "config", "branch.abandoned.remote", "origin")
+	runGit(t, repoPath, "config", "branch.abandoned.merge", "refs/heads/abandoned")
+	require.Contains(t, runGit(t, repoPath, "for-each-ref", "--format=%(upstream:track)", "refs/heads/abandoned"),
+		"[gone]")
+	abandoned := NewGitWorktreeFromStorage(repoPath, "", "abandoned", "abandoned", baseCommit, "")
+	merged, err = abandoned.IsMergedInto("main")
+	require.NoError(t, err)
+	require.False(t, merged)
+}
+
+func TestRemoteDefaultBranch(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	originPath := t.TempDir()
+	runGit(t, originPath, "init", "-q", "-b", "develop")
+	runGit(t, originPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	runGit(t, originPath, "branch", "main")
+
+	// A clone records origin/HEAD.
+	clonePath := filepath.Join(t.TempDir(), "clone")
+	runGit(t, originPath, "clone", "-q", originPath, clonePath)
+	ref, err := RemoteDefaultBranch(clonePath)
+	require.NoError(t, err)
+	require.Equal(t, "origin/develop", ref)
+
+	// Without origin/HEAD, the remote is asked rather than assuming main.
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "remote", "add", "origin", originPath)
+	runGit(t, repoPath, "fetch", "-q", "origin")
+	ref, err = RemoteDefaultBranch(repoPath)
+	require.NoError(t, err)
+	require.Equal(t, "origin/develop", ref)
+
+	// The result is cached.
+	runGit(t, originPath, "symbolic-ref", "HEAD", "refs/heads/main")
+	ref, err = RemoteDefaultBranch(repoPath)
+	require.NoError(t, err)
+	require.Equal(t, "origin/develop", ref)
+
+	// Failures are only remembered for a while, e.g. in case origin is added meanwhile.
+	noOrigin := t.TempDir()
+	_, err = RemoteDefaultBranch(noOrigin)
+	require.ErrorContains(t, err, "no origin remote")
+	runGit(t, noOrigin, "init", "-q")
+	runGit(t, noOrigin, "remote", "add", "origin", originPath)
+	runGit(t, noOrigin, "fetch", "-q", "origin")
+	_, err = RemoteDefaultBranch(noOrigin)
+	require.ErrorContains(t, err, "no origin remote")
+	defaultBranches.Lock()
+	failed := defaultBranches.refs[noOrigin]
+	failed.failedAt = failed.failedAt.Add(-defaultBranchRetry)
+	defaultBranches.refs[noOrigin] = failed
+	defaultBranches.Unlock()
+	ref, err = RemoteDefaultBranch(noOrigin)
+	require.NoError(t, err)
+	require.Equal(t, "origin/main", ref)
+}
+
+func TestCommitIdentity(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "config", "user.name", "me")
+	runGit(t, repoPath, "config", "user.email", "me@example.com")
+	tree := NewGitWorktreeFromStorage(repoPath, repoPath, "task", "", "", "")
+
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, tree.CommitChanges("add a.txt"))
+	require.Equal(t, "me <me@example.com>\n", runGit(t, repoPath, "log", "-1", "--format=%an <%ae>"))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".claude-squad"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".claude-squad", "config.json"),
+		[]byte(`{"commit_author": "squad-bot", "commit_email": "bot@example.com"}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "b.txt"), []byte("b"), 0644))
+	require.NoError(t, tree.CommitChanges("add b.txt"))
+	require.Equal(t, "squad-bot <bot@example.com>\nsquad-bot <bot@example.com>\n",
+		runGit(t, repoPath, "log", "-1", "--format=%an <%ae>%n%cn <%ce>"))
+}
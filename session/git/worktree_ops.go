@@ -1,12 +1,14 @@
 package git
 
 import (
+	"claude-squad/config"
 	"claude-squad/log"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -51,21 +53,93 @@ func (g *GitWorktree) Setup() error {
 		}
 	}
 
+	if branchExists {
+		switch g.onExisting {
+		case config.OnExistingError:
+			return fmt.Errorf("branch %s already exists, e.g. from an interrupted creation: pick another title, delete "+
+				"the branch, or set on_existing_worktree to reuse or recreate", g.branchName)
+		case config.OnExistingRecreate:
+			if err := g.removeExistingBranch(worktreesDir); err != nil {
+				return err
+			}
+			log.InfoLog.Printf("recreating existing branch %s", g.branchName)
+			g.existingBranch = config.OnExistingRecreate
+			branchExists = false
+		default:
+			log.InfoLog.Printf("reusing existing branch %s", g.branchName)
+			g.existingBranch = config.OnExistingReuse
+		}
+	}
+
+	if g.isolationMode == config.IsolationClone {
+		return g.setupClone(branchExists)
+	}
 	if branchExists {
 		return g.setupFromExistingBranch()
 	}
 	return g.setupNewWorktree()
 }
 
+// removeExistingBranch deletes the worktree's branch, removing the worktree it's checked out in first. Only
+// worktrees in worktreesDir, i.e. ones cs created, are removed: a branch checked out anywhere else is left alone.
+// Callers make sure no stored instance has the branch (see session.CheckTitleAvailable). Safe mode refuses it.
+func (g *GitWorktree) removeExistingBranch(worktreesDir string) error {
+	if err := config.CheckSafeMode(fmt.Sprintf("recreating existing branch %s", g.branchName)); err != nil {
+		return err
+	}
+	// Forget worktrees whose directories are gone, e.g. deleted by hand after a crash.
+	if err := g.Prune(); err != nil {
+		return err
+	}
+	holder, err := g.branchWorktree()
+	if err != nil {
+		return err
+	}
+	if holder != "" {
+		rel, err := filepath.Rel(worktreesDir, holder)
+		if err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("branch %s already exists and is checked out in %s, which cs didn't create: "+
+				"not recreating it", g.branchName, holder)
+		}
+		if _, err := g.runGitCommand(g.repoPath, "worktree", "remove", "-f", holder); err != nil {
+			return fmt.Errorf("failed to remove the existing worktree of branch %s: %w", g.branchName, err)
+		}
+		log.InfoLog.Printf("removed worktree %s of existing branch %s", holder, g.branchName)
+	}
+	if _, err := g.runGitCommand(g.repoPath, "branch", "-D", g.branchName); err != nil {
+		return fmt.Errorf("failed to delete existing branch %s: %w", g.branchName, err)
+	}
+	return nil
+}
+
+// branchWorktree returns the path of the worktree the branch is checked out in, or "" if there's none.
+func (g *GitWorktree) branchWorktree() (string, error) {
+	output, err := g.runGitCommand(g.repoPath, "worktree", "list", "--porcelain")
+	if err != nil {
+		return "", fmt.Errorf("failed to list worktrees: %w", err)
+	}
+	var current string
+	for _, line := range strings.Split(output, "\n") {
+		if path, ok := strings.CutPrefix(line, "worktree "); ok {
+			current = path
+		} else if line == "branch refs/heads/"+g.branchName {
+			return current, nil
+		}
+	}
+	return "", nil
+}
+
 // setupFromExistingBranch creates a worktree from an existing branch
 func (g *GitWorktree) setupFromExistingBranch() error {
 	// Directory already created in Setup(), skip duplicate creation
 
 	// Clean up any existing worktree first
 	_, _ = g.runGitCommand(g.repoPath, "worktree", "remove", "-f", g.worktreePath) // Ignore error if worktree doesn't exist
+	// A worktree left by an interrupted creation whose directory is gone still holds the branch until pruned.
+	_ = g.Prune()
 
 	// Create a new worktree from the existing branch
-	if _, err := g.runGitCommand(g.repoPath, "worktree", "add", g.worktreePath, g.branchName); err != nil {
+	if err := g.addWorktree(g.worktreePath, g.branchName); err != nil {
 		return fmt.Errorf("failed to create worktree from branch %s: %w", g.branchName, err)
 	}
 
@@ -74,9 +148,8 @@ func (g *GitWorktree) setupFromExistingBranch() error {
 
 // setupNewWorktree creates a new worktree from HEAD
 func (g *GitWorktree) setupNewWorktree() error {
-	// Ensure worktrees directory exists
-	worktreesDir := filepath.Join(g.repoPath, "worktrees")
-	if err := os.MkdirAll(worktreesDir, 0755); err != nil {
+	// Ensure the worktrees directory in the state directory exists
+	if err := os.MkdirAll(filepath.Dir(g.worktreePath), 0755); err != nil {
 		return fmt.Errorf("failed to create worktrees directory: %w", err)
 	}
 
@@ -94,37 +167,127 @@ func (g *GitWorktree) setupNewWorktree() error {
 		return fmt.Errorf("failed to cleanup existing branch: %w", err)
 	}
 
+	baseCommit, err := g.resolveBaseCommit()
+	if err != nil {
+		return err
+	}
+	return g.addWorktreeFromCommit(baseCommit)
+}
+
+// resolveBaseCommit returns the commit new branches start from: baseRef if set, HEAD otherwise
+func (g *GitWorktree) resolveBaseCommit() (string, error) {
+	if g.baseRef != "" {
+		output, err := g.runGitCommand(g.repoPath, "rev-parse", "--verify", g.baseRef+"^{commit}")
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve base ref %s: %w", g.baseRef, err)
+		}
+		return strings.TrimSpace(output), nil
+	}
+
+	if bare, err := IsBareRepo(g.repoPath); err == nil && bare {
+		return g.resolveBareHead()
+	}
+
 	output, err := g.runGitCommand(g.repoPath, "rev-parse", "HEAD")
 	if err != nil {
 		if strings.Contains(err.Error(), "fatal: ambiguous argument 'HEAD'") ||
 			strings.Contains(err.Error(), "fatal: not a valid object name") ||
 			strings.Contains(err.Error(), "fatal: HEAD: not a valid object name") {
-			return fmt.Errorf("this appears to be a brand new repository: please create an initial commit before creating an instance")
+			return "", fmt.Errorf("this appears to be a brand new repository: please create an initial commit before creating an instance")
 		}
-		return fmt.Errorf("failed to get HEAD commit hash: %w", err)
+		return "", fmt.Errorf("failed to get HEAD commit hash: %w", err)
 	}
-	headCommit := strings.TrimSpace(string(output))
-	g.baseCommitSHA = headCommit
+	return strings.TrimSpace(output), nil
+}
 
-	// Create a new worktree from the HEAD commit
+// resolveBareHead returns the commit HEAD of a bare repository points to. In a bare repository, HEAD often names a
+// branch that was never pushed (e.g. main when only master exists), and plain rev-parse doesn't fail on that.
+func (g *GitWorktree) resolveBareHead() (string, error) {
+	output, err := g.runGitCommand(g.repoPath, "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	if err == nil {
+		return strings.TrimSpace(output), nil
+	}
+
+	if branches, err := g.runGitCommand(g.repoPath, "for-each-ref", "--count=1", "refs/heads"); err == nil &&
+		strings.TrimSpace(branches) == "" {
+		return "", fmt.Errorf("this bare repository has no branches yet: please push a commit to it before creating an instance")
+	}
+	head := "HEAD"
+	if ref, err := g.runGitCommand(g.repoPath, "symbolic-ref", "--short", "HEAD"); err == nil {
+		head = strings.TrimSpace(ref)
+	}
+	return "", fmt.Errorf("HEAD of this bare repository points to %s, which doesn't exist: point it at an existing "+
+		"branch with 'git symbolic-ref HEAD refs/heads/<branch>', or create the instance from a branch with cs new --base", head)
+}
+
+// addWorktreeFromCommit creates the worktree on a new branch starting at baseCommit
+func (g *GitWorktree) addWorktreeFromCommit(baseCommit string) error {
+	g.baseCommitSHA = baseCommit
+
+	// Create a new worktree from the base commit
 	// Otherwise, we'll inherit uncommitted changes from the previous worktree.
 	// This way, we can start the worktree with a clean slate.
-	// TODO: we might want to give an option to use main/master instead of the current branch.
-	if _, err := g.runGitCommand(g.repoPath, "worktree", "add", "-b", g.branchName, g.worktreePath, headCommit); err != nil {
-		return fmt.Errorf("failed to create worktree from commit %s: %w", headCommit, err)
+	if err := g.addWorktree("-b", g.branchName, g.worktreePath, baseCommit); err != nil {
+		return fmt.Errorf("failed to create worktree from commit %s: %w", baseCommit, err)
 	}
 
 	return nil
 }
 
-// Cleanup removes the worktree and associated branch
+// worktreeAddRetryBackoff is the initial delay between attempts to add a worktree. It doubles after every attempt.
+const worktreeAddRetryBackoff = 100 * time.Millisecond
+
+// addWorktree runs git worktree add with args. While another git process holds one of the repository's lock files,
+// e.g. an editor open for git commit or an IDE refreshing its status, it retries with backoff up to
+// config.WorktreeAddAttempts times.
+func (g *GitWorktree) addWorktree(args ...string) error {
+	attempts := 0
+	backoff := worktreeAddRetryBackoff
+	for attempt := 1; ; attempt++ {
+		_, err := g.runGitCommand(g.repoPath, append([]string{"worktree", "add"}, args...)...)
+		if err == nil || !isLockContention(err) {
+			return err
+		}
+		if attempts == 0 {
+			attempts = config.LoadConfig().WorktreeAddAttempts
+			if attempts <= 0 {
+				attempts = config.DefaultWorktreeAddAttempts
+			}
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("the repository was still locked by another git process after %d attempts, "+
+				"make sure no git command is stuck in it and try again: %w", attempts, err)
+		}
+		log.WarningLog.Printf("repository %s is locked by another git process (attempt %d/%d), retrying in %v: %v",
+			g.repoPath, attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isLockContention reports whether a git command failed because another git process holds a lock file, such as
+// .git/index.lock or a ref's .lock file.
+func isLockContention(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, ".lock': File exists") || strings.Contains(msg, "Another git process seems to be running")
+}
+
+// Cleanup removes the worktree and associated branch. It's refused in safe mode.
 func (g *GitWorktree) Cleanup() error {
+	if err := config.CheckSafeMode(fmt.Sprintf("removing worktree %s and branch %s", g.worktreePath, g.branchName)); err != nil {
+		return err
+	}
+
 	var errs []error
 
 	// Check if worktree path exists before attempting removal
 	if _, err := os.Stat(g.worktreePath); err == nil {
-		// Remove the worktree using git command
-		if _, err := g.runGitCommand(g.repoPath, "worktree", "remove", "-f", g.worktreePath); err != nil {
+		if g.isolationMode == config.IsolationClone {
+			if err := os.RemoveAll(g.worktreePath); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove clone: %w", err))
+			}
+		} else if _, err := g.runGitCommand(g.repoPath, "worktree", "remove", "-f", g.worktreePath); err != nil {
+			// Remove the worktree using git command
 			errs = append(errs, err)
 		}
 	} else if !os.IsNotExist(err) {
@@ -164,6 +327,10 @@ func (g *GitWorktree) Cleanup() error {
 
 // Remove removes the worktree but keeps the branch
 func (g *GitWorktree) Remove() error {
+	if g.isolationMode == config.IsolationClone {
+		return g.removeClone()
+	}
+
 	// Remove the worktree using git command
 	if _, err := g.runGitCommand(g.repoPath, "worktree", "remove", "-f", g.worktreePath); err != nil {
 		return fmt.Errorf("failed to remove worktree: %w", err)
@@ -180,8 +347,16 @@ func (g *GitWorktree) Prune() error {
 	return nil
 }
 
-// CleanupWorktrees removes all worktrees for a specific repository and their associated branches
-func CleanupWorktrees(repoPath string) error {
+// cleanupWorkers bounds how many worktree directories CleanupWorktrees removes concurrently
+const cleanupWorkers = 4
+
+// CleanupWorktrees removes all worktrees for a specific repository and their associated branches, except the
+// worktrees at the paths in keep. If progress is non-nil, it's called once per removed worktree, in directory order,
+// with the number of worktrees removed so far. It's refused in safe mode.
+func CleanupWorktrees(repoPath string, keep []string, progress func(done, total int, name string)) error {
+	if err := config.CheckSafeMode("removing the worktrees of " + repoPath); err != nil {
+		return err
+	}
 	worktreesDir, err := getWorktreeDirectory(repoPath)
 	if err != nil {
 		return fmt.Errorf("failed to get worktree directory: %w", err)
@@ -193,7 +368,7 @@ func CleanupWorktrees(repoPath string) error {
 	}
 
 	// Get a list of all branches associated with worktrees
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+	cmd := exec.Command("git", "-C", repoPath, "worktree", "list", "--porcelain")
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to list worktrees: %w", err)
@@ -216,34 +391,110 @@ func CleanupWorktrees(repoPath string) error {
 		}
 	}
 
+	kept := make(map[string]bool, len(keep))
+	for _, path := range keep {
+		kept[filepath.Clean(path)] = true
+	}
+
+	var dirs []string
+	var branches []string
 	for _, entry := range entries {
-		if entry.IsDir() {
-			worktreePath := filepath.Join(worktreesDir, entry.Name())
-
-			// Delete the branch associated with this worktree if found
-			for path, branch := range worktreeBranches {
-				if strings.Contains(path, entry.Name()) {
-					// Delete the branch
-					deleteCmd := exec.Command("git", "branch", "-D", branch)
-					if err := deleteCmd.Run(); err != nil {
-						// Log the error but continue with other worktrees
-						log.ErrorLog.Printf("failed to delete branch %s: %v", branch, err)
-					}
-					break
-				}
+		if !entry.IsDir() || kept[filepath.Join(worktreesDir, entry.Name())] {
+			continue
+		}
+		dirs = append(dirs, entry.Name())
+		for path, branch := range worktreeBranches {
+			if strings.Contains(path, entry.Name()) {
+				branches = append(branches, branch)
+				break
 			}
+		}
+	}
 
-			// Remove the worktree directory
-			os.RemoveAll(worktreePath)
+	// Removing the directories is the slow part, so do it with a bounded pool. Each directory gets its own done
+	// channel so progress can be reported in order.
+	done := make([]chan struct{}, len(dirs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	sem := make(chan struct{}, cleanupWorkers)
+	go func() {
+		for i, dir := range dirs {
+			sem <- struct{}{}
+			go func(i int, dir string) {
+				defer func() { <-sem }()
+				defer close(done[i])
+				if err := os.RemoveAll(filepath.Join(worktreesDir, dir)); err != nil {
+					log.ErrorLog.Printf("failed to remove worktree %s: %v", dir, err)
+				}
+			}(i, dir)
+		}
+	}()
+	for i, dir := range dirs {
+		<-done[i]
+		if progress != nil {
+			progress(i+1, len(dirs), dir)
 		}
 	}
 
 	// You have to prune the cleaned up worktrees.
-	cmd = exec.Command("git", "worktree", "prune")
+	cmd = exec.Command("git", "-C", repoPath, "worktree", "prune")
 	_, err = cmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to prune worktrees: %w", err)
 	}
 
+	// Branches can only be deleted once their worktrees are gone.
+	if len(branches) > 0 {
+		deleteCmd := exec.Command("git", append([]string{"-C", repoPath, "branch", "-D"}, branches...)...)
+		if output, err := deleteCmd.CombinedOutput(); err != nil {
+			// Log the error but don't fail the cleanup
+			log.ErrorLog.Printf("failed to delete branches %v: %v (%s)", branches, err, output)
+		}
+	}
+
+	return nil
+}
+
+// OrphanedWorktrees returns the directories in the repository's worktree directory that aren't one of inUse, the
+// worktree paths of the repository's instances.
+func OrphanedWorktrees(repoPath string, inUse []string) ([]string, error) {
+	worktreesDir, err := getWorktreeDirectory(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(worktreesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worktree directory: %w", err)
+	}
+
+	known := make(map[string]bool, len(inUse))
+	for _, path := range inUse {
+		known[filepath.Clean(path)] = true
+	}
+
+	var orphans []string
+	for _, entry := range entries {
+		path := filepath.Join(worktreesDir, entry.Name())
+		if entry.IsDir() && !known[path] {
+			orphans = append(orphans, path)
+		}
+	}
+	return orphans, nil
+}
+
+// RemoveOrphanedWorktree deletes a worktree directory that no instance uses and prunes its git registration. Its
+// branch is kept, since it may hold work.
+func RemoveOrphanedWorktree(repoPath string, worktreePath string) error {
+	if err := config.CheckSafeMode("removing worktree " + worktreePath); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(worktreePath); err != nil {
+		return fmt.Errorf("failed to remove worktree %s: %w", worktreePath, err)
+	}
+	if output, err := exec.Command("git", "-C", repoPath, "worktree", "prune").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to prune worktrees: %s (%w)", output, err)
+	}
 	return nil
 }
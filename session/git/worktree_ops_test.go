@@ -0,0 +1,152 @@
+package git
+
+import (
+	"claude-squad/config"
+	"claude-squad/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs before all tests to set up the test environment
+func TestMain(m *testing.M) {
+	// Initialize the logger before any tests run
+	log.Initialize(false)
+	defer log.Close()
+
+	exitCode := m.Run()
+	os.Exit(exitCode)
+}
+
+func TestAddWorktreeRetriesLockContention(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"worktree_add_attempts": 2}`), 0644))
+	config.SetConfigPath(configPath)
+	defer config.SetConfigPath("")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	tree := NewGitWorktreeFromStorage(repoPath, "", "task", "", "", "")
+
+	// The lock is released while addWorktree backs off.
+	lockPath := filepath.Join(repoPath, ".git", "refs", "heads", "task.lock")
+	require.NoError(t, os.WriteFile(lockPath, nil, 0644))
+	go func() {
+		time.Sleep(worktreeAddRetryBackoff / 2)
+		os.Remove(lockPath)
+	}()
+	require.NoError(t, tree.addWorktree("-b", "task", filepath.Join(t.TempDir(), "task"), "HEAD"))
+
+	// A lock that's never released fails once the attempts run out.
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, ".git", "refs", "heads", "stuck.lock"), nil, 0644))
+	err := tree.addWorktree("-b", "stuck", filepath.Join(t.TempDir(), "stuck"), "HEAD")
+	require.ErrorContains(t, err, "still locked by another git process after 2 attempts")
+
+	// Other errors aren't retried.
+	err = tree.addWorktree("-b", "other", filepath.Join(t.TempDir(), "other"), "no-such-commit")
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "attempts")
+}
+
+func TestSetupInBareRepo(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	sourcePath := t.TempDir()
+	runGit(t, sourcePath, "init", "-q", "-b", "master")
+	runGit(t, sourcePath, "commit", "-q", "--allow-empty", "-m", "initial")
+	barePath := filepath.Join(t.TempDir(), "repo.git")
+	runGit(t, sourcePath, "clone", "-q", "--bare", sourcePath, barePath)
+
+	bare, err := IsBareRepo(barePath)
+	require.NoError(t, err)
+	require.True(t, bare)
+	bare, err = IsBareRepo(sourcePath)
+	require.NoError(t, err)
+	require.False(t, bare)
+
+	tree := NewGitWorktreeFromStorage(barePath, filepath.Join(t.TempDir(), "task"), "task", "test/task", "", "")
+	require.NoError(t, tree.Setup())
+	require.NotEmpty(t, tree.GetBaseCommitSHA())
+	// HEAD names master, but nothing is checked out in a bare repository.
+	checkedOut, err := (&GitWorktree{repoPath: barePath, branchName: "master"}).IsBranchCheckedOut()
+	require.NoError(t, err)
+	require.False(t, checkedOut)
+	require.NoError(t, tree.Cleanup())
+
+	// HEAD naming a branch that doesn't exist gets explained rather than failing in git worktree add.
+	runGit(t, barePath, "symbolic-ref", "HEAD", "refs/heads/main")
+	tree = NewGitWorktreeFromStorage(barePath, filepath.Join(t.TempDir(), "task"), "task", "test/task", "", "")
+	require.ErrorContains(t, tree.Setup(), "HEAD of this bare repository points to main, which doesn't exist")
+
+	emptyPath := filepath.Join(t.TempDir(), "empty.git")
+	runGit(t, sourcePath, "init", "-q", "--bare", emptyPath)
+	tree = NewGitWorktreeFromStorage(emptyPath, filepath.Join(t.TempDir(), "task"), "task", "test/task", "", "")
+	require.ErrorContains(t, tree.Setup(), "this bare repository has no branches yet")
+}
+
+func TestSetupWithExistingBranch(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath := t.TempDir()
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	head := strings.TrimSpace(runGit(t, repoPath, "rev-parse", "HEAD"))
+	worktreesDir, err := getWorktreeDirectory(repoPath)
+	require.NoError(t, err)
+
+	// An interrupted creation left the branch, with a commit, checked out in a worktree.
+	leftover := filepath.Join(worktreesDir, "task_1")
+	runGit(t, repoPath, "worktree", "add", "-q", "-b", "test/task", leftover)
+	runGit(t, leftover, "commit", "-q", "--allow-empty", "-m", "work")
+	newTree := func(onExisting string) *GitWorktree {
+		return &GitWorktree{
+			repoPath:     repoPath,
+			worktreePath: filepath.Join(worktreesDir, "task_2"),
+			sessionName:  "task",
+			branchName:   "test/task",
+			onExisting:   onExisting,
+		}
+	}
+
+	tree := newTree(config.OnExistingError)
+	require.ErrorContains(t, tree.Setup(), "branch test/task already exists")
+	require.DirExists(t, leftover)
+
+	tree = newTree(config.OnExistingRecreate)
+	require.NoError(t, tree.Setup())
+	require.Equal(t, config.OnExistingRecreate, tree.ExistingBranch())
+	require.NoDirExists(t, leftover)
+	require.Equal(t, head, strings.TrimSpace(runGit(t, tree.GetWorktreePath(), "rev-parse", "HEAD")))
+	require.NoError(t, tree.Remove())
+
+	// Reusing keeps the branch's commits.
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "more")
+	tree = newTree(config.OnExistingReuse)
+	require.NoError(t, tree.Setup())
+	require.Equal(t, config.OnExistingReuse, tree.ExistingBranch())
+	require.Equal(t, head, strings.TrimSpace(runGit(t, tree.GetWorktreePath(), "rev-parse", "HEAD")))
+
+	// A branch checked out outside the worktrees directory isn't touched.
+	require.NoError(t, tree.Remove())
+	elsewhere := filepath.Join(t.TempDir(), "mine")
+	runGit(t, repoPath, "worktree", "add", "-q", elsewhere, "test/task")
+	tree = newTree(config.OnExistingRecreate)
+	require.ErrorContains(t, tree.Setup(), "which cs didn't create")
+	require.DirExists(t, elsewhere)
+}
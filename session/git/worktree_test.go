@@ -0,0 +1,52 @@
+package git
+
+import (
+	"claude-squad/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagedWorktreeRepo(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoPath, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	runGit(t, repoPath, "init", "-q")
+	runGit(t, repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	worktreesDir, err := getWorktreeDirectory(repoPath)
+	require.NoError(t, err)
+
+	_, ok := ManagedWorktreeRepo(repoPath)
+	require.False(t, ok)
+
+	worktree := filepath.Join(worktreesDir, "task_1")
+	runGit(t, repoPath, "worktree", "add", "-q", "-b", "test/task", worktree)
+	managed, ok := ManagedWorktreeRepo(worktree)
+	require.True(t, ok)
+	require.Equal(t, repoPath, managed)
+	require.NoError(t, os.Mkdir(filepath.Join(worktree, "sub"), 0755))
+	managed, ok = ManagedWorktreeRepo(filepath.Join(worktree, "sub"))
+	require.True(t, ok)
+	require.Equal(t, repoPath, managed)
+
+	clone := filepath.Join(worktreesDir, "clone_1")
+	runGit(t, repoPath, "clone", "-q", repoPath, clone)
+	managed, ok = ManagedWorktreeRepo(clone)
+	require.True(t, ok)
+	require.Equal(t, repoPath, managed)
+
+	// A repository that merely sits in a directory laid out the same way isn't an instance's.
+	other, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	lookalike := filepath.Join(other, config.DefaultStateDirName, "worktrees", "task_1")
+	require.NoError(t, os.MkdirAll(lookalike, 0755))
+	runGit(t, lookalike, "init", "-q")
+	_, ok = ManagedWorktreeRepo(lookalike)
+	require.False(t, ok)
+}
@@ -1,6 +1,8 @@
 package session
 
 import (
+	"claude-squad/cmd"
+	"claude-squad/config"
 	"claude-squad/log"
 	"claude-squad/session/git"
 	"claude-squad/session/tmux"
@@ -19,14 +21,40 @@ type Status int
 const (
 	// Running is the status when the instance is running and claude is working.
 	Running Status = iota
-	// Ready is if the claude instance is ready to be interacted with (waiting for user input).
-	Ready
-	// Loading is if the instance is loading (if we are starting it up or something).
-	Loading
+	// Idle is if the claude instance is ready to be interacted with (waiting for user input).
+	Idle
+	// Creating is if the instance is being created and its session hasn't started yet.
+	Creating
 	// Paused is if the instance is paused (worktree removed but branch preserved).
 	Paused
+	// Crashed is if the instance's tmux session went away without the instance being paused or its work finished,
+	// e.g. because the program exited or the tmux server was killed.
+	Crashed
+	// Done is if the instance's tmux session is gone after its work was finished: its branch was merged or the
+	// instance was archived.
+	Done
 )
 
+// String returns a human readable name for the status.
+func (s Status) String() string {
+	switch s {
+	case Running:
+		return "running"
+	case Idle:
+		return "idle"
+	case Creating:
+		return "creating"
+	case Paused:
+		return "paused"
+	case Crashed:
+		return "crashed"
+	case Done:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
 // Instance is a running instance of claude code.
 type Instance struct {
 	// Title is the title of the instance.
@@ -47,13 +75,46 @@ type Instance struct {
 	CreatedAt time.Time
 	// UpdatedAt is the time the instance was last updated.
 	UpdatedAt time.Time
+	// RunningSince is the time the instance's program was last started, resumed or recreated.
+	RunningSince time.Time
 	// AutoYes is true if the instance should automatically press enter when prompted.
 	AutoYes bool
+	// AutoYesOverride, if set, takes precedence over the global autoyes setting for this instance (see ApplyAutoYes).
+	AutoYesOverride *bool
 	// Prompt is the initial prompt to pass to the instance on startup
 	Prompt string
+	// Archived is true if the instance's tmux session was killed but its worktree and branch were kept
+	// for reference. Archived instances are never restored.
+	Archived bool
+	// Subdir is the directory within the worktree the program starts in. Empty means the worktree root.
+	Subdir string
+	// DiffBase overrides config.DiffBase for this instance when set.
+	DiffBase string
+	// Merged is true if cs sync found the instance's branch merged into the remote's default branch.
+	Merged bool
+	// Agent is the name of the tmux.Agent that recognizes the program's prompts. Empty means the agent matching
+	// Program.
+	Agent string
+	// WindowName overrides config.WindowName, the name of the instance's tmux window, when set.
+	WindowName string
+	// Pinned instances are skipped by cs reset and the bulk kill and cleanup commands unless they're told to
+	// include them.
+	Pinned bool
+	// Notes is a freeform note about the instance, e.g. what it's working on, set with cs note.
+	Notes string
+	// Labels tag the instance so commands like cs exec can select it, set with cs new --label or cs label.
+	Labels []string
+	// Env are NAME=value variables set for the instance's program, set with cs new --env.
+	Env []string
 
 	// DiffStats stores the current git diff statistics
 	diffStats *git.DiffStats
+	// baseRef is the ref the instance's branch is created from. Empty means HEAD. Only used by Start.
+	baseRef string
+	// seedDir is a directory whose contents are copied into the new worktree. Only used by Start.
+	seedDir string
+	// seedSkipped are the files of seedDir that weren't copied because the repository ignores them.
+	seedSkipped []string
 
 	// The below fields are initialized upon calling Start().
 
@@ -77,6 +138,20 @@ func (i *Instance) ToInstanceData() InstanceData {
 		UpdatedAt: time.Now(),
 		Program:   i.Program,
 		AutoYes:   i.AutoYes,
+		Archived:  i.Archived,
+		Subdir:    i.Subdir,
+		Merged:    i.Merged,
+		Started:   i.started,
+		Pinned:    i.Pinned,
+		Notes:     i.Notes,
+		Labels:    i.Labels,
+		Env:       i.Env,
+		Agent:     i.Agent,
+
+		RunningSince:    i.RunningSince,
+		AutoYesOverride: i.AutoYesOverride,
+		DiffBase:        i.DiffBase,
+		WindowName:      i.WindowName,
 	}
 
 	// Only include worktree data if gitWorktree is initialized
@@ -87,15 +162,17 @@ func (i *Instance) ToInstanceData() InstanceData {
 			SessionName:   i.Title,
 			BranchName:    i.gitWorktree.GetBranchName(),
 			BaseCommitSHA: i.gitWorktree.GetBaseCommitSHA(),
+			IsolationMode: i.gitWorktree.GetIsolationMode(),
 		}
 	}
 
 	// Only include diff stats if they exist
 	if i.diffStats != nil {
 		data.DiffStats = DiffStatsData{
-			Added:   i.diffStats.Added,
-			Removed: i.diffStats.Removed,
-			Content: i.diffStats.Content,
+			Added:        i.diffStats.Added,
+			Removed:      i.diffStats.Removed,
+			FilesChanged: i.diffStats.FilesChanged,
+			Content:      i.diffStats.Content,
 		}
 	}
 
@@ -114,24 +191,52 @@ func FromInstanceData(data InstanceData) (*Instance, error) {
 		CreatedAt: data.CreatedAt,
 		UpdatedAt: data.UpdatedAt,
 		Program:   data.Program,
+		Archived:  data.Archived,
+		Subdir:    data.Subdir,
+		Merged:    data.Merged,
+		Pinned:    data.Pinned,
+		Notes:     data.Notes,
+		Labels:    data.Labels,
+		Env:       data.Env,
+		Agent:     data.Agent,
+
+		RunningSince:    data.RunningSince,
+		AutoYesOverride: data.AutoYesOverride,
+		DiffBase:        data.DiffBase,
+		WindowName:      data.WindowName,
+
 		gitWorktree: git.NewGitWorktreeFromStorage(
 			data.Worktree.RepoPath,
 			data.Worktree.WorktreePath,
 			data.Worktree.SessionName,
 			data.Worktree.BranchName,
 			data.Worktree.BaseCommitSHA,
+			data.Worktree.IsolationMode,
 		),
 		diffStats: &git.DiffStats{
-			Added:   data.DiffStats.Added,
-			Removed: data.DiffStats.Removed,
-			Content: data.DiffStats.Content,
+			Added:        data.DiffStats.Added,
+			Removed:      data.DiffStats.Removed,
+			FilesChanged: data.DiffStats.FilesChanged,
+			Content:      data.DiffStats.Content,
 		},
 	}
 
-	if instance.Paused() {
+	configureDiff(instance.gitWorktree, instance.DiffBase)
+
+	if !data.Started {
+		return nil, fmt.Errorf("instance was never started")
+	}
+
+	instance.tmuxSession = instance.newTmuxSession()
+	switch {
+	case instance.Paused() || instance.Archived:
 		instance.started = true
-		instance.tmuxSession = tmux.NewTmuxSession(instance.Title, instance.Program, instance.Path)
-	} else {
+	case !instance.tmuxSession.DoesSessionExist():
+		// The instance was running but its session is gone, e.g. tmux was killed or the machine rebooted. Keep it
+		// started so it can still be killed or resumed, rather than restoring a session that doesn't exist.
+		instance.started = true
+		instance.SetStatus(deriveStatus(instance.Status, false, instance.Merged, false))
+	default:
 		if err := instance.Start(false); err != nil {
 			return nil, err
 		}
@@ -150,6 +255,23 @@ type InstanceOptions struct {
 	Program string
 	// If AutoYes is true, then
 	AutoYes bool
+	// BaseRef is the ref to create the instance's branch from (e.g. "main"). Defaults to HEAD.
+	BaseRef string
+	// Subdir is the directory within the worktree to start the program in. Defaults to the worktree root.
+	Subdir string
+	// DiffBase is what the instance's diff is computed against. Defaults to config.DiffBase.
+	DiffBase string
+	// SeedDir is a directory whose contents are copied into the new worktree before the program starts.
+	SeedDir string
+	// Agent is the name of the agent the program is treated as. Defaults to the agent matching Program.
+	Agent string
+	// WindowName is the name of the instance's tmux window, with {title} and {branch} replaced. Defaults to
+	// config.WindowName.
+	WindowName string
+	// Labels tag the instance, e.g. for cs exec --label.
+	Labels []string
+	// Env are NAME=value variables set for the program, on top of cs's environment.
+	Env []string
 }
 
 func NewInstance(opts InstanceOptions) (*Instance, error) {
@@ -163,7 +285,7 @@ func NewInstance(opts InstanceOptions) (*Instance, error) {
 
 	return &Instance{
 		Title:     opts.Title,
-		Status:    Ready,
+		Status:    Idle,
 		Path:      absPath,
 		Program:   opts.Program,
 		Height:    0,
@@ -171,6 +293,97 @@ func NewInstance(opts InstanceOptions) (*Instance, error) {
 		CreatedAt: t,
 		UpdatedAt: t,
 		AutoYes:   false,
+		Subdir:    opts.Subdir,
+		DiffBase:  opts.DiffBase,
+		baseRef:   opts.BaseRef,
+		seedDir:   opts.SeedDir,
+		Agent:     opts.Agent,
+		Labels:    opts.Labels,
+		Env:       opts.Env,
+
+		WindowName: opts.WindowName,
+	}, nil
+}
+
+// newTmuxSession returns the tmux session for the instance, using the instance's agent if it has one.
+func (i *Instance) newTmuxSession() *tmux.TmuxSession {
+	tmuxSession := tmux.NewTmuxSession(i.Title, i.Program, i.Path)
+	if i.Agent != "" {
+		agent, err := tmux.LookupAgent(i.Agent)
+		if err != nil {
+			log.WarningLog.Printf("instance %s: %v, using the agent of its program", i.Title, err)
+		} else {
+			tmuxSession.SetAgent(agent)
+		}
+	}
+	tmuxSession.SetWindowName(i.windowName(i.Branch))
+	tmuxSession.SetEnv(i.Env)
+	return tmuxSession
+}
+
+// windowName returns the name of the instance's tmux window on the given branch: its WindowName, or else the
+// configured one, with {title} and {branch} replaced. "" leaves the window to tmux's automatic naming.
+func (i *Instance) windowName(branch string) string {
+	name := i.WindowName
+	if name == "" {
+		name = config.LoadConfig().WindowName
+	}
+	return strings.NewReplacer("{title}", i.Title, "{branch}", branch).Replace(name)
+}
+
+// SkippedSeedFiles returns the files of InstanceOptions.SeedDir that Start didn't copy into the worktree because
+// the repository ignores them.
+func (i *Instance) SkippedSeedFiles() []string {
+	return i.seedSkipped
+}
+
+// Plan is what Start would create for a new instance, as worked out by Instance.Plan.
+type Plan struct {
+	Branch string
+	// WorktreePath ends in a timestamp, which will differ in the worktree Start creates.
+	WorktreePath string
+	// WorkDir is where the program would start: WorktreePath joined with the instance's Subdir.
+	WorkDir     string
+	TmuxSession string
+	// Window is the name of the session's window, or "" for tmux's automatic name.
+	Window  string
+	Program string
+	Agent   string
+	// BaseRef is the ref the branch would be created from.
+	BaseRef string
+	// PostCreateHook is the hook that would run in the new worktree, or "" for none.
+	PostCreateHook string
+}
+
+// Plan works out the branch, worktree, tmux session and program Start(true) would use for the instance, without
+// touching git or tmux. Whether the subdir exists can only be checked once the worktree is created.
+func (i *Instance) Plan() (*Plan, error) {
+	if i.Title == "" {
+		return nil, fmt.Errorf("instance title cannot be empty")
+	}
+	if i.Subdir != "" && !filepath.IsLocal(i.Subdir) {
+		return nil, fmt.Errorf("subdir %s must be a relative path inside the worktree", i.Subdir)
+	}
+	branch, worktreePath, err := git.PlanGitWorktree(i.Path, i.Title)
+	if err != nil {
+		return nil, err
+	}
+	tmuxSession := i.newTmuxSession()
+	baseRef := i.baseRef
+	if baseRef == "" {
+		baseRef = "HEAD"
+	}
+	return &Plan{
+		Branch:       branch,
+		WorktreePath: worktreePath,
+		WorkDir:      filepath.Join(worktreePath, i.Subdir),
+		TmuxSession:  tmuxSession.Name(),
+		Window:       i.windowName(branch),
+		Program:      i.Program,
+		Agent:        tmuxSession.Agent().Name,
+		BaseRef:      baseRef,
+
+		PostCreateHook: config.ResolvePostCreateHook(i.Path, config.LoadConfig()),
 	}, nil
 }
 
@@ -197,26 +410,43 @@ func (i *Instance) Start(firstTimeSetup bool) error {
 		tmuxSession = i.tmuxSession
 	} else {
 		// Create new tmux session
-		tmuxSession = tmux.NewTmuxSession(i.Title, i.Program, i.Path)
+		tmuxSession = i.newTmuxSession()
 	}
 	i.tmuxSession = tmuxSession
 
 	if firstTimeSetup {
-		gitWorktree, branchName, err := git.NewGitWorktree(i.Path, i.Title)
+		gitWorktree, branchName, err := git.NewGitWorktreeFromRef(i.Path, i.Title, i.baseRef)
 		if err != nil {
 			return fmt.Errorf("failed to create git worktree: %w", err)
 		}
 		i.gitWorktree = gitWorktree
+		configureDiff(i.gitWorktree, i.DiffBase)
 		i.Branch = branchName
+		// The window name may include the branch, which wasn't known when the session was made.
+		tmuxSession.SetWindowName(i.windowName(i.Branch))
 	}
 
 	// Setup error handler to cleanup resources on any error
 	var setupErr error
+	// worktreeCreated is set once a new instance's worktree exists, so a failure after that removes it again. Kill
+	// doesn't, as the instance was never started.
+	worktreeCreated := false
 	defer func() {
 		if setupErr != nil {
 			if cleanupErr := i.Kill(); cleanupErr != nil {
 				setupErr = fmt.Errorf("%v (cleanup error: %v)", setupErr, cleanupErr)
 			}
+			if worktreeCreated {
+				if cleanupErr := i.gitWorktree.Cleanup(); cleanupErr != nil {
+					setupErr = fmt.Errorf("%v (cleanup error: %v)", setupErr, cleanupErr)
+				}
+			}
+			// Keep the marker if cleaning up left the worktree behind, so the next startup removes it.
+			if firstTimeSetup {
+				if _, err := os.Stat(i.gitWorktree.GetWorktreePath()); os.IsNotExist(err) {
+					i.removeCreationMarker()
+				}
+			}
 		} else {
 			i.started = true
 		}
@@ -229,23 +459,51 @@ func (i *Instance) Start(firstTimeSetup bool) error {
 			return setupErr
 		}
 	} else {
+		// Mark the worktree as being created until the instance is saved, so a crash in between doesn't leave it
+		// behind for good.
+		if err := i.writeCreationMarker(); err != nil {
+			log.WarningLog.Printf("failed to write creation marker of %s: %v", i.Title, err)
+		}
+
 		// Setup git worktree first
 		if err := i.gitWorktree.Setup(); err != nil {
 			setupErr = fmt.Errorf("failed to setup git worktree: %w", err)
 			return setupErr
 		}
+		worktreeCreated = true
 
-		// Create new session
-		if err := i.tmuxSession.Start(i.gitWorktree.GetWorktreePath()); err != nil {
-			// Cleanup git worktree if tmux session creation fails
-			if cleanupErr := i.gitWorktree.Cleanup(); cleanupErr != nil {
-				err = fmt.Errorf("%v (cleanup error: %v)", err, cleanupErr)
+		if i.seedDir != "" {
+			skipped, err := i.gitWorktree.Seed(i.seedDir)
+			if err != nil {
+				setupErr = fmt.Errorf("failed to seed git worktree: %w", err)
+				return setupErr
+			}
+			i.seedSkipped = skipped
+		}
+
+		if hook := config.ResolvePostCreateHook(i.Path, config.LoadConfig()); hook != "" {
+			if err := i.runPostCreateHook(hook); err != nil {
+				setupErr = err
+				return setupErr
 			}
+		}
+
+		workDir, err := i.workDir()
+		if err != nil {
+			setupErr = err
+			return setupErr
+		}
+
+		// Create new session
+		if err := i.tmuxSession.Start(workDir); err != nil {
 			setupErr = fmt.Errorf("failed to start new session: %w", err)
 			return setupErr
 		}
 	}
 
+	if firstTimeSetup {
+		i.RunningSince = time.Now()
+	}
 	i.SetStatus(Running)
 
 	return nil
@@ -258,6 +516,16 @@ func (i *Instance) Kill() error {
 		return nil
 	}
 
+	// With AutoCommitOnPause, the agent's work is committed and its branch kept. Don't tear anything down if
+	// the commit fails, or the work would be lost.
+	keepBranch := false
+	if i.gitWorktree != nil && !i.Paused() && config.LoadConfig().AutoCommitOnPause {
+		if err := i.commitWIP(); err != nil {
+			return fmt.Errorf("failed to commit changes before kill: %w", err)
+		}
+		keepBranch = true
+	}
+
 	var errs []error
 
 	// Always try to cleanup both resources, even if one fails
@@ -269,7 +537,16 @@ func (i *Instance) Kill() error {
 	}
 
 	// Then clean up git worktree
-	if i.gitWorktree != nil {
+	if i.gitWorktree != nil && keepBranch {
+		if _, err := os.Stat(i.gitWorktree.GetWorktreePath()); err == nil {
+			if err := i.gitWorktree.Remove(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove git worktree: %w", err))
+			}
+		}
+		if err := i.gitWorktree.Prune(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to prune git worktrees: %w", err))
+		}
+	} else if i.gitWorktree != nil {
 		if err := i.gitWorktree.Cleanup(); err != nil {
 			errs = append(errs, fmt.Errorf("failed to cleanup git worktree: %w", err))
 		}
@@ -278,6 +555,21 @@ func (i *Instance) Kill() error {
 	return i.combineErrors(errs)
 }
 
+// commitWIP commits any uncommitted changes in the worktree. Nothing is pushed.
+func (i *Instance) commitWIP() error {
+	if _, err := os.Stat(i.gitWorktree.GetWorktreePath()); err != nil {
+		return nil
+	}
+	dirty, err := i.gitWorktree.IsDirty()
+	if err != nil {
+		return err
+	}
+	if !dirty {
+		return nil
+	}
+	return i.gitWorktree.CommitChanges(fmt.Sprintf("wip: %s %s", i.Title, time.Now().Format(time.RFC3339)))
+}
+
 // combineErrors combines multiple errors into a single error
 func (i *Instance) combineErrors(errs []error) error {
 	if len(errs) == 0 {
@@ -308,16 +600,90 @@ func (i *Instance) HasUpdated() (updated bool, hasPrompt bool) {
 	return i.tmuxSession.HasUpdated()
 }
 
-// TapEnter sends an enter key press to the tmux session if AutoYes is enabled.
+// WaitingPrompt returns the prompt marker the instance's pane showed when HasUpdated last checked it, or "" if it
+// showed none.
+func (i *Instance) WaitingPrompt() string {
+	if !i.started {
+		return ""
+	}
+	return i.tmuxSession.Prompt()
+}
+
+// AgentName returns the name of the agent the instance's program is treated as: its Agent, or else the one matching
+// its program.
+func (i *Instance) AgentName() string {
+	if i.Agent != "" {
+		return i.Agent
+	}
+	return tmux.AgentForProgram(i.Program).Name
+}
+
+// SetAgent makes the instance treat its program as the named agent from now on, also in its running session.
+func (i *Instance) SetAgent(name string) error {
+	agent, err := tmux.LookupAgent(name)
+	if err != nil {
+		return err
+	}
+	i.Agent = name
+	if i.started && i.tmuxSession != nil {
+		i.tmuxSession.SetAgent(agent)
+	}
+	return nil
+}
+
+// ApplyAutoYes sets AutoYes from the global autoyes setting, unless the instance overrides it.
+func (i *Instance) ApplyAutoYes(global bool) {
+	if i.AutoYesOverride != nil {
+		i.AutoYes = *i.AutoYesOverride
+		return
+	}
+	i.AutoYes = global
+}
+
+// ToggleAutoYes flips AutoYes for this instance and records it as an override of the global setting.
+func (i *Instance) ToggleAutoYes() {
+	autoYes := !i.AutoYes
+	i.AutoYesOverride = &autoYes
+	i.AutoYes = autoYes
+}
+
+// TapEnter sends an enter key press to the tmux session if AutoYes is enabled, with the delay and line clearing of
+// the session's agent.
 func (i *Instance) TapEnter() {
 	if !i.started || !i.AutoYes {
 		return
 	}
-	if err := i.tmuxSession.TapEnter(); err != nil {
+	agent := i.tmuxSession.Agent()
+	if _, err := i.tmuxSession.SendConfirmKeys("\r", agent.ConfirmDelay, agent.ClearLine); err != nil {
 		log.ErrorLog.Printf("error tapping enter: %v", err)
 	}
 }
 
+// AcceptPrompt answers the prompt the instance is waiting on the way its agent does, except where autoYes says
+// otherwise. Like TapEnter, it does nothing unless AutoYes is on; accepted reports whether the keys were sent, or
+// will be once the agent's confirm delay has passed (see tmux.TmuxSession.SendConfirmKeys).
+func (i *Instance) AcceptPrompt(autoYes config.AutoYes) (accepted bool, err error) {
+	if !i.started || !i.AutoYes {
+		return false, nil
+	}
+	agent := i.tmuxSession.Agent()
+	keys, delay, clearLine := agent.ConfirmKeys, agent.ConfirmDelay, agent.ClearLine
+	if autoYes.Keys != "" {
+		keys = autoYes.Keys
+	}
+	if autoYes.Delay != nil {
+		delay = *autoYes.Delay
+	}
+	if autoYes.ClearLine != nil {
+		clearLine = *autoYes.ClearLine
+	}
+	sent, err := i.tmuxSession.SendConfirmKeys(keys, delay, clearLine)
+	if err != nil {
+		return false, fmt.Errorf("error sending autoyes keys: %w", err)
+	}
+	return sent, nil
+}
+
 func (i *Instance) Attach() (chan struct{}, error) {
 	if !i.started {
 		return nil, fmt.Errorf("cannot attach instance that has not been started")
@@ -333,6 +699,41 @@ func (i *Instance) SetPreviewSize(width, height int) error {
 	return i.tmuxSession.SetDetachedSize(width, height)
 }
 
+// Resize fits the instance's tmux window to the given terminal size, e.g. that of the terminal about to attach.
+func (i *Instance) Resize(cols, rows int) error {
+	if !i.started || i.Status == Paused {
+		return fmt.Errorf("cannot resize instance that has not been started or is paused")
+	}
+	return i.tmuxSession.Resize(cols, rows)
+}
+
+// Disconnect closes this process's connection to the tmux session without killing it, so the program keeps running
+// in the background. Use it before exiting a process that started the instance outside the TUI.
+func (i *Instance) Disconnect() error {
+	if !i.started || i.Status == Paused {
+		return nil
+	}
+	return i.tmuxSession.Disconnect()
+}
+
+// workDir returns the directory the program runs in: the worktree root joined with Subdir. The subdir must be a
+// directory inside the worktree.
+func (i *Instance) workDir() (string, error) {
+	worktreePath := i.gitWorktree.GetWorktreePath()
+	if i.Subdir == "" {
+		return worktreePath, nil
+	}
+	if !filepath.IsLocal(i.Subdir) {
+		return "", fmt.Errorf("subdir %s must be a relative path inside the worktree", i.Subdir)
+	}
+
+	workDir := filepath.Join(worktreePath, i.Subdir)
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("subdir %s does not exist in the worktree", i.Subdir)
+	}
+	return workDir, nil
+}
+
 // GetGitWorktree returns the git worktree for the instance
 func (i *Instance) GetGitWorktree() (*git.GitWorktree, error) {
 	if !i.started {
@@ -369,6 +770,84 @@ func (i *Instance) Paused() bool {
 	return i.Status == Paused
 }
 
+// Runtime returns how long the instance's program has been running at now, or 0 if it isn't running. Instances
+// saved before RunningSince was recorded count from their creation.
+func (i *Instance) Runtime(now time.Time) time.Duration {
+	if !i.started || i.Status == Paused || i.Status == Crashed || i.Status == Done || i.Archived {
+		return 0
+	}
+	since := i.RunningSince
+	if since.IsZero() {
+		since = i.CreatedAt
+	}
+	return now.Sub(since)
+}
+
+// CurrentStatus checks the instance's tmux session and returns its status: the last known one while the session
+// is alive, or Crashed or Done if it went away. Callers that track the status store the result with SetStatus.
+func (i *Instance) CurrentStatus() Status {
+	if !i.started {
+		return Creating
+	}
+	return deriveStatus(i.Status, i.Archived, i.Merged, i.Status != Paused && i.TmuxAlive())
+}
+
+// LiveSessions returns the live tmux sessions for StatusIn and Summarize, or nil, so that each session is checked on
+// its own, if they can't be listed.
+func LiveSessions() map[string]bool {
+	live, err := tmux.LiveSessions(cmd.MakeExecutor())
+	if err != nil {
+		log.WarningLog.Printf("%v", err)
+		return nil
+	}
+	return live
+}
+
+// StatusIn is CurrentStatus given the live tmux sessions (see tmux.LiveSessions), so that the statuses of many
+// instances take one tmux call. If live is nil, the instance's session is checked on its own.
+func (i *Instance) StatusIn(live map[string]bool) Status {
+	if live == nil || !i.started {
+		return i.CurrentStatus()
+	}
+	return deriveStatus(i.Status, i.Archived, i.Merged, i.Status != Paused && live[i.tmuxSession.Name()])
+}
+
+// StatusOf returns the current status of a stored instance, checking whether its tmux session is still alive.
+func StatusOf(data InstanceData) Status {
+	return StatusIn(data, nil)
+}
+
+// StatusIn is StatusOf given the live tmux sessions (see tmux.LiveSessions). If live is nil, the instance's session
+// is checked on its own.
+func StatusIn(data InstanceData, live map[string]bool) Status {
+	alive := false
+	if data.Status != Paused {
+		if live != nil {
+			alive = live[tmux.SessionName(data.Title, data.Path)]
+		} else {
+			alive = tmux.NewTmuxSession(data.Title, data.Program, data.Path).DoesSessionExist()
+		}
+	}
+	return deriveStatus(data.Status, data.Archived, data.Merged, alive)
+}
+
+// deriveStatus combines the last known status of an instance with whether its tmux session is alive.
+func deriveStatus(last Status, archived, merged, sessionAlive bool) Status {
+	switch {
+	case last == Paused:
+		return Paused
+	case sessionAlive && (last == Crashed || last == Done):
+		// The session is back, e.g. it was recreated by hand. The next poll works out whether it's busy.
+		return Idle
+	case sessionAlive:
+		return last
+	case archived || merged:
+		return Done
+	default:
+		return Crashed
+	}
+}
+
 // TmuxAlive returns true if the tmux session is alive. This is a sanity check before attaching.
 func (i *Instance) TmuxAlive() bool {
 	return i.tmuxSession.DoesSessionExist()
@@ -457,13 +936,20 @@ func (i *Instance) Resume() error {
 		return fmt.Errorf("failed to setup git worktree: %w", err)
 	}
 
+	// The subdir may be gone from the branch by now, so fall back to the worktree root instead of failing.
+	workDir, err := i.workDir()
+	if err != nil {
+		log.WarningLog.Printf("%v, starting in the worktree root", err)
+		workDir = i.gitWorktree.GetWorktreePath()
+	}
+
 	// Check if tmux session still exists from pause, otherwise create new one
 	if i.tmuxSession.DoesSessionExist() {
 		// Session exists, just restore PTY connection to it
 		if err := i.tmuxSession.Restore(); err != nil {
 			log.ErrorLog.Print(err)
 			// If restore fails, fall back to creating new session
-			if err := i.tmuxSession.Start(i.gitWorktree.GetWorktreePath()); err != nil {
+			if err := i.tmuxSession.Start(workDir); err != nil {
 				log.ErrorLog.Print(err)
 				// Cleanup git worktree if tmux session creation fails
 				if cleanupErr := i.gitWorktree.Cleanup(); cleanupErr != nil {
@@ -475,7 +961,7 @@ func (i *Instance) Resume() error {
 		}
 	} else {
 		// Create new tmux session
-		if err := i.tmuxSession.Start(i.gitWorktree.GetWorktreePath()); err != nil {
+		if err := i.tmuxSession.Start(workDir); err != nil {
 			log.ErrorLog.Print(err)
 			// Cleanup git worktree if tmux session creation fails
 			if cleanupErr := i.gitWorktree.Cleanup(); cleanupErr != nil {
@@ -486,10 +972,54 @@ func (i *Instance) Resume() error {
 		}
 	}
 
+	i.RunningSince = time.Now()
+	i.SetStatus(Running)
+	return nil
+}
+
+// Recreate starts a new tmux session running the instance's program in its existing worktree, e.g. after a reboot
+// killed the old one. Unlike Resume, the worktree isn't recreated.
+func (i *Instance) Recreate() error {
+	if !i.started {
+		return fmt.Errorf("cannot recreate instance that has not been started")
+	}
+	if i.Status == Paused || i.Archived {
+		return fmt.Errorf("can only recreate running instances")
+	}
+	if i.tmuxSession.DoesSessionExist() {
+		return fmt.Errorf("tmux session is already running")
+	}
+	if _, err := os.Stat(i.gitWorktree.GetWorktreePath()); err != nil {
+		return fmt.Errorf("worktree is missing: %w", err)
+	}
+
+	// The subdir may be gone from the branch by now, so fall back to the worktree root instead of failing.
+	workDir, err := i.workDir()
+	if err != nil {
+		log.WarningLog.Printf("%v, starting in the worktree root", err)
+		workDir = i.gitWorktree.GetWorktreePath()
+	}
+	if err := i.tmuxSession.Start(workDir); err != nil {
+		return fmt.Errorf("failed to start new session: %w", err)
+	}
+
+	i.RunningSince = time.Now()
 	i.SetStatus(Running)
 	return nil
 }
 
+// configureDiff sets what the worktree's diffs compare against, the instance's own diff base if set and otherwise
+// the configured one, and which paths they leave out.
+func configureDiff(worktree *git.GitWorktree, instanceDiffBase string) {
+	cfg := config.LoadConfig()
+	diffBase := instanceDiffBase
+	if diffBase == "" {
+		diffBase = cfg.DiffBase
+	}
+	worktree.SetDiffBase(diffBase)
+	worktree.SetDiffIgnore(cfg.DiffIgnore)
+}
+
 // UpdateDiffStats updates the git diff statistics for this instance
 func (i *Instance) UpdateDiffStats() error {
 	if !i.started {
@@ -0,0 +1,173 @@
+package session
+
+import (
+	"claude-squad/session/tmux"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoYesOverride(t *testing.T) {
+	instance := &Instance{Title: "task"}
+
+	instance.ApplyAutoYes(true)
+	require.True(t, instance.AutoYes)
+
+	// Opting out sticks even when the daemon turns autoyes on globally.
+	instance.ToggleAutoYes()
+	require.False(t, instance.AutoYes)
+	instance.ApplyAutoYes(true)
+	require.False(t, instance.AutoYes)
+
+	data := instance.ToInstanceData()
+	require.NotNil(t, data.AutoYesOverride)
+	require.False(t, *data.AutoYesOverride)
+
+	instance.ToggleAutoYes()
+	instance.ApplyAutoYes(false)
+	require.True(t, instance.AutoYes)
+}
+
+func TestDeriveStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		last     Status
+		archived bool
+		merged   bool
+		alive    bool
+		expected Status
+	}{
+		{name: "running session", last: Running, alive: true, expected: Running},
+		{name: "idle session", last: Idle, alive: true, expected: Idle},
+		{name: "paused", last: Paused, expected: Paused},
+		{name: "session gone", last: Running, expected: Crashed},
+		{name: "session gone after merge", last: Idle, merged: true, expected: Done},
+		{name: "archived", last: Idle, archived: true, expected: Done},
+		{name: "crashed session recreated", last: Crashed, alive: true, expected: Idle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, deriveStatus(tt.last, tt.archived, tt.merged, tt.alive))
+		})
+	}
+}
+
+func TestStatusIn(t *testing.T) {
+	data := InstanceData{Title: "task", Path: t.TempDir(), Status: Running}
+	live := map[string]bool{tmux.SessionName(data.Title, data.Path): true}
+	require.Equal(t, Running, StatusIn(data, live))
+	require.Equal(t, Crashed, StatusIn(data, map[string]bool{}))
+
+	data.Merged = true
+	require.Equal(t, Done, StatusIn(data, map[string]bool{}))
+}
+
+func TestRecreateRefusesWithoutWorktree(t *testing.T) {
+	// No tmux session exists for this title, so it loads as crashed.
+	instance, err := FromInstanceData(InstanceData{
+		Title:    "cs-test-recreate",
+		Path:     t.TempDir(),
+		Status:   Running,
+		Started:  true,
+		Worktree: GitWorktreeData{WorktreePath: filepath.Join(t.TempDir(), "gone")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, Crashed, instance.Status)
+	require.ErrorContains(t, instance.Recreate(), "worktree is missing")
+
+	instance.SetStatus(Paused)
+	require.ErrorContains(t, instance.Recreate(), "can only recreate running instances")
+}
+
+func TestInstanceAgent(t *testing.T) {
+	// Paused instances are restored without touching tmux.
+	load := func(agent string) *Instance {
+		instance, err := FromInstanceData(InstanceData{
+			Title:   "task",
+			Path:    t.TempDir(),
+			Program: "./run-codex.sh",
+			Status:  Paused,
+			Started: true,
+			Agent:   agent,
+		})
+		require.NoError(t, err)
+		return instance
+	}
+
+	require.Equal(t, tmux.AgentDefault, load("").tmuxSession.Agent().Name)
+	instance := load(tmux.ProgramCodex)
+	require.Equal(t, tmux.ProgramCodex, instance.tmuxSession.Agent().Name)
+	require.Equal(t, tmux.ProgramCodex, instance.ToInstanceData().Agent)
+	// An unknown agent falls back to the one matching the program.
+	require.Equal(t, tmux.AgentDefault, load("nope").tmuxSession.Agent().Name)
+
+	instance = load("")
+	require.Equal(t, tmux.AgentDefault, instance.AgentName())
+	require.NoError(t, instance.SetAgent(tmux.ProgramAider))
+	require.Equal(t, tmux.ProgramAider, instance.AgentName())
+	require.Equal(t, tmux.ProgramAider, instance.tmuxSession.Agent().Name)
+	require.Error(t, instance.SetAgent("nope"))
+	require.Equal(t, tmux.ProgramAider, instance.ToInstanceData().Agent)
+}
+
+func TestInstanceRuntime(t *testing.T) {
+	now := time.Now()
+	instance := &Instance{
+		Title:     "task",
+		Status:    Running,
+		CreatedAt: now.Add(-3 * time.Hour),
+		started:   true,
+	}
+	// Instances saved before RunningSince was recorded count from their creation.
+	require.Equal(t, 3*time.Hour, instance.Runtime(now))
+
+	instance.RunningSince = now.Add(-time.Hour)
+	require.Equal(t, time.Hour, instance.Runtime(now))
+	require.Equal(t, instance.RunningSince, instance.ToInstanceData().RunningSince)
+
+	for _, status := range []Status{Crashed, Done} {
+		instance.Status = status
+		require.Zero(t, instance.Runtime(now), status)
+	}
+	instance.Status = Paused
+	require.Zero(t, instance.Runtime(now))
+}
+
+func TestInstancePlan(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repoPath := t.TempDir()
+	output, err := exec.Command("git", "-C", repoPath, "init", "-q").CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	instance, err := NewInstance(InstanceOptions{
+		Title:   "My Task",
+		Path:    repoPath,
+		Program: "aider --yes",
+		Subdir:  "web",
+
+		WindowName: "{title} on {branch}",
+	})
+	require.NoError(t, err)
+	plan, err := instance.Plan()
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(plan.Branch, "my-task"), plan.Branch)
+	require.Equal(t, "HEAD", plan.BaseRef)
+	require.Equal(t, filepath.Join(plan.WorktreePath, "web"), plan.WorkDir)
+	require.Equal(t, "aider --yes", plan.Program)
+	require.Equal(t, tmux.ProgramAider, plan.Agent)
+	require.Contains(t, plan.TmuxSession, "MyTask")
+	require.Equal(t, "My Task on "+plan.Branch, plan.Window)
+
+	// Nothing is created.
+	require.NoDirExists(t, filepath.Dir(plan.WorktreePath))
+	require.False(t, instance.Started())
+
+	instance.Subdir = "../web"
+	_, err = instance.Plan()
+	require.ErrorContains(t, err, "inside the worktree")
+}
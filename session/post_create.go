@@ -0,0 +1,32 @@
+package session
+
+import (
+	"claude-squad/log"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runPostCreateHook runs the post-create hook in the instance's new worktree, with the instance's title, branch,
+// worktree and repository in CLAUDE_SQUAD_* variables. The hook's output is logged, and included in the error if it
+// fails.
+func (i *Instance) runPostCreateHook(hook string) error {
+	worktreePath := i.gitWorktree.GetWorktreePath()
+	hookCmd := exec.Command("sh", "-c", hook)
+	hookCmd.Dir = worktreePath
+	hookCmd.Env = append(os.Environ(),
+		"CLAUDE_SQUAD_INSTANCE="+i.Title,
+		"CLAUDE_SQUAD_BRANCH="+i.Branch,
+		"CLAUDE_SQUAD_WORKTREE="+worktreePath,
+		"CLAUDE_SQUAD_REPO="+i.gitWorktree.GetRepoPath(),
+	)
+	output, err := hookCmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("post-create hook failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	if len(output) > 0 {
+		log.InfoLog.Printf("post-create hook of %s: %s", i.Title, output)
+	}
+	return nil
+}
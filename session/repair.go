@@ -0,0 +1,78 @@
+package session
+
+import (
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"claude-squad/session/tmux"
+	"fmt"
+	"os"
+	"time"
+)
+
+// worktreeMissing returns true if the instance should have a worktree on disk but it was deleted externally.
+// Paused and archived instances don't have a live worktree to check.
+func worktreeMissing(data InstanceData) bool {
+	if data.Status == Paused || data.Archived || data.Worktree.WorktreePath == "" {
+		return false
+	}
+	_, err := os.Stat(data.Worktree.WorktreePath)
+	return os.IsNotExist(err)
+}
+
+// repairInstanceData prunes the dangling git registration of a missing worktree, kills the tmux session that was
+// running in it and marks the instance paused. Resuming the instance recreates the worktree from its branch.
+func repairInstanceData(data *InstanceData) error {
+	worktree := git.NewGitWorktreeFromStorage(
+		data.Worktree.RepoPath,
+		data.Worktree.WorktreePath,
+		data.Worktree.SessionName,
+		data.Worktree.BranchName,
+		data.Worktree.BaseCommitSHA,
+		data.Worktree.IsolationMode,
+	)
+	if err := worktree.Prune(); err != nil {
+		return err
+	}
+
+	// The program's working directory is gone, so its session can't be reused.
+	tmuxSession := tmux.NewTmuxSession(data.Title, data.Program, data.Path)
+	if tmuxSession.DoesSessionExist() {
+		if err := tmuxSession.Close(); err != nil {
+			return fmt.Errorf("failed to kill tmux session: %w", err)
+		}
+	}
+
+	data.Status = Paused
+	data.UpdatedAt = time.Now()
+	return nil
+}
+
+// RepairInstances finds instances whose worktree was deleted from disk, repairs them (see repairInstanceData) and
+// saves the result. Returns the titles of the repaired instances. The caller must hold the repository lock.
+func (s *Storage) RepairInstances() ([]string, error) {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return nil, err
+	}
+
+	var repaired []string
+	for i := range instancesData {
+		if !worktreeMissing(instancesData[i]) {
+			continue
+		}
+		log.WarningLog.Printf("worktree of instance %s is missing: %s", instancesData[i].Title,
+			instancesData[i].Worktree.WorktreePath)
+		if err := repairInstanceData(&instancesData[i]); err != nil {
+			return repaired, fmt.Errorf("failed to repair instance %s: %w", instancesData[i].Title, err)
+		}
+		repaired = append(repaired, instancesData[i].Title)
+	}
+
+	if len(repaired) == 0 {
+		return nil, nil
+	}
+	if err := s.SaveInstanceData(instancesData); err != nil {
+		return repaired, err
+	}
+	return repaired, nil
+}
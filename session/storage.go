@@ -1,12 +1,32 @@
 package session
 
 import (
+	"bytes"
 	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"claude-squad/session/tmux"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"sync"
 	"time"
 )
 
+var (
+	// ErrInstanceNotFound is returned when no stored instance has the requested title.
+	ErrInstanceNotFound = errors.New("instance not found")
+	// ErrInstanceArchived is returned when an operation requires an instance that isn't archived.
+	ErrInstanceArchived = errors.New("instance is already archived")
+	// ErrDuplicateTitle is returned when creating an instance whose title is already used in the repository.
+	ErrDuplicateTitle = errors.New("an instance with this title already exists")
+	// ErrInstanceLimit is returned when creating an instance would exceed the configured max_instances.
+	ErrInstanceLimit = errors.New("instance limit reached")
+)
+
 // InstanceData represents the serializable data of an Instance
 type InstanceData struct {
 	Title     string    `json:"title"`
@@ -18,12 +38,71 @@ type InstanceData struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	AutoYes   bool      `json:"auto_yes"`
+	Archived  bool      `json:"archived"`
+	Subdir    string    `json:"subdir,omitempty"`
+	Merged    bool      `json:"merged,omitempty"`
+	// Started records whether the instance's session was ever created, so an instance whose tmux session is
+	// gone (e.g. after a reboot) loads as crashed rather than as one that never started.
+	Started bool   `json:"started"`
+	Pinned  bool   `json:"pinned,omitempty"`
+	Agent   string `json:"agent,omitempty"`
+	Notes   string `json:"notes,omitempty"`
+	// Labels tag the instance for cs exec --label.
+	Labels []string `json:"labels,omitempty"`
+	// Env are NAME=value variables set for the instance's program.
+	Env []string `json:"env,omitempty"`
+	// WindowName is the instance's override of config.WindowName, unexpanded.
+	WindowName string `json:"window_name,omitempty"`
+
+	AutoYesOverride *bool     `json:"auto_yes_override,omitempty"`
+	DiffBase        string    `json:"diff_base,omitempty"`
+	RunningSince    time.Time `json:"running_since"`
 
 	Program   string          `json:"program"`
 	Worktree  GitWorktreeData `json:"worktree"`
 	DiffStats DiffStatsData   `json:"diff_stats"`
 }
 
+// UnmarshalJSON decodes the instance, treating records saved before Started was persisted as started: only
+// started instances were ever saved.
+func (d *InstanceData) UnmarshalJSON(data []byte) error {
+	type plain InstanceData
+	decoded := plain{Started: true}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*d = InstanceData(decoded)
+	return nil
+}
+
+// HasLabels reports whether the instance has every one of the given labels.
+func (d InstanceData) HasLabels(labels []string) bool {
+	for _, label := range labels {
+		if !slices.Contains(d.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// CloneOptions returns the options of a new instance with the same settings as this one: program, agent,
+// subdirectory, diff base, window name, labels and environment. Its branch is created from baseRef.
+// AutoYesOverride isn't an option; copy it onto the new instance.
+func (d InstanceData) CloneOptions(title, baseRef string) InstanceOptions {
+	return InstanceOptions{
+		Title:      title,
+		Path:       d.Path,
+		Program:    d.Program,
+		BaseRef:    baseRef,
+		Subdir:     d.Subdir,
+		DiffBase:   d.DiffBase,
+		Agent:      d.Agent,
+		WindowName: d.WindowName,
+		Labels:     slices.Clone(d.Labels),
+		Env:        slices.Clone(d.Env),
+	}
+}
+
 // GitWorktreeData represents the serializable data of a GitWorktree
 type GitWorktreeData struct {
 	RepoPath      string `json:"repo_path"`
@@ -31,18 +110,29 @@ type GitWorktreeData struct {
 	SessionName   string `json:"session_name"`
 	BranchName    string `json:"branch_name"`
 	BaseCommitSHA string `json:"base_commit_sha"`
+	IsolationMode string `json:"isolation_mode,omitempty"`
 }
 
 // DiffStatsData represents the serializable data of a DiffStats
 type DiffStatsData struct {
-	Added   int    `json:"added"`
-	Removed int    `json:"removed"`
-	Content string `json:"content"`
+	Added        int    `json:"added"`
+	Removed      int    `json:"removed"`
+	FilesChanged int    `json:"files_changed"`
+	Content      string `json:"content"`
 }
 
 // Storage handles saving and loading instances using the state interface
 type Storage struct {
 	state config.InstanceStorage
+
+	// mu guards unloaded and loadErr, which a load sets while the daemon may be saving.
+	mu sync.Mutex
+	// unloaded are the stored entries the last load skipped, e.g. because they didn't decode or restore.
+	// SaveInstances writes them back, so an instance that fails to load isn't deleted by the next save.
+	unloaded []json.RawMessage
+	// loadErr is set if the last load couldn't even split the stored instances apart, e.g. because the JSON is
+	// malformed. SaveInstances refuses to save then, since it would drop the instances that weren't read.
+	loadErr error
 }
 
 // NewStorage creates a new storage instance
@@ -52,15 +142,24 @@ func NewStorage(state config.InstanceStorage) (*Storage, error) {
 	}, nil
 }
 
-// SaveInstances saves the list of instances to disk
+// SaveInstances saves the list of instances to disk, along with the stored instances the last load skipped.
 func (s *Storage) SaveInstances(instances []*Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loadErr != nil {
+		return fmt.Errorf("not saving instances, as the stored ones couldn't all be read: %w", s.loadErr)
+	}
+
 	// Convert instances to InstanceData
-	data := make([]InstanceData, 0)
+	data := make([]any, 0, len(instances)+len(s.unloaded))
 	for _, instance := range instances {
 		if instance.Started() {
 			data = append(data, instance.ToInstanceData())
 		}
 	}
+	for _, entry := range s.unloaded {
+		data = append(data, entry)
+	}
 
 	// Marshal to JSON
 	jsonData, err := json.Marshal(data)
@@ -71,25 +170,117 @@ func (s *Storage) SaveInstances(instances []*Instance) error {
 	return s.state.SaveInstances(jsonData)
 }
 
-// LoadInstances loads the list of instances from disk
-func (s *Storage) LoadInstances() ([]*Instance, error) {
+// LoadInstanceData loads the serialized instances from disk without starting them. Use this when
+// only the stored metadata is needed, since LoadInstances restores every tmux session.
+func (s *Storage) LoadInstanceData() ([]InstanceData, error) {
 	jsonData := s.state.GetInstances()
 
 	var instancesData []InstanceData
 	if err := json.Unmarshal(jsonData, &instancesData); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal instances: %w", err)
 	}
+	return instancesData, nil
+}
 
-	instances := make([]*Instance, len(instancesData))
-	for i, data := range instancesData {
+// SaveInstanceData saves the serialized instances to disk as-is
+func (s *Storage) SaveInstanceData(instancesData []InstanceData) error {
+	jsonData, err := json.Marshal(instancesData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal instances: %w", err)
+	}
+
+	return s.state.SaveInstances(jsonData)
+}
+
+// LoadInstances loads the list of instances from disk. Instances whose worktree went missing load as paused instead
+// of failing to restore. They aren't repaired, as that writes the state; see RepairInstances.
+//
+// An instance that can't be decoded or restored doesn't fail the whole load: it's skipped, and the instances that
+// loaded are returned together with an error describing every skipped one. Skipped instances stay stored. For many instances, StreamInstances
+// avoids holding them all before the first one is used.
+func (s *Storage) LoadInstances() ([]*Instance, error) {
+	instances := make([]*Instance, 0)
+	err := s.StreamInstances(context.Background(), func(instance *Instance) {
+		instances = append(instances, instance)
+	})
+	return instances, err
+}
+
+// StreamInstances is LoadInstances for large instance lists: it decodes and restores the instances one at a time,
+// handing each to fn as soon as it's restored, so only one decoded entry is held at once. If ctx is cancelled, e.g.
+// when startup takes too long, it stops restoring instances and returns ctx's error joined with those of the skipped
+// instances.
+//
+// Skipped instances are kept as they're stored and written back by SaveInstances. If the stored instances can't be
+// read at all, SaveInstances fails until a load succeeds.
+func (s *Storage) StreamInstances(ctx context.Context, fn func(*Instance)) error {
+	var errs []error
+	var unloaded []json.RawMessage
+	err := s.streamInstanceEntries(func(i int, entry json.RawMessage) {
+		// Once cancelled, the remaining entries are only kept for saving.
+		if ctx.Err() != nil {
+			unloaded = append(unloaded, entry)
+			return
+		}
+		var data InstanceData
+		if err := json.Unmarshal(entry, &data); err != nil {
+			errs = append(errs, fmt.Errorf("failed to decode instance %d: %w", i, err))
+			unloaded = append(unloaded, entry)
+			return
+		}
+		if worktreeMissing(data) {
+			// Only RepairInstances stores the repair, under the repository lock the caller may not hold.
+			log.WarningLog.Printf("worktree of instance %s is missing, loading it paused: %s", data.Title,
+				data.Worktree.WorktreePath)
+			data.Status = Paused
+		}
 		instance, err := FromInstanceData(data)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create instance %s: %w", data.Title, err)
+			errs = append(errs, fmt.Errorf("failed to create instance %s: %w", data.Title, err))
+			unloaded = append(unloaded, entry)
+			return
 		}
-		instances[i] = instance
+		fn(instance)
+	})
+
+	s.mu.Lock()
+	s.unloaded = unloaded
+	s.loadErr = err
+	s.mu.Unlock()
+
+	for _, err := range errs {
+		log.ErrorLog.Printf("skipping instance: %v", err)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		errs = append([]error{err}, errs...)
 	}
+	return errors.Join(errs...)
+}
 
-	return instances, nil
+// streamInstanceEntries calls fn with the index and raw JSON of each stored instance in turn, decoding them one at a
+// time from the state file if the storage supports it (see config.InstanceStreamer). Entries are only split apart
+// here, so one that doesn't decode as InstanceData is still passed on, but malformed JSON ends the stream with an
+// error.
+func (s *Storage) streamInstanceEntries(fn func(i int, entry json.RawMessage)) error {
+	i := 0
+	next := func(entry json.RawMessage) error {
+		fn(i, entry)
+		i++
+		return nil
+	}
+	var err error
+	if streamer, ok := s.state.(config.InstanceStreamer); ok {
+		err = streamer.StreamInstances(next)
+	} else {
+		err = config.StreamArray(json.NewDecoder(bytes.NewReader(s.state.GetInstances())), next)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal instances: %w", err)
+	}
+	return nil
 }
 
 // DeleteInstance removes an instance from storage
@@ -111,7 +302,7 @@ func (s *Storage) DeleteInstance(title string) error {
 	}
 
 	if !found {
-		return fmt.Errorf("instance not found: %s", title)
+		return fmt.Errorf("%w: %s", ErrInstanceNotFound, title)
 	}
 
 	return s.SaveInstances(newInstances)
@@ -136,13 +327,236 @@ func (s *Storage) UpdateInstance(instance *Instance) error {
 	}
 
 	if !found {
-		return fmt.Errorf("instance not found: %s", data.Title)
+		return fmt.Errorf("%w: %s", ErrInstanceNotFound, data.Title)
 	}
 
 	return s.SaveInstances(instances)
 }
 
-// DeleteAllInstances removes all stored instances
-func (s *Storage) DeleteAllInstances() error {
-	return s.state.DeleteAllInstances()
+// FindInstanceData returns the stored data of the instance with the given title
+func (s *Storage) FindInstanceData(title string) (InstanceData, error) {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return InstanceData{}, fmt.Errorf("failed to load instances: %w", err)
+	}
+	for _, data := range instancesData {
+		if data.Title == title {
+			return data, nil
+		}
+	}
+	return InstanceData{}, fmt.Errorf("%w: %s", ErrInstanceNotFound, title)
+}
+
+// CheckTitleAvailable returns ErrDuplicateTitle if a stored instance, archived or not, already uses the title.
+func (s *Storage) CheckTitleAvailable(title string) error {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+	return CheckTitleAvailable(title, instancesData)
+}
+
+// CheckTitleAvailable returns ErrDuplicateTitle if title is the title of one of existing, or maps to the same tmux
+// session name (e.g. "my task" and "mytask") or branch (e.g. "Fix Bug" and "fix bug") as one of them. Titles are
+// used to name the tmux session and branch and to find instances from the command line, so they must be unique
+// within a repository. A shared branch would also let creating one instance recreate the other's branch.
+func CheckTitleAvailable(title string, existing []InstanceData) error {
+	branch := git.BranchNameForTitle(title)
+	for _, other := range existing {
+		if other.Title == title {
+			return fmt.Errorf("%w: %s", ErrDuplicateTitle, title)
+		}
+		if tmux.SameSessionName(other.Title, title) {
+			return fmt.Errorf("%w: %s (its tmux session would clash with %s)", ErrDuplicateTitle, title, other.Title)
+		}
+		if other.Worktree.BranchName == branch {
+			return fmt.Errorf("%w: %s (its branch %s belongs to %s)", ErrDuplicateTitle, title, branch, other.Title)
+		}
+	}
+	return nil
+}
+
+// CheckInstanceLimit returns ErrInstanceLimit if active instances reach max. A max of 0 means there's no limit.
+func CheckInstanceLimit(active int, max int) error {
+	if max > 0 && active >= max {
+		return fmt.Errorf("%w: %d of max_instances %d are active. Archive or kill some first "+
+			"(e.g. cs kill --all-paused), or raise max_instances in the config", ErrInstanceLimit, active, max)
+	}
+	return nil
+}
+
+// CountActive returns how many of the stored instances aren't archived.
+func CountActive(instancesData []InstanceData) int {
+	active := 0
+	for _, data := range instancesData {
+		if !data.Archived {
+			active++
+		}
+	}
+	return active
+}
+
+// ArchiveInstance kills the tmux session of an instance and marks it as archived. The worktree and branch are
+// preserved so the instance can still be inspected.
+func (s *Storage) ArchiveInstance(title string) error {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+
+	idx := -1
+	for i, data := range instancesData {
+		if data.Title == title {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return fmt.Errorf("%w: %s", ErrInstanceNotFound, title)
+	}
+	if instancesData[idx].Archived {
+		return fmt.Errorf("%w: %s", ErrInstanceArchived, title)
+	}
+
+	if err := ArchiveInstanceData(&instancesData[idx]); err != nil {
+		return err
+	}
+	return s.SaveInstanceData(instancesData)
+}
+
+// ArchiveInstanceData kills the tmux session of a stored instance and marks it as archived. The caller saves the
+// result.
+func ArchiveInstanceData(data *InstanceData) error {
+	tmuxSession := tmux.NewTmuxSession(data.Title, data.Program, data.Path)
+	if tmuxSession.DoesSessionExist() {
+		if err := tmuxSession.Close(); err != nil {
+			return fmt.Errorf("failed to kill tmux session: %w", err)
+		}
+	}
+
+	data.Archived = true
+	data.UpdatedAt = time.Now()
+	return nil
+}
+
+// KillInstanceData kills the tmux session of a stored instance and removes its worktree and, unless keepBranch is
+// set, its branch. The caller removes the instance from storage.
+func KillInstanceData(data InstanceData, keepBranch bool) error {
+	var errs []error
+
+	tmuxSession := tmux.NewTmuxSession(data.Title, data.Program, data.Path)
+	if tmuxSession.DoesSessionExist() {
+		if err := tmuxSession.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to kill tmux session: %w", err))
+		}
+	}
+
+	worktree := git.NewGitWorktreeFromStorage(
+		data.Worktree.RepoPath,
+		data.Worktree.WorktreePath,
+		data.Worktree.SessionName,
+		data.Worktree.BranchName,
+		data.Worktree.BaseCommitSHA,
+		data.Worktree.IsolationMode,
+	)
+	if keepBranch {
+		if _, err := os.Stat(worktree.GetWorktreePath()); err == nil {
+			if err := worktree.Remove(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := worktree.Prune(); err != nil {
+			errs = append(errs, err)
+		}
+	} else if err := worktree.Cleanup(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to cleanup git worktree: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteAllInstances removes all stored instances except, unless includePinned is set, the pinned ones. Returns
+// the pinned instances that were kept.
+func (s *Storage) DeleteAllInstances(includePinned bool) ([]InstanceData, error) {
+	if !includePinned {
+		instancesData, err := s.LoadInstanceData()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load instances: %w", err)
+		}
+		var pinned []InstanceData
+		for _, data := range instancesData {
+			if data.Pinned {
+				pinned = append(pinned, data)
+			}
+		}
+		if len(pinned) > 0 {
+			return pinned, s.SaveInstanceData(pinned)
+		}
+	}
+	return nil, s.state.DeleteAllInstances()
+}
+
+// SetPinned pins or unpins the stored instance with the given title.
+func (s *Storage) SetPinned(title string, pinned bool) error {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+	for i := range instancesData {
+		if instancesData[i].Title == title {
+			instancesData[i].Pinned = pinned
+			instancesData[i].UpdatedAt = time.Now()
+			return s.SaveInstanceData(instancesData)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInstanceNotFound, title)
+}
+
+// SetBaseCommit sets the commit the branch of the stored instance with the given title forks from, e.g. after it
+// was rebased.
+func (s *Storage) SetBaseCommit(title string, sha string) error {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+	for i := range instancesData {
+		if instancesData[i].Title == title {
+			instancesData[i].Worktree.BaseCommitSHA = sha
+			instancesData[i].UpdatedAt = time.Now()
+			return s.SaveInstanceData(instancesData)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInstanceNotFound, title)
+}
+
+// SetLabels sets the labels of the stored instance with the given title. No labels clear them.
+func (s *Storage) SetLabels(title string, labels []string) error {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+	for i := range instancesData {
+		if instancesData[i].Title == title {
+			instancesData[i].Labels = labels
+			instancesData[i].UpdatedAt = time.Now()
+			return s.SaveInstanceData(instancesData)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInstanceNotFound, title)
+}
+
+// SetNotes sets the notes of the stored instance with the given title. Empty notes clear them.
+func (s *Storage) SetNotes(title string, notes string) error {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+	for i := range instancesData {
+		if instancesData[i].Title == title {
+			instancesData[i].Notes = notes
+			instancesData[i].UpdatedAt = time.Now()
+			return s.SaveInstanceData(instancesData)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInstanceNotFound, title)
 }
@@ -0,0 +1,396 @@
+package session
+
+import (
+	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs before all tests to set up the test environment
+func TestMain(m *testing.M) {
+	// Initialize the logger before any tests run
+	log.Initialize(false)
+	defer log.Close()
+
+	exitCode := m.Run()
+	os.Exit(exitCode)
+}
+
+// memoryStorage is an in-memory config.InstanceStorage
+type memoryStorage struct {
+	data json.RawMessage
+}
+
+func (s *memoryStorage) SaveInstances(instancesJSON json.RawMessage) error {
+	s.data = instancesJSON
+	return nil
+}
+
+func (s *memoryStorage) GetInstances() json.RawMessage {
+	return s.data
+}
+
+func (s *memoryStorage) DeleteAllInstances() error {
+	return s.SaveInstances(json.RawMessage("[]"))
+}
+
+func TestLoadInstancesSkipsBadEntries(t *testing.T) {
+	// Paused instances are restored without touching tmux.
+	good := func(title string) string {
+		return fmt.Sprintf(`{"title": %q, "path": %q, "status": %d}`, title, t.TempDir(), Paused)
+	}
+	raw := "[" + good("one") + `, {"title": 5}, ` + good("two") + `, {"title": "bad", "status": "paused"}, ` +
+		good("three") + "]"
+
+	storage, err := NewStorage(&memoryStorage{data: json.RawMessage(raw)})
+	require.NoError(t, err)
+
+	instances, err := storage.LoadInstances()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to decode instance 1")
+	require.Contains(t, err.Error(), "failed to decode instance 3")
+
+	var titles []string
+	for _, instance := range instances {
+		titles = append(titles, instance.Title)
+	}
+	require.Equal(t, []string{"one", "two", "three"}, titles)
+
+	// Saving keeps the entries that didn't load, rather than deleting them.
+	require.NoError(t, storage.SaveInstances(instances[:1]))
+	var saved []json.RawMessage
+	require.NoError(t, json.Unmarshal(storage.state.GetInstances(), &saved))
+	require.Len(t, saved, 3)
+	require.JSONEq(t, `{"title": 5}`, string(saved[1]))
+	require.JSONEq(t, `{"title": "bad", "status": "paused"}`, string(saved[2]))
+}
+
+func TestLoadInstancesPausesMissingWorktree(t *testing.T) {
+	raw := fmt.Sprintf(`[{"title": "gone", "path": %q, "status": %d, "started": true, "program": "claude",
+		"worktree": {"worktree_path": %q}}]`, t.TempDir(), Running, filepath.Join(t.TempDir(), "missing"))
+	state := &memoryStorage{data: json.RawMessage(raw)}
+	storage, err := NewStorage(state)
+	require.NoError(t, err)
+
+	instances, err := storage.LoadInstances()
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	require.Equal(t, Paused, instances[0].Status)
+
+	// Loading doesn't write the repair, as the caller may not hold the repository lock.
+	require.JSONEq(t, raw, string(state.GetInstances()))
+}
+
+func TestLoadInstancesReconcilesStarted(t *testing.T) {
+	entry := func(title string, status Status, extra string) string {
+		return fmt.Sprintf(`{"title": %q, "path": %q, "status": %d%s}`, title, t.TempDir(), status, extra)
+	}
+	raw := "[" + strings.Join([]string{
+		// No tmux session exists for these titles, as after a reboot.
+		entry("cs-test-gone-running", Running, `, "started": true`),
+		entry("cs-test-gone-merged", Idle, `, "started": true, "merged": true`),
+		// Saved before Started was persisted.
+		entry("cs-test-legacy", Running, ""),
+		entry("cs-test-never", Idle, `, "started": false`),
+	}, ", ") + "]"
+
+	storage, err := NewStorage(&memoryStorage{data: json.RawMessage(raw)})
+	require.NoError(t, err)
+
+	instances, err := storage.LoadInstances()
+	require.ErrorContains(t, err, "failed to create instance cs-test-never: instance was never started")
+
+	statuses := make(map[string]Status)
+	for _, instance := range instances {
+		require.True(t, instance.Started(), instance.Title)
+		require.True(t, instance.ToInstanceData().Started, instance.Title)
+		statuses[instance.Title] = instance.Status
+	}
+	require.Equal(t, map[string]Status{
+		"cs-test-gone-running": Crashed,
+		"cs-test-gone-merged":  Done,
+		"cs-test-legacy":       Crashed,
+	}, statuses)
+}
+
+func TestLoadInstancesRejectsMalformedState(t *testing.T) {
+	storage, err := NewStorage(&memoryStorage{data: json.RawMessage(`{"not": "a list"}`)})
+	require.NoError(t, err)
+
+	instances, err := storage.LoadInstances()
+	require.Error(t, err)
+	require.Empty(t, instances)
+}
+
+func TestStreamInstances(t *testing.T) {
+	paused := func(title string) string {
+		return fmt.Sprintf(`{"title": %q, "path": %q, "status": %d}`, title, t.TempDir(), Paused)
+	}
+	raw := "[" + paused("one") + ", " + paused("two") + ", " + paused("three") + "]"
+	storage, err := NewStorage(&memoryStorage{data: json.RawMessage(raw)})
+	require.NoError(t, err)
+
+	// Cancelling stops the load before the next instance.
+	ctx, cancel := context.WithCancel(context.Background())
+	var titles []string
+	var instances []*Instance
+	err = storage.StreamInstances(ctx, func(instance *Instance) {
+		titles = append(titles, instance.Title)
+		instances = append(instances, instance)
+		if len(titles) == 2 {
+			cancel()
+		}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []string{"one", "two"}, titles)
+
+	// The instance that wasn't restored is still saved.
+	require.NoError(t, storage.SaveInstances(instances))
+	saved, err := storage.LoadInstanceData()
+	require.NoError(t, err)
+	require.Len(t, saved, 3)
+	require.Equal(t, "three", saved[2].Title)
+
+	// Instances before malformed JSON are still handed out.
+	storage, err = NewStorage(&memoryStorage{data: json.RawMessage("[" + paused("one") + ", {")})
+	require.NoError(t, err)
+	titles = nil
+	err = storage.StreamInstances(context.Background(), func(instance *Instance) {
+		titles = append(titles, instance.Title)
+	})
+	require.ErrorContains(t, err, "failed to unmarshal instances")
+	require.Equal(t, []string{"one"}, titles)
+
+	// Saving would drop what wasn't read.
+	require.ErrorContains(t, storage.SaveInstances(nil), "not saving instances")
+}
+
+func TestCheckTitleAvailable(t *testing.T) {
+	storage, err := NewStorage(&memoryStorage{data: json.RawMessage("[]")})
+	require.NoError(t, err)
+
+	first, err := NewInstance(InstanceOptions{Title: "my task", Path: t.TempDir(), Program: "claude"})
+	require.NoError(t, err)
+	require.NoError(t, storage.CheckTitleAvailable(first.Title))
+	require.NoError(t, storage.SaveInstanceData([]InstanceData{first.ToInstanceData()}))
+
+	// A second instance with the same title is rejected.
+	second, err := NewInstance(InstanceOptions{Title: "my task", Path: t.TempDir(), Program: "claude"})
+	require.NoError(t, err)
+	require.ErrorIs(t, storage.CheckTitleAvailable(second.Title), ErrDuplicateTitle)
+
+	// So is a title that maps to the same tmux session.
+	require.ErrorIs(t, storage.CheckTitleAvailable("mytask"), ErrDuplicateTitle)
+
+	require.NoError(t, storage.CheckTitleAvailable("other task"))
+
+	// And one whose branch a stored instance has, which creating it could otherwise recreate.
+	fixBug := InstanceData{Title: "Fix Bug", Worktree: GitWorktreeData{BranchName: git.BranchNameForTitle("Fix Bug")}}
+	require.NoError(t, storage.SaveInstanceData([]InstanceData{fixBug}))
+	require.ErrorIs(t, storage.CheckTitleAvailable("fix bug"), ErrDuplicateTitle)
+}
+
+func TestKillInstanceData(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	git := func(dir string, args ...string) string {
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, "git %v: %s", args, output)
+		return strings.TrimSpace(string(output))
+	}
+
+	repoPath := t.TempDir()
+	git(repoPath, "init", "-q")
+	git(repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+	baseCommit := git(repoPath, "rev-parse", "HEAD")
+
+	for _, keepBranch := range []bool{true, false} {
+		branch := fmt.Sprintf("task-%t", keepBranch)
+		worktreePath := filepath.Join(t.TempDir(), "worktree")
+		git(repoPath, "worktree", "add", "-q", "-b", branch, worktreePath)
+
+		data := InstanceData{
+			Title:   branch,
+			Path:    repoPath,
+			Program: "claude",
+			Worktree: GitWorktreeData{
+				RepoPath:      repoPath,
+				WorktreePath:  worktreePath,
+				SessionName:   branch,
+				BranchName:    branch,
+				BaseCommitSHA: baseCommit,
+			},
+		}
+		require.NoError(t, KillInstanceData(data, keepBranch))
+		require.NoDirExists(t, worktreePath)
+		require.Equal(t, keepBranch, git(repoPath, "branch", "--list", branch) != "", branch)
+	}
+}
+
+func TestRecoverInterruptedCreations(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	git := func(dir string, args ...string) string {
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, "git %v: %s", args, output)
+		return strings.TrimSpace(string(output))
+	}
+
+	repoPath := t.TempDir()
+	git(repoPath, "init", "-q")
+	git(repoPath, "commit", "-q", "--allow-empty", "-m", "initial")
+
+	// Two creations were interrupted before the instance was saved, one of them of a clone, and another completed.
+	var markers []string
+	worktrees := map[string]string{}
+	for _, title := range []string{"crashed-task", "cloned-task", "saved-task"} {
+		worktreePath := filepath.Join(t.TempDir(), title)
+		marker := creationMarker{Title: title, WorktreePath: worktreePath, BranchName: title}
+		if title == "cloned-task" {
+			git(repoPath, "clone", "-q", "--origin", "source", repoPath, worktreePath)
+			git(worktreePath, "checkout", "-q", "-b", title)
+			git(worktreePath, "commit", "-q", "--allow-empty", "-m", "work")
+			marker.IsolationMode = config.IsolationClone
+		} else {
+			git(repoPath, "worktree", "add", "-q", "-b", title, worktreePath)
+		}
+		worktrees[title] = worktreePath
+
+		path, err := creationMarkerPath(repoPath, worktreePath)
+		require.NoError(t, err)
+		data, err := json.Marshal(marker)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		markers = append(markers, path)
+	}
+
+	saved := fmt.Sprintf(`[{"title": "saved-task", "path": %q, "status": %d, "worktree": {"worktree_path": %q}}]`,
+		repoPath, Paused, worktrees["saved-task"])
+	storage, err := NewStorage(&memoryStorage{data: json.RawMessage(saved)})
+	require.NoError(t, err)
+
+	// In safe mode, the creations are only reported.
+	t.Setenv(config.SafeModeEnv, "1")
+	interrupted, err := storage.RecoverInterruptedCreations(repoPath)
+	require.NoError(t, err)
+	require.Len(t, interrupted, 2)
+	for _, creation := range interrupted {
+		require.True(t, creation.SafeMode)
+		require.DirExists(t, creation.WorktreePath)
+	}
+	t.Setenv(config.SafeModeEnv, "")
+
+	interrupted, err = storage.RecoverInterruptedCreations(repoPath)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []InterruptedCreation{
+		{Title: "crashed-task", WorktreePath: worktrees["crashed-task"]},
+		{Title: "cloned-task", WorktreePath: worktrees["cloned-task"]},
+	}, interrupted)
+
+	// The unsaved instances' worktrees are gone but their branches are kept, the clone's pushed back with its work.
+	require.NoDirExists(t, worktrees["crashed-task"])
+	require.NotEmpty(t, git(repoPath, "branch", "--list", "crashed-task"))
+	require.NotContains(t, git(repoPath, "worktree", "list"), worktrees["crashed-task"])
+	require.NoDirExists(t, worktrees["cloned-task"])
+	require.Equal(t, "work", git(repoPath, "log", "-1", "--format=%s", "cloned-task"))
+	require.DirExists(t, worktrees["saved-task"])
+	for _, marker := range markers {
+		require.NoFileExists(t, marker)
+	}
+
+	interrupted, err = storage.RecoverInterruptedCreations(repoPath)
+	require.NoError(t, err)
+	require.Empty(t, interrupted)
+}
+
+func TestDeleteAllInstancesKeepsPinned(t *testing.T) {
+	raw := `[{"title": "main", "status": 3, "pinned": true}, {"title": "task", "status": 3}]`
+	storage, err := NewStorage(&memoryStorage{data: json.RawMessage(raw)})
+	require.NoError(t, err)
+
+	require.NoError(t, storage.SetPinned("task", true))
+	require.NoError(t, storage.SetPinned("task", false))
+	require.ErrorIs(t, storage.SetPinned("missing", true), ErrInstanceNotFound)
+
+	pinned, err := storage.DeleteAllInstances(false)
+	require.NoError(t, err)
+	require.Len(t, pinned, 1)
+	require.Equal(t, "main", pinned[0].Title)
+	remaining, err := storage.LoadInstanceData()
+	require.NoError(t, err)
+	require.Equal(t, pinned, remaining)
+
+	pinned, err = storage.DeleteAllInstances(true)
+	require.NoError(t, err)
+	require.Empty(t, pinned)
+	remaining, err = storage.LoadInstanceData()
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
+func TestCheckInstanceLimit(t *testing.T) {
+	instancesData := []InstanceData{{Title: "a"}, {Title: "b", Archived: true}, {Title: "c"}}
+	active := CountActive(instancesData)
+	require.Equal(t, 2, active)
+
+	require.NoError(t, CheckInstanceLimit(active, 0))
+	require.NoError(t, CheckInstanceLimit(active, 3))
+	require.ErrorIs(t, CheckInstanceLimit(active, 2), ErrInstanceLimit)
+}
+
+func TestCloneOptions(t *testing.T) {
+	data := InstanceData{
+		Title:    "source",
+		Path:     "/repo",
+		Branch:   "user/source",
+		Program:  "aider --model x",
+		Agent:    "aider",
+		Subdir:   "web",
+		DiffBase: "merge-base",
+		Notes:    "works well",
+		Labels:   []string{"web"},
+		Env:      []string{"MODEL=x"},
+
+		WindowName: "{title}",
+	}
+	require.Equal(t, InstanceOptions{
+		Title:    "copy",
+		Path:     "/repo",
+		Program:  "aider --model x",
+		BaseRef:  "main",
+		Subdir:   "web",
+		DiffBase: "merge-base",
+		Agent:    "aider",
+		Labels:   []string{"web"},
+		Env:      []string{"MODEL=x"},
+
+		WindowName: "{title}",
+	}, data.CloneOptions("copy", "main"))
+}
+
+func TestHasLabels(t *testing.T) {
+	data := InstanceData{Labels: []string{"frontend", "urgent"}}
+	require.True(t, data.HasLabels(nil))
+	require.True(t, data.HasLabels([]string{"urgent"}))
+	require.True(t, data.HasLabels([]string{"urgent", "frontend"}))
+	require.False(t, data.HasLabels([]string{"urgent", "backend"}))
+	require.False(t, InstanceData{}.HasLabels([]string{"urgent"}))
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"claude-squad/session/git"
+	"os"
+	"time"
+)
+
+// InstanceSummary is a flattened, read-only view of a stored instance used by the CLI commands.
+type InstanceSummary struct {
+	Title        string    `json:"title"`
+	Status       string    `json:"status"`
+	Branch       string    `json:"branch"`
+	Program      string    `json:"program"`
+	Archived     bool      `json:"archived"`
+	Merged       bool      `json:"merged"`
+	Pinned       bool      `json:"pinned"`
+	Notes        string    `json:"notes,omitempty"`
+	Labels       []string  `json:"labels,omitempty"`
+	WorktreePath string    `json:"worktree_path"`
+	Added        int       `json:"added"`
+	Removed      int       `json:"removed"`
+	FilesChanged int       `json:"files_changed"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Summarize builds a summary for the stored instance, given the live tmux sessions (see StatusIn). The persisted diff
+// stats are only refreshed when something is polling the instance, so for instances with a live worktree the stats
+// are recomputed on demand.
+func Summarize(data InstanceData, live map[string]bool) InstanceSummary {
+	summary := InstanceSummary{
+		Title:        data.Title,
+		Status:       StatusIn(data, live).String(),
+		Branch:       data.Branch,
+		Program:      data.Program,
+		Archived:     data.Archived,
+		Merged:       data.Merged,
+		Pinned:       data.Pinned,
+		Notes:        data.Notes,
+		Labels:       data.Labels,
+		WorktreePath: data.Worktree.WorktreePath,
+		Added:        data.DiffStats.Added,
+		Removed:      data.DiffStats.Removed,
+		FilesChanged: data.DiffStats.FilesChanged,
+		CreatedAt:    data.CreatedAt,
+		UpdatedAt:    data.UpdatedAt,
+	}
+
+	if stats := computeDiffStats(data); stats != nil {
+		summary.Added = stats.Added
+		summary.Removed = stats.Removed
+		summary.FilesChanged = stats.FilesChanged
+	}
+	return summary
+}
+
+// computeDiffStats diffs the worktree of a stored instance. Returns nil if the stats can't be computed, e.g.
+// because the instance is paused and its worktree was removed.
+func computeDiffStats(data InstanceData) *git.DiffStats {
+	if data.Status == Paused || data.Worktree.WorktreePath == "" || data.Worktree.BaseCommitSHA == "" {
+		return nil
+	}
+	if _, err := os.Stat(data.Worktree.WorktreePath); err != nil {
+		return nil
+	}
+
+	worktree := git.NewGitWorktreeFromStorage(
+		data.Worktree.RepoPath,
+		data.Worktree.WorktreePath,
+		data.Worktree.SessionName,
+		data.Worktree.BranchName,
+		data.Worktree.BaseCommitSHA,
+		data.Worktree.IsolationMode,
+	)
+	configureDiff(worktree, data.DiffBase)
+	stats := worktree.Diff()
+	if stats.Error != nil {
+		return nil
+	}
+	return stats
+}
@@ -0,0 +1,137 @@
+package tmux
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Agent adapts cs to one agent program: how to tell the agent is waiting for the user to confirm something, and what
+// to send to confirm it. Sessions pick their agent from their program (see AgentForProgram) unless one is set with
+// SetAgent.
+type Agent struct {
+	// Name identifies the agent. It's also the executable name AgentForProgram matches.
+	Name string
+	// PromptMarkers are texts the pane shows while the agent waits for a confirmation. Any of them counts.
+	PromptMarkers []string
+	// ConfirmKeys are the keystrokes that accept such a prompt.
+	ConfirmKeys string
+	// ConfirmDelay is how long to wait after spotting the prompt before sending ConfirmKeys, for agents that ignore
+	// keystrokes arriving while the prompt is still being drawn.
+	ConfirmDelay time.Duration
+	// ClearLine sends C-u before ConfirmKeys, clearing whatever is on the agent's input line.
+	ClearLine bool
+	// TrustMarker is the text of the screen some agents show on startup, asking whether to trust the folder. Start
+	// accepts it by sending TrustKeys. Empty means the agent has no such screen.
+	TrustMarker string
+	TrustKeys   string
+	// TrustTimeout is how long Start waits for the trust screen before giving up on it.
+	TrustTimeout time.Duration
+}
+
+// AgentDefault is the agent of programs no other agent matches. It never detects a prompt.
+const AgentDefault = "default"
+
+const (
+	ProgramCodex = "codex"
+	ProgramAmp   = "amp"
+)
+
+var agents = []*Agent{
+	{
+		Name:          ProgramClaude,
+		PromptMarkers: []string{"No, and tell Claude what to do differently"},
+		ConfirmKeys:   "\r",
+		TrustMarker:   "Do you trust the files in this folder?",
+		TrustKeys:     "\r",
+		TrustTimeout:  30 * time.Second,
+	},
+	{
+		Name:          ProgramAider,
+		PromptMarkers: []string{"(Y)es/(N)o/(D)on't ask again"},
+		ConfirmKeys:   "\r",
+		// Aider takes longer to start.
+		TrustMarker:  "Open documentation url for more info",
+		TrustKeys:    "D\r",
+		TrustTimeout: 45 * time.Second,
+	},
+	{
+		Name:          ProgramGemini,
+		PromptMarkers: []string{"Yes, allow once"},
+		ConfirmKeys:   "\r",
+		TrustMarker:   "Open documentation url for more info",
+		TrustKeys:     "D\r",
+		TrustTimeout:  45 * time.Second,
+	},
+	{
+		Name: ProgramCodex,
+		PromptMarkers: []string{
+			"Would you like to run the following command?",
+			"Would you like to make the following edits?",
+		},
+		ConfirmKeys: "y",
+	},
+	{
+		Name:          ProgramAmp,
+		PromptMarkers: []string{"Allow this command?", "Approve this tool call?"},
+		ConfirmKeys:   "\r",
+	},
+	{
+		Name:        AgentDefault,
+		ConfirmKeys: "\r",
+	},
+}
+
+// AgentNames returns the names of the built-in agents.
+func AgentNames() []string {
+	names := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		names = append(names, agent.Name)
+	}
+	return names
+}
+
+// LookupAgent returns the built-in agent with the given name.
+func LookupAgent(name string) (*Agent, error) {
+	for _, agent := range agents {
+		if agent.Name == name {
+			return agent, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown agent %q (known agents: %s)", name, strings.Join(AgentNames(), ", "))
+}
+
+// AgentForProgram returns the agent whose name is the executable program runs, e.g. aider for
+// "FOO=bar /usr/local/bin/aider --model x", or the default agent if there's none.
+func AgentForProgram(program string) *Agent {
+	if args, err := SplitProgram(program); err == nil {
+		for _, arg := range args {
+			// Skip the environment assignments in front of the executable, and env itself.
+			if strings.Contains(arg, "=") || arg == "env" {
+				continue
+			}
+			if agent, err := LookupAgent(filepath.Base(arg)); err == nil {
+				return agent
+			}
+			break
+		}
+	}
+	agent, _ := LookupAgent(AgentDefault)
+	return agent
+}
+
+// IsWaiting reports whether the pane content shows the agent waiting for a confirmation.
+func (a *Agent) IsWaiting(content string) bool {
+	return a.MatchPrompt(content) != ""
+}
+
+// MatchPrompt returns the first of the agent's prompt markers the pane content shows, or "" if it shows none.
+func (a *Agent) MatchPrompt(content string) string {
+	for _, marker := range a.PromptMarkers {
+		if strings.Contains(content, marker) {
+			return marker
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package tmux
+
+import (
+	"os/exec"
+	"testing"
+
+	"claude-squad/cmd/cmd_test"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentForProgram(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected string
+	}{
+		{program: "claude", expected: ProgramClaude},
+		{program: "/usr/local/bin/claude --model opus", expected: ProgramClaude},
+		{program: "aider --model ollama_chat/gemma3:1b", expected: ProgramAider},
+		{program: "FOO=bar env codex --full-auto", expected: ProgramCodex},
+		{program: "amp", expected: ProgramAmp},
+		{program: "gemini", expected: ProgramGemini},
+		{program: "bash", expected: AgentDefault},
+		{program: "my-claude-wrapper", expected: AgentDefault},
+		{program: `aider "unterminated`, expected: AgentDefault},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, AgentForProgram(tt.program).Name, tt.program)
+	}
+
+	_, err := LookupAgent("nope")
+	require.ErrorContains(t, err, `unknown agent "nope"`)
+}
+
+func TestHasUpdatedUsesAgent(t *testing.T) {
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return []byte("Would you like to run the following command?\n$ go test ./...\n"), nil
+		},
+	}
+	session := newTmuxSession("test-session", "my-codex-wrapper", t.TempDir(), NewMockPtyFactory(t), cmdExec)
+	session.monitor = newStatusMonitor()
+
+	_, hasPrompt := session.HasUpdated()
+	require.False(t, hasPrompt, "the default agent never detects a prompt")
+
+	codex, err := LookupAgent(ProgramCodex)
+	require.NoError(t, err)
+	session.SetAgent(codex)
+	_, hasPrompt = session.HasUpdated()
+	require.True(t, hasPrompt)
+}
@@ -0,0 +1,75 @@
+package tmux
+
+import (
+	"claude-squad/cmd"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// gridSessionPrefix names the temporary sessions made by AttachGrid. It deliberately doesn't start with
+// TmuxPrefix, so the grids are never mistaken for instance sessions.
+const gridSessionPrefix = "claudesquad-grid_"
+
+// AttachGrid shows the given sessions side by side in a temporary tmux session with a tiled layout and attaches
+// the terminal to it until it detaches. A pane can't belong to two sessions, so each pane of the grid runs a
+// read-only tmux client of one session instead; the clients ignore their size so viewing an instance doesn't
+// resize its window. The grid session is destroyed once nothing is attached to it, leaving the instances as they
+// were.
+func AttachGrid(sessions []*TmuxSession) error {
+	return attachGrid(cmd.MakeExecutor(), sessions)
+}
+
+func attachGrid(cmdExec cmd.Executor, sessions []*TmuxSession) error {
+	if len(sessions) == 0 {
+		return fmt.Errorf("no sessions to show")
+	}
+
+	gridName := fmt.Sprintf("%s%d", gridSessionPrefix, os.Getpid())
+	cleanup := func() {
+		_ = cmdExec.Run(exec.Command("tmux", "kill-session", "-t", "="+gridName))
+	}
+
+	newCmd := exec.Command("tmux", "new-session", "-d", "-s", gridName, gridClientCommand(sessions[0]))
+	if err := cmdExec.Run(newCmd); err != nil {
+		return fmt.Errorf("failed to create grid session: %w", err)
+	}
+	for _, session := range sessions[1:] {
+		splitCmd := exec.Command("tmux", "split-window", "-t", gridName, gridClientCommand(session))
+		if err := cmdExec.Run(splitCmd); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to add %s to the grid: %w", session.sanitizedName, err)
+		}
+		// Re-tile after every split, otherwise the window runs out of room for new panes.
+		if err := cmdExec.Run(exec.Command("tmux", "select-layout", "-t", gridName, "tiled")); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to tile the grid: %w", err)
+		}
+	}
+
+	// destroy-unattached is only turned on once the client is attached, or tmux would destroy the grid right away.
+	destroyArgs := []string{";", "set-option", "-t", gridName, "destroy-unattached", "on"}
+	var attachCmd *exec.Cmd
+	if os.Getenv("TMUX") != "" {
+		// Already inside tmux: switch this client over instead of nesting another one.
+		attachCmd = exec.Command("tmux", append([]string{"switch-client", "-t", gridName}, destroyArgs...)...)
+	} else {
+		attachCmd = exec.Command("tmux", append([]string{"attach-session", "-t", gridName}, destroyArgs...)...)
+		attachCmd.Stdin = os.Stdin
+		attachCmd.Stdout = os.Stdout
+		attachCmd.Stderr = os.Stderr
+	}
+	if err := cmdExec.Run(attachCmd); err != nil {
+		cleanup()
+		return fmt.Errorf("failed to attach to grid session: %w", err)
+	}
+	return nil
+}
+
+// gridClientCommand returns the shell command a grid pane runs to show session read-only. tmux refuses to attach
+// from inside a session while $TMUX is set, so the client clears it, but keeps talking to the same server through
+// the socket path $TMUX starts with.
+func gridClientCommand(session *TmuxSession) string {
+	return fmt.Sprintf(`TMUX= tmux -S "${TMUX%%%%,*}" attach-session -f read-only,ignore-size -t '=%s'`,
+		session.sanitizedName)
+}
@@ -7,6 +7,12 @@ import (
 	"github.com/creack/pty"
 )
 
+// PtyFactory creates the PTYs used to drive tmux commands.
+//
+// Every PTY returned by Start is owned by the caller, which must close it. A TmuxSession closes the PTY of the
+// `new-session` command as soon as the session exists, and keeps the PTY of `attach-session` open until it detaches
+// or is closed. Close releases any resources held by the factory itself and is called by TmuxSession.Close when
+// the session is torn down.
 type PtyFactory interface {
 	Start(cmd *exec.Cmd) (*os.File, error)
 	Close()
@@ -19,6 +25,7 @@ func (pt Pty) Start(cmd *exec.Cmd) (*os.File, error) {
 	return pty.Start(cmd)
 }
 
+// Close is a no-op since the real factory holds no resources of its own.
 func (pt Pty) Close() {}
 
 func MakePtyFactory() PtyFactory {
@@ -0,0 +1,141 @@
+package tmux
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// SplitProgram splits a program string like `aider --model "gpt 4"` into its arguments the way a POSIX shell
+// would: words are separated by unquoted whitespace, single quotes keep everything literally, double quotes keep
+// everything but backslash escapes of ", \, $ and `, and a backslash outside quotes escapes the next character.
+// $VAR and ${VAR} are replaced with the variable's value outside single quotes, and a ~ starting a word with the
+// home directory, like configured programs got when they ran through a shell. Other shell syntax, such as globs,
+// pipes or $1, isn't interpreted.
+func SplitProgram(program string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	runes := []rune(program)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				// Inside double quotes, a backslash only escapes the characters that are special there.
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '$':
+			value, n, err := expandVariable(runes[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("%w in program %q", err, program)
+			}
+			if n == 0 {
+				// Not a variable, e.g. a lone $ or $1.
+				word.WriteRune(r)
+				inWord = true
+				continue
+			}
+			i += n
+			word.WriteString(value)
+			// Like an unquoted variable in a shell, an empty one alone doesn't make an argument.
+			inWord = inWord || value != ""
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '~' && !inWord && (i+1 == len(runes) || strings.ContainsRune("/ \t\n", runes[i+1])):
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand ~ in program %q: %w", program, err)
+			}
+			word.WriteString(home)
+			inWord = true
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in program %q", quote, program)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in program %q", program)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("program is empty")
+	}
+	return args, nil
+}
+
+// expandVariable returns the value of the variable named at the start of rest, which follows a $, and how many
+// runes its name took: NAME or {NAME}. It takes none if rest doesn't start with a name.
+func expandVariable(rest []rune) (value string, n int, err error) {
+	if len(rest) > 0 && rest[0] == '{' {
+		end := slices.Index(rest, '}')
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated ${")
+		}
+		name := string(rest[1:end])
+		if !isVariableName(name) {
+			return "", 0, fmt.Errorf("bad substitution ${%s}", name)
+		}
+		return os.Getenv(name), end + 1, nil
+	}
+	for n < len(rest) && isVariableName(string(rest[:n+1])) {
+		n++
+	}
+	if n == 0 {
+		return "", 0, nil
+	}
+	return os.Getenv(string(rest[:n])), n, nil
+}
+
+// isVariableName reports whether name is a valid shell variable name: letters, digits and underscores, not
+// starting with a digit.
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		isLetter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
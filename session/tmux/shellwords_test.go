@@ -0,0 +1,55 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitProgram(t *testing.T) {
+	tests := []struct {
+		name     string
+		program  string
+		expected []string
+	}{
+		{name: "single word", program: "claude", expected: []string{"claude"}},
+		{name: "flags", program: "aider --model x", expected: []string{"aider", "--model", "x"}},
+		{name: "extra whitespace", program: "  aider \t --yes  ", expected: []string{"aider", "--yes"}},
+		{name: "double quoted path with spaces", program: `aider --read "/tmp/my prompt.md"`,
+			expected: []string{"aider", "--read", "/tmp/my prompt.md"}},
+		{name: "single quoted JSON", program: `claude --settings '{"model": "opus"}'`,
+			expected: []string{"claude", "--settings", `{"model": "opus"}`}},
+		{name: "escaped space", program: `aider --read /tmp/my\ prompt.md`,
+			expected: []string{"aider", "--read", "/tmp/my prompt.md"}},
+		{name: "escapes in double quotes", program: `echo "say \"hi\" to \$USER \n"`,
+			expected: []string{"echo", `say "hi" to $USER \n`}},
+		{name: "backslash in single quotes", program: `echo 'a\b'`, expected: []string{"echo", `a\b`}},
+		{name: "adjacent quoted parts", program: `echo foo"bar baz"'qux'`, expected: []string{"echo", "foobar bazqux"}},
+		{name: "empty quoted argument", program: `claude ""`, expected: []string{"claude", ""}},
+		{name: "env assignment", program: "FOO=bar claude", expected: []string{"FOO=bar", "claude"}},
+		{name: "home directory", program: "~/bin/claude --read ~/notes.md a~b '~/x'",
+			expected: []string{"/home/me/bin/claude", "--read", "/home/me/notes.md", "a~b", "~/x"}},
+		{name: "lone tilde", program: "cd ~", expected: []string{"cd", "/home/me"}},
+		{name: "variables", program: `aider --model $MODEL --read "${DIR}/my prompt.md" '$MODEL' x$MODEL-y`,
+			expected: []string{"aider", "--model", "gpt 4", "--read", "/tmp/d/my prompt.md", "$MODEL", "xgpt 4-y"}},
+		{name: "unset variables", program: `claude $UNSET "$UNSET" --yes`, expected: []string{"claude", "", "--yes"}},
+		{name: "not a variable", program: `echo $ $1 \$MODEL`, expected: []string{"echo", "$", "$1", "$MODEL"}},
+	}
+
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("MODEL", "gpt 4")
+	t.Setenv("DIR", "/tmp/d")
+	t.Setenv("UNSET", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := SplitProgram(tt.program)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, args)
+		})
+	}
+
+	for _, program := range []string{"", "   ", `aider "unterminated`, "aider 'unterminated", `aider trailing\`, "claude ${MODEL", "claude ${1x}"} {
+		_, err := SplitProgram(program)
+		require.Error(t, err, program)
+	}
+}
@@ -13,9 +13,13 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/creack/pty"
 )
@@ -32,6 +36,8 @@ type TmuxSession struct {
 	// The name of the tmux session and the sanitized name used for tmux commands.
 	sanitizedName string
 	program       string
+	// agent recognizes the program's prompts. Defaults to the agent matching the program.
+	agent *Agent
 	// repoPath is the canonical path to the repository this session belongs to.
 	// Used for storing in tmux environment for orphan detection.
 	repoPath string
@@ -39,6 +45,16 @@ type TmuxSession struct {
 	ptyFactory PtyFactory
 	// cmdExec is used to execute commands in the tmux session.
 	cmdExec cmd.Executor
+	// options are extra "name value" tmux options applied to the session by Start (see config.TmuxOptions).
+	options []string
+	// historyLimit is the scrollback history-limit set on the session by Start.
+	historyLimit int
+	// windowName is the name Start gives the session's window. Empty leaves it to tmux's automatic naming.
+	windowName string
+	// env are NAME=value variables Start runs the program with.
+	env []string
+	// redactor removes secrets from the pane text the session captures. nil leaves it as it is.
+	redactor *config.Redactor
 
 	// Initialized by Start or Restore
 	//
@@ -59,15 +75,72 @@ type TmuxSession struct {
 	ctx    context.Context
 	cancel func()
 	wg     *sync.WaitGroup
+
+	// confirmPending is set while SendConfirmKeys waits to send an answer, so the prompt isn't answered twice.
+	confirmPending atomic.Bool
 }
 
 const TmuxPrefix = "claudesquad_"
 
+const (
+	// startMaxAttempts is the number of times Start tries to create a session before giving up.
+	startMaxAttempts = 3
+	// startRetryBackoff is the initial delay between attempts. It doubles after every attempt.
+	startRetryBackoff = 100 * time.Millisecond
+)
+
+// maxTmuxTitleLength caps the title part of a tmux session name. Longer titles are truncated and suffixed with a
+// hash of the full title so that titles sharing a long prefix still get distinct sessions.
+const maxTmuxTitleLength = 48
+
 var whiteSpaceRegex = regexp.MustCompile(`\s+`)
 
+// sanitizeTmuxTitle turns an instance title into a string that is safe to use in a tmux session name. The result
+// only contains printable ASCII. If characters had to be replaced or the title was truncated, a hash of the original
+// title is appended so that different titles still map to different sessions.
+func sanitizeTmuxTitle(title string) string {
+	replaced := false
+	sanitized := whiteSpaceRegex.ReplaceAllString(title, "")
+	sanitized = strings.Map(func(r rune) rune {
+		switch {
+		case r == '.' || r == ':':
+			// tmux replaces . and : with _ since they are target separators.
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		case r > unicode.MaxASCII:
+			// Non-ASCII titles (CJK, emoji) are kept as-is in the instance title, but tmux names depend on the
+			// client locale, so we use a placeholder here.
+			replaced = true
+			return '_'
+		default:
+			return r
+		}
+	}, sanitized)
+
+	if replaced || len(sanitized) > maxTmuxTitleLength {
+		suffix := titleHash(title)
+		if maxLen := maxTmuxTitleLength - len(suffix) - 1; len(sanitized) > maxLen {
+			sanitized = sanitized[:maxLen]
+		}
+		sanitized += "_" + suffix
+	}
+	return sanitized
+}
+
+// SameSessionName returns true if two instance titles map to the same tmux session name.
+func SameSessionName(a, b string) bool {
+	return sanitizeTmuxTitle(a) == sanitizeTmuxTitle(b)
+}
+
+// titleHash returns a short hash of the title used to keep sanitized names unique.
+func titleHash(title string) string {
+	hash := sha256.Sum256([]byte(title))
+	return fmt.Sprintf("%x", hash[:3])
+}
+
 func toClaudeSquadTmuxName(title string, repoPath string) string {
-	title = whiteSpaceRegex.ReplaceAllString(title, "")
-	title = strings.ReplaceAll(title, ".", "_") // tmux replaces all . with _
+	title = sanitizeTmuxTitle(title)
 
 	// Get repo hash to namespace tmux sessions
 	repoHash, err := config.GetRepoHash(repoPath)
@@ -80,9 +153,22 @@ func toClaudeSquadTmuxName(title string, repoPath string) string {
 	return fmt.Sprintf("%s%s_%s", TmuxPrefix, repoHash, title)
 }
 
-// NewTmuxSession creates a new TmuxSession with the given name, program, and repo path.
+// SessionName returns the name of the tmux session of the instance with the given title in the repository.
+func SessionName(title string, repoPath string) string {
+	return toClaudeSquadTmuxName(title, repoPath)
+}
+
+// NewTmuxSession creates a new TmuxSession with the given name, program, and repo path. The session options
+// come from the config.
 func NewTmuxSession(name string, program string, repoPath string) *TmuxSession {
-	return newTmuxSession(name, program, repoPath, MakePtyFactory(), cmd.MakeExecutor())
+	t := newTmuxSession(name, program, repoPath, MakePtyFactory(), cmd.MakeExecutor())
+	cfg := config.LoadConfig()
+	t.options = cfg.TmuxOptions
+	t.redactor = cfg.Redactor()
+	if cfg.HistoryLimit > 0 {
+		t.historyLimit = cfg.HistoryLimit
+	}
+	return t
 }
 
 // NewTmuxSessionWithDeps creates a new TmuxSession with provided dependencies for testing.
@@ -102,9 +188,60 @@ func newTmuxSession(name string, program string, repoPath string, ptyFactory Pty
 	return &TmuxSession{
 		sanitizedName: toClaudeSquadTmuxName(name, repoPath),
 		program:       program,
+		agent:         AgentForProgram(program),
 		repoPath:      canonicalPath,
 		ptyFactory:    ptyFactory,
 		cmdExec:       cmdExec,
+		historyLimit:  config.DefaultHistoryLimit,
+	}
+}
+
+// Agent returns the agent the session's program is treated as.
+func (t *TmuxSession) Agent() *Agent {
+	return t.agent
+}
+
+// SetAgent overrides the agent picked from the session's program, e.g. for a wrapper script around an agent.
+func (t *TmuxSession) SetAgent(agent *Agent) {
+	t.agent = agent
+}
+
+// SetWindowName sets the name Start gives the session's window, e.g. the instance's title. Empty leaves it to tmux,
+// which names it after the running program.
+func (t *TmuxSession) SetWindowName(name string) {
+	t.windowName = name
+}
+
+// SetEnv sets NAME=value variables Start runs the program with, on top of the environment tmux gives it.
+func (t *TmuxSession) SetEnv(env []string) {
+	t.env = env
+}
+
+// Name returns the name of the tmux session.
+func (t *TmuxSession) Name() string {
+	return t.sanitizedName
+}
+
+// tmuxOptionNameRegex matches tmux option names, including user options starting with @.
+var tmuxOptionNameRegex = regexp.MustCompile(`^@?[a-zA-Z0-9-]+$`)
+
+// applyOptions sets the configured options on the session. Options that don't look like "name [value]" or that tmux
+// rejects are logged and skipped.
+func (t *TmuxSession) applyOptions() {
+	for _, option := range t.options {
+		fields := strings.Fields(option)
+		if len(fields) == 0 || !tmuxOptionNameRegex.MatchString(fields[0]) {
+			log.WarningLog.Printf("ignoring invalid tmux option %q", option)
+			continue
+		}
+
+		args := []string{"set-option", "-t", t.sanitizedName, fields[0]}
+		if len(fields) > 1 {
+			args = append(args, strings.Join(fields[1:], " "))
+		}
+		if err := t.cmdExec.Run(exec.Command("tmux", args...)); err != nil {
+			log.WarningLog.Printf("failed to set tmux option %q for session %s: %v", option, t.sanitizedName, err)
+		}
 	}
 }
 
@@ -116,57 +253,81 @@ func (t *TmuxSession) Start(workDir string) error {
 		return fmt.Errorf("tmux session already exists: %s", t.sanitizedName)
 	}
 
-	// Create a new detached tmux session and start claude in it
-	cmd := exec.Command("tmux", "new-session", "-d", "-s", t.sanitizedName, "-c", workDir, t.program)
-
-	ptmx, err := t.ptyFactory.Start(cmd)
+	programArgs, err := SplitProgram(t.program)
 	if err != nil {
-		// Cleanup any partially created session if any exists.
-		if t.DoesSessionExist() {
-			cleanupCmd := exec.Command("tmux", "kill-session", "-t", t.sanitizedName)
-			if cleanupErr := t.cmdExec.Run(cleanupCmd); cleanupErr != nil {
-				err = fmt.Errorf("%v (cleanup error: %v)", err, cleanupErr)
-			}
-		}
-		return fmt.Errorf("error starting tmux session: %w", err)
+		return fmt.Errorf("invalid program: %w", err)
+	}
+	if len(t.env) > 0 || strings.Contains(programArgs[0], "=") {
+		// Leading VAR=value assignments are a shell feature; env applies them without one. The program's own
+		// assignments come last, so they win over the session's.
+		programArgs = append(append([]string{"env"}, t.env...), programArgs...)
 	}
 
-	// Poll for session existence with exponential backoff
-	timeout := time.After(2 * time.Second)
-	sleepDuration := 5 * time.Millisecond
-	for !t.DoesSessionExist() {
-		select {
-		case <-timeout:
-			if cleanupErr := t.Close(); cleanupErr != nil {
-				err = fmt.Errorf("%v (cleanup error: %v)", err, cleanupErr)
-			}
-			return fmt.Errorf("timed out waiting for tmux session %s: %v", t.sanitizedName, err)
-		default:
-			time.Sleep(sleepDuration)
-			// Exponential backoff up to 50ms max
-			if sleepDuration < 50*time.Millisecond {
-				sleepDuration *= 2
-			}
+	backoff := startRetryBackoff
+	for attempt := 1; attempt <= startMaxAttempts; attempt++ {
+		err = t.newSession(workDir, programArgs)
+		if err == nil {
+			break
+		}
+		if t.DoesSessionExist() {
+			// The session came up even though we saw an error, e.g. it appeared right after we stopped polling.
+			log.WarningLog.Printf("reusing tmux session %s after creation error: %v", t.sanitizedName, err)
+			err = nil
+			break
 		}
+		if isFatalStartError(err) || attempt == startMaxAttempts {
+			break
+		}
+		log.WarningLog.Printf("failed to create tmux session %s (attempt %d/%d), retrying in %v: %v",
+			t.sanitizedName, attempt, startMaxAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("error starting tmux session: %w", err)
 	}
-	ptmx.Close()
 
-	// Set history limit to enable scrollback (default is 2000, we'll use 10000 for more history)
-	historyCmd := exec.Command("tmux", "set-option", "-t", t.sanitizedName, "history-limit", "10000")
+	// The session's first pane got the history-limit when it was created (see newSession); this is for the panes and
+	// windows created in it later.
+	historyCmd := exec.Command("tmux", "set-option", "-t", t.sanitizedName, "history-limit", strconv.Itoa(t.historyLimit))
 	if err := t.cmdExec.Run(historyCmd); err != nil {
 		log.InfoLog.Printf("Warning: failed to set history-limit for session %s: %v", t.sanitizedName, err)
 	}
 
 	// Enable mouse scrolling for the session
-	mouseCmd := exec.Command("tmux", "set-option", "-t", t.sanitizedName, "mouse", "on")
-	if err := t.cmdExec.Run(mouseCmd); err != nil {
-		log.InfoLog.Printf("Warning: failed to enable mouse scrolling for session %s: %v", t.sanitizedName, err)
+	if supported(FeatureMouse) {
+		mouseCmd := exec.Command("tmux", "set-option", "-t", t.sanitizedName, "mouse", "on")
+		if err := t.cmdExec.Run(mouseCmd); err != nil {
+			log.InfoLog.Printf("Warning: failed to enable mouse scrolling for session %s: %v", t.sanitizedName, err)
+		}
 	}
 
-	// Store repo path in tmux environment for orphan detection
-	setenvCmd := exec.Command("tmux", "setenv", "-t", t.sanitizedName, "CLAUDE_SQUAD_REPO", t.repoPath)
-	if err := t.cmdExec.Run(setenvCmd); err != nil {
-		log.WarningLog.Printf("failed to set repo path env var for session %s: %v", t.sanitizedName, err)
+	t.applyOptions()
+
+	if t.windowName != "" {
+		// A renamed window keeps its name rather than following the running program.
+		renameCmd := exec.Command("tmux", "rename-window", "-t", t.sanitizedName, t.windowName)
+		if err := t.cmdExec.Run(renameCmd); err != nil {
+			log.WarningLog.Printf("failed to rename the window of session %s: %v", t.sanitizedName, err)
+		}
+	}
+
+	// Store repo path in tmux environment for orphan detection. Without it, cleanup can't tell which repository the
+	// session belongs to.
+	if supported(FeatureSessionEnv) {
+		setenvCmd := exec.Command("tmux", "setenv", "-t", t.sanitizedName, "CLAUDE_SQUAD_REPO", t.repoPath)
+		if err := t.cmdExec.Run(setenvCmd); err != nil {
+			log.WarningLog.Printf("failed to set repo path env var for session %s: %v", t.sanitizedName, err)
+		}
+
+		// Store the program too so cleanup can show what each session runs
+		setenvCmd = exec.Command("tmux", "setenv", "-t", t.sanitizedName, "CLAUDE_SQUAD_PROGRAM", t.program)
+		if err := t.cmdExec.Run(setenvCmd); err != nil {
+			log.WarningLog.Printf("failed to set program env var for session %s: %v", t.sanitizedName, err)
+		}
+	} else {
+		log.WarningLog.Printf("not tracking the repository of session %s: %v", t.sanitizedName,
+			unsupportedError(FeatureSessionEnv))
 	}
 
 	err = t.Restore()
@@ -177,32 +338,23 @@ func (t *TmuxSession) Start(workDir string) error {
 		return fmt.Errorf("error restoring tmux session: %w", err)
 	}
 
-	if strings.HasSuffix(t.program, ProgramClaude) || strings.HasSuffix(t.program, ProgramAider) || strings.HasSuffix(t.program, ProgramGemini) {
-		searchString := "Do you trust the files in this folder?"
-		tapFunc := t.TapEnter
-		maxWaitTime := 30 * time.Second // Much longer timeout for slower systems
-		if !strings.HasSuffix(t.program, ProgramClaude) {
-			searchString = "Open documentation url for more info"
-			tapFunc = t.TapDAndEnter
-			maxWaitTime = 45 * time.Second // Aider/Gemini take longer to start
-		}
-
-		// Deal with "do you trust the files" screen by sending an enter keystroke.
+	if t.agent.TrustMarker != "" {
+		// Deal with the "do you trust the files" screen by sending the agent's keystrokes.
 		// Use exponential backoff with longer timeout for reliability on slow systems
 		startTime := time.Now()
 		sleepDuration := 100 * time.Millisecond
 		attempt := 0
 
-		for time.Since(startTime) < maxWaitTime {
+		for time.Since(startTime) < t.agent.TrustTimeout {
 			attempt++
 			time.Sleep(sleepDuration)
 			content, err := t.CapturePaneContent()
 			if err != nil {
 				// Session might not be ready yet, continue waiting
 			} else {
-				if strings.Contains(content, searchString) {
-					if err := tapFunc(); err != nil {
-						log.ErrorLog.Printf("could not tap enter on trust screen: %v", err)
+				if strings.Contains(content, t.agent.TrustMarker) {
+					if err := t.SendKeys(t.agent.TrustKeys); err != nil {
+						log.ErrorLog.Printf("could not accept trust screen: %v", err)
 					}
 					break
 				}
@@ -218,6 +370,86 @@ func (t *TmuxSession) Start(workDir string) error {
 	return nil
 }
 
+// newSession runs `tmux new-session` for a single creation attempt and waits for the session to show up.
+// programArgs are passed to tmux separately, so tmux runs the program directly instead of through a shell that
+// would split them again.
+func (t *TmuxSession) newSession(workDir string, programArgs []string) error {
+	// Create a new detached tmux session and start claude in it
+	args := append([]string{"new-session", "-d", "-s", t.sanitizedName, "-c", workDir}, programArgs...)
+	if supported(FeatureOptionFormats) {
+		args = t.withHistoryLimit(args)
+		// Runs last, once the tmux client below is done, whether or not the session was created.
+		defer t.restoreHistoryLimit()
+	} else {
+		log.WarningLog.Printf("the scrollback of session %s keeps tmux's history-limit: %v", t.sanitizedName,
+			unsupportedError(FeatureOptionFormats))
+	}
+	cmd := exec.Command("tmux", args...)
+
+	ptmx, err := t.ptyFactory.Start(cmd)
+	if err != nil {
+		return err
+	}
+	// The new-session PTY is no longer needed once the session exists. Restore opens the attach PTY we keep.
+	defer ptmx.Close()
+	defer func() {
+		// With -d, the client exits as soon as it ran the command sequence.
+		if cmd.Process != nil {
+			_ = cmd.Wait()
+		}
+	}()
+
+	// Poll for session existence with exponential backoff
+	timeout := time.After(2 * time.Second)
+	sleepDuration := 5 * time.Millisecond
+	for !t.DoesSessionExist() {
+		select {
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for tmux session %s", t.sanitizedName)
+		default:
+			time.Sleep(sleepDuration)
+			// Exponential backoff up to 50ms max
+			if sleepDuration < 50*time.Millisecond {
+				sleepDuration *= 2
+			}
+		}
+	}
+	return nil
+}
+
+// historyLimitSaveOption is the user option withHistoryLimit keeps the global history-limit in meanwhile.
+const historyLimitSaveOption = "@claudesquad-history-limit"
+
+// withHistoryLimit wraps the tmux command in args, which creates a pane, so that the pane gets the session's
+// history-limit. A pane's scrollback is sized when it's created, from the global option for the first pane of a new
+// session, so the global option is set for the command, keeping the old value in historyLimitSaveOption. tmux skips
+// the rest of a command sequence once a command fails, so restoreHistoryLimit puts it back in a separate call.
+func (t *TmuxSession) withHistoryLimit(args []string) []string {
+	wrapped := []string{
+		"set-option", "-gF", historyLimitSaveOption, "#{history-limit}", ";",
+		"set-option", "-g", "history-limit", strconv.Itoa(t.historyLimit), ";",
+	}
+	return append(wrapped, args...)
+}
+
+// restoreHistoryLimit sets the global history-limit back to the value withHistoryLimit saved. It leaves it alone if
+// nothing was saved, e.g. because the command never ran.
+func (t *TmuxSession) restoreHistoryLimit() {
+	saved := "#{" + historyLimitSaveOption + "}"
+	restoreCmd := exec.Command("tmux",
+		"set-option", "-gF", "history-limit", "#{?"+saved+","+saved+",#{history-limit}}", ";",
+		"set-option", "-gqu", historyLimitSaveOption)
+	if err := t.cmdExec.Run(restoreCmd); err != nil {
+		log.WarningLog.Printf("failed to restore tmux's history-limit after creating session %s: %v",
+			t.sanitizedName, err)
+	}
+}
+
+// isFatalStartError returns true if retrying session creation can't help, e.g. tmux isn't installed.
+func isFatalStartError(err error) bool {
+	return errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrPermission)
+}
+
 // Restore attaches to an existing session and restores the window size
 func (t *TmuxSession) Restore() error {
 	ptmx, err := t.ptyFactory.Start(exec.Command("tmux", "attach-session", "-t", t.sanitizedName))
@@ -232,6 +464,8 @@ func (t *TmuxSession) Restore() error {
 type statusMonitor struct {
 	// Store hashes to save memory.
 	prevOutputHash []byte
+	// prompt is the prompt marker the pane showed on the last check, if any.
+	prompt string
 }
 
 func newStatusMonitor() *statusMonitor {
@@ -255,11 +489,38 @@ func (t *TmuxSession) TapEnter() error {
 	return nil
 }
 
-// TapDAndEnter sends 'D' followed by an enter keystroke to the tmux pane.
-func (t *TmuxSession) TapDAndEnter() error {
-	_, err := t.ptmx.Write([]byte{0x44, 0x0D})
-	if err != nil {
-		return fmt.Errorf("error sending enter keystroke to PTY: %w", err)
+// clearLineKey is C-u, which clears the input line in most line editors.
+const clearLineKey = "\x15"
+
+// SendConfirmKeys sends keys to answer a prompt, with the input line cleared first if clearLine is set. With a
+// delay, which lets the prompt be fully drawn, the keys are sent from a goroutine once it has passed, so callers such
+// as the TUI's Update don't wait, and a failure to send them is only logged. sent is false if an earlier answer is
+// still waiting to be sent, in which case nothing is sent.
+func (t *TmuxSession) SendConfirmKeys(keys string, delay time.Duration, clearLine bool) (sent bool, err error) {
+	if clearLine {
+		keys = clearLineKey + keys
+	}
+	if delay <= 0 {
+		return true, t.sendLiteralKeys(keys)
+	}
+	if !t.confirmPending.CompareAndSwap(false, true) {
+		return false, nil
+	}
+	time.AfterFunc(delay, func() {
+		defer t.confirmPending.Store(false)
+		if err := t.sendLiteralKeys(keys); err != nil {
+			log.ErrorLog.Printf("failed to answer the prompt of session %s: %v", t.sanitizedName, err)
+		}
+	})
+	return true, nil
+}
+
+// sendLiteralKeys types keys into the session's pane with tmux send-keys. Unlike writing to the PTY, it's safe from
+// any goroutine, even while the session is being paused or closed.
+func (t *TmuxSession) sendLiteralKeys(keys string) error {
+	cmd := exec.Command("tmux", "send-keys", "-t", t.sanitizedName, "-l", keys)
+	if err := t.cmdExec.Run(cmd); err != nil {
+		return fmt.Errorf("error sending keys to session %s: %w", t.sanitizedName, err)
 	}
 	return nil
 }
@@ -269,8 +530,8 @@ func (t *TmuxSession) SendKeys(keys string) error {
 	return err
 }
 
-// HasUpdated checks if the tmux pane content has changed since the last tick. It also returns true if
-// the tmux pane has a prompt for aider or claude code.
+// HasUpdated checks if the tmux pane content has changed since the last tick. hasPrompt is true if the pane shows
+// the session's agent waiting for a confirmation.
 func (t *TmuxSession) HasUpdated() (updated bool, hasPrompt bool) {
 	content, err := t.CapturePaneContent()
 	if err != nil {
@@ -278,14 +539,8 @@ func (t *TmuxSession) HasUpdated() (updated bool, hasPrompt bool) {
 		return false, false
 	}
 
-	// Only set hasPrompt for claude and aider. Use these strings to check for a prompt.
-	if t.program == ProgramClaude {
-		hasPrompt = strings.Contains(content, "No, and tell Claude what to do differently")
-	} else if strings.HasPrefix(t.program, ProgramAider) {
-		hasPrompt = strings.Contains(content, "(Y)es/(N)o/(D)on't ask again")
-	} else if strings.HasPrefix(t.program, ProgramGemini) {
-		hasPrompt = strings.Contains(content, "Yes, allow once")
-	}
+	t.monitor.prompt = t.agent.MatchPrompt(content)
+	hasPrompt = t.monitor.prompt != ""
 
 	if !bytes.Equal(t.monitor.hash(content), t.monitor.prevOutputHash) {
 		t.monitor.prevOutputHash = t.monitor.hash(content)
@@ -294,6 +549,35 @@ func (t *TmuxSession) HasUpdated() (updated bool, hasPrompt bool) {
 	return false, hasPrompt
 }
 
+// Prompt returns the prompt marker the pane showed when HasUpdated last checked it, or "" if it showed none.
+func (t *TmuxSession) Prompt() string {
+	return t.monitor.prompt
+}
+
+// AttachTerminal attaches the current terminal to the session with a regular tmux client and blocks until it
+// detaches. Unlike Attach, this doesn't need a PTY from Start or Restore.
+//
+// Inside tmux (e.g. over SSH into a machine where tmux already runs), nesting a client would be awkward, so the
+// current client is switched to the session instead and AttachTerminal returns right away.
+func (t *TmuxSession) AttachTerminal() error {
+	if os.Getenv("TMUX") != "" {
+		switchCmd := exec.Command("tmux", "switch-client", "-t", t.sanitizedName)
+		if err := t.cmdExec.Run(switchCmd); err != nil {
+			return fmt.Errorf("failed to switch to session %s: %w", t.sanitizedName, err)
+		}
+		return nil
+	}
+
+	attachCmd := exec.Command("tmux", "attach-session", "-t", t.sanitizedName)
+	attachCmd.Stdin = os.Stdin
+	attachCmd.Stdout = os.Stdout
+	attachCmd.Stderr = os.Stderr
+	if err := t.cmdExec.Run(attachCmd); err != nil {
+		return fmt.Errorf("failed to attach to session %s: %w", t.sanitizedName, err)
+	}
+	return nil
+}
+
 func (t *TmuxSession) Attach() (chan struct{}, error) {
 	t.attachCh = make(chan struct{})
 
@@ -412,6 +696,20 @@ func (t *TmuxSession) DetachSafely() error {
 	return nil
 }
 
+// Disconnect closes the attach PTY without killing the tmux session. The session keeps running in the background.
+// The TmuxSession can't be used afterwards until Restore is called again.
+func (t *TmuxSession) Disconnect() error {
+	if t.ptmx == nil {
+		return nil
+	}
+	err := t.ptmx.Close()
+	t.ptmx = nil
+	if err != nil {
+		return fmt.Errorf("error closing attach pty session: %w", err)
+	}
+	return nil
+}
+
 // Detach disconnects from the current tmux session. It panics if detaching fails. At the moment, there's no
 // way to recover from a failed detach.
 func (t *TmuxSession) Detach() {
@@ -448,8 +746,13 @@ func (t *TmuxSession) Detach() {
 	t.wg.Wait()
 }
 
-// Close terminates the tmux session and cleans up resources
+// Close terminates the tmux session and cleans up resources. It closes the attach PTY and then the PTY factory,
+// so no file handles outlive the session. It's refused in safe mode.
 func (t *TmuxSession) Close() error {
+	if err := config.CheckSafeMode("killing tmux session " + t.sanitizedName); err != nil {
+		return err
+	}
+
 	var errs []error
 
 	if t.ptmx != nil {
@@ -458,6 +761,7 @@ func (t *TmuxSession) Close() error {
 		}
 		t.ptmx = nil
 	}
+	t.ptyFactory.Close()
 
 	cmd := exec.Command("tmux", "kill-session", "-t", t.sanitizedName)
 	if err := t.cmdExec.Run(cmd); err != nil {
@@ -484,6 +788,35 @@ func (t *TmuxSession) SetDetachedSize(width, height int) error {
 	return t.updateWindowSize(width, height)
 }
 
+// Resize fits the session's window to cols x rows. Use it before attaching, so that a window sized for another
+// client (tmux sizes windows for all attached clients, per the window-size option) doesn't garble the program's
+// UI until the terminal is resized. Afterwards the window follows the most recently active client again.
+func (t *TmuxSession) Resize(cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return fmt.Errorf("invalid size %dx%d", cols, rows)
+	}
+	if t.ptmx != nil {
+		if err := t.updateWindowSize(cols, rows); err != nil {
+			return fmt.Errorf("failed to resize pty of session %s: %w", t.sanitizedName, err)
+		}
+	}
+	resizeCmd := exec.Command("tmux", "resize-window", "-t", t.sanitizedName,
+		"-x", strconv.Itoa(cols), "-y", strconv.Itoa(rows))
+	if err := t.cmdExec.Run(resizeCmd); err != nil {
+		return fmt.Errorf("failed to resize window of session %s: %w", t.sanitizedName, err)
+	}
+	// resize-window switches the window to a manual size, which would stop it from following the terminal.
+	if !supported(FeatureWindowSizeLatest) {
+		log.WarningLog.Printf("session %s keeps its size: %v", t.sanitizedName, unsupportedError(FeatureWindowSizeLatest))
+		return nil
+	}
+	sizeCmd := exec.Command("tmux", "set-option", "-w", "-t", t.sanitizedName, "window-size", "latest")
+	if err := t.cmdExec.Run(sizeCmd); err != nil {
+		return fmt.Errorf("failed to reset window size of session %s: %w", t.sanitizedName, err)
+	}
+	return nil
+}
+
 // updateWindowSize updates the window size of the PTY.
 func (t *TmuxSession) updateWindowSize(cols, rows int) error {
 	return pty.Setsize(t.ptmx, &pty.Winsize{
@@ -500,7 +833,56 @@ func (t *TmuxSession) DoesSessionExist() bool {
 	return t.cmdExec.Run(existsCmd) == nil
 }
 
-// CapturePaneContent captures the content of the tmux pane
+// LiveSessions returns the names of the running tmux sessions with one tmux call, for callers that check many
+// sessions at once. No tmux server running means no sessions.
+func LiveSessions(cmdExec cmd.Executor) (map[string]bool, error) {
+	output, err := cmdExec.Output(exec.Command("tmux", "list-panes", "-a", "-F", "#{session_name}"))
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return map[string]bool{}, nil
+		}
+		return nil, fmt.Errorf("failed to list tmux panes: %v", err)
+	}
+	live := make(map[string]bool)
+	for _, name := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if name != "" {
+			live[name] = true
+		}
+	}
+	return live, nil
+}
+
+// SessionActivity returns when each running tmux session's windows last had output, with one tmux call. No tmux
+// server running means no sessions.
+func SessionActivity(cmdExec cmd.Executor) (map[string]time.Time, error) {
+	output, err := cmdExec.Output(exec.Command("tmux", "list-windows", "-a", "-F", "#{session_name} #{window_activity}"))
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return map[string]time.Time{}, nil
+		}
+		return nil, fmt.Errorf("failed to list tmux windows: %v", err)
+	}
+	activity := make(map[string]time.Time)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		// Session names may contain spaces, the activity doesn't.
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			continue
+		}
+		name, value := line[:i], line[i+1:]
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing activity %q of session %s: %v", value, name, err)
+		}
+		if last := time.Unix(seconds, 0); last.After(activity[name]) {
+			activity[name] = last
+		}
+	}
+	return activity, nil
+}
+
+// CapturePaneContent captures the content of the tmux pane, with secrets redacted (see config.Redactor) like every
+// capture.
 func (t *TmuxSession) CapturePaneContent() (string, error) {
 	// Add -e flag to preserve escape sequences (ANSI color codes)
 	cmd := exec.Command("tmux", "capture-pane", "-p", "-e", "-J", "-t", t.sanitizedName)
@@ -508,7 +890,7 @@ func (t *TmuxSession) CapturePaneContent() (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("error capturing pane content: %v", err)
 	}
-	return string(output), nil
+	return t.redactor.Redact(string(output)), nil
 }
 
 // CapturePaneContentWithOptions captures the pane content with additional options
@@ -520,16 +902,49 @@ func (t *TmuxSession) CapturePaneContentWithOptions(start, end string) (string,
 	if err != nil {
 		return "", fmt.Errorf("failed to capture tmux pane content with options: %v", err)
 	}
-	return string(output), nil
+	return t.redactor.Redact(string(output)), nil
+}
+
+// DefaultCaptureLines is how many lines CaptureHistory returns by default. Sessions keep tens of thousands of lines
+// of scrollback, so capturing all of it on every read would cost megabytes.
+const DefaultCaptureLines = 500
+
+// CaptureHistory returns the last maxLines lines of the pane's output, scrollback included, as plain text without
+// escape sequences. A maxLines of 0 or less returns the full history. Only the requested lines are read from tmux,
+// so memory stays bounded however long the session has been running.
+func (t *TmuxSession) CaptureHistory(maxLines int) (string, error) {
+	start := "-"
+	if maxLines > 0 {
+		// -S counts back from the top of the visible pane, so this reads a pane's height more than needed. The
+		// extra lines are dropped below, once the blank rows under the cursor are trimmed.
+		start = "-" + strconv.Itoa(maxLines)
+	}
+	cmd := exec.Command("tmux", "capture-pane", "-p", "-J", "-S", start, "-t", t.sanitizedName)
+	output, err := t.cmdExec.Output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error capturing pane history: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(t.redactor.Redact(string(output)), "\n"), "\n")
+	if maxLines > 0 && len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return strings.Join(lines, "\n") + "\n", nil
 }
 
 // CleanupSessions kills all tmux sessions that start with "session-"
 func CleanupSessions(cmdExec cmd.Executor) error {
-	return CleanupSessionsByPrefix(cmdExec, TmuxPrefix)
+	return CleanupSessionsByPrefix(cmdExec, TmuxPrefix, nil, nil)
 }
 
-// CleanupSessionsByPrefix removes all tmux sessions matching a specific prefix
-func CleanupSessionsByPrefix(cmdExec cmd.Executor, prefix string) error {
+// CleanupSessionsByPrefix removes all tmux sessions matching a specific prefix, except the sessions named in keep. If
+// progress is non-nil, it's called before each session is killed. It's refused in safe mode.
+func CleanupSessionsByPrefix(cmdExec cmd.Executor, prefix string, keep []string,
+	progress func(current, total int, name string)) error {
+	if err := config.CheckSafeMode("killing the tmux sessions starting with " + prefix); err != nil {
+		return err
+	}
+
 	// First try to list sessions
 	cmd := exec.Command("tmux", "ls")
 	output, err := cmdExec.Output(cmd)
@@ -544,12 +959,17 @@ func CleanupSessionsByPrefix(cmdExec cmd.Executor, prefix string) error {
 	}
 
 	re := regexp.MustCompile(fmt.Sprintf(`%s.*:`, regexp.QuoteMeta(prefix)))
-	matches := re.FindAllString(string(output), -1)
-	for i, match := range matches {
-		matches[i] = match[:strings.Index(match, ":")]
+	var matches []string
+	for _, match := range re.FindAllString(string(output), -1) {
+		if name := match[:strings.Index(match, ":")]; !slices.Contains(keep, name) {
+			matches = append(matches, name)
+		}
 	}
 
-	for _, match := range matches {
+	for i, match := range matches {
+		if progress != nil {
+			progress(i+1, len(matches), match)
+		}
 		log.InfoLog.Printf("cleaning up session: %s", match)
 		if err := cmdExec.Run(exec.Command("tmux", "kill-session", "-t", match)); err != nil {
 			return fmt.Errorf("failed to kill tmux session %s: %v", match, err)
@@ -2,25 +2,42 @@ package tmux
 
 import (
 	cmd2 "claude-squad/cmd"
+	"claude-squad/config"
+	"claude-squad/log"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"claude-squad/cmd/cmd_test"
 
 	"github.com/stretchr/testify/require"
 )
 
+// TestMain runs before all tests to set up the test environment
+func TestMain(m *testing.M) {
+	// Initialize the logger before any tests run
+	log.Initialize(false)
+	defer log.Close()
+
+	exitCode := m.Run()
+	os.Exit(exitCode)
+}
+
 type MockPtyFactory struct {
 	t *testing.T
 
 	// Array of commands and the corresponding file handles representing PTYs.
 	cmds  []*exec.Cmd
 	files []*os.File
+	// closed is set when the session tears down the factory.
+	closed bool
 }
 
 func (pt *MockPtyFactory) Start(cmd *exec.Cmd) (*os.File, error) {
@@ -33,7 +50,9 @@ func (pt *MockPtyFactory) Start(cmd *exec.Cmd) (*os.File, error) {
 	return f, err
 }
 
-func (pt *MockPtyFactory) Close() {}
+func (pt *MockPtyFactory) Close() {
+	pt.closed = true
+}
 
 func NewMockPtyFactory(t *testing.T) *MockPtyFactory {
 	return &MockPtyFactory{
@@ -57,12 +76,16 @@ func TestStartTmuxSession(t *testing.T) {
 	ptyFactory := NewMockPtyFactory(t)
 
 	created := false
+	var restores []string
 	cmdExec := cmd_test.MockCmdExec{
 		RunFunc: func(cmd *exec.Cmd) error {
 			if strings.Contains(cmd.String(), "has-session") && !created {
 				created = true
 				return fmt.Errorf("session already exists")
 			}
+			if strings.Contains(cmd.String(), "-gF history-limit") {
+				restores = append(restores, cmd2.ToString(cmd))
+			}
 			return nil
 		},
 		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
@@ -77,17 +100,387 @@ func TestStartTmuxSession(t *testing.T) {
 	err := session.Start(workdir)
 	require.NoError(t, err)
 	require.Equal(t, 2, len(ptyFactory.cmds))
-	require.Equal(t, fmt.Sprintf("tmux new-session -d -s %s -c %s claude", session.sanitizedName, workdir),
-		cmd2.ToString(ptyFactory.cmds[0]))
+	// The global history-limit is raised for the session's first pane, then restored by a call of its own.
+	require.Equal(t, fmt.Sprintf("tmux set-option -gF @claudesquad-history-limit #{history-limit} ; "+
+		"set-option -g history-limit %d ; new-session -d -s %s -c %s claude",
+		config.DefaultHistoryLimit, session.sanitizedName, workdir), cmd2.ToString(ptyFactory.cmds[0]))
+	require.Equal(t, []string{"tmux set-option -gF history-limit " +
+		"#{?#{@claudesquad-history-limit},#{@claudesquad-history-limit},#{history-limit}} ; " +
+		"set-option -gqu @claudesquad-history-limit"}, restores)
 	require.Equal(t, fmt.Sprintf("tmux attach-session -t %s", session.sanitizedName),
 		cmd2.ToString(ptyFactory.cmds[1]))
 
 	require.Equal(t, 2, len(ptyFactory.files))
 
-	// File should be closed.
+	// The new-session PTY should be closed once the session exists.
 	_, err = ptyFactory.files[0].Stat()
 	require.Error(t, err)
-	// File should be open
+	// The attach PTY should stay open while the session is alive.
 	_, err = ptyFactory.files[1].Stat()
 	require.NoError(t, err)
+	require.False(t, ptyFactory.closed)
+
+	// Closing the session releases the attach PTY and the factory.
+	require.NoError(t, session.Close())
+	_, err = ptyFactory.files[1].Stat()
+	require.Error(t, err)
+	require.True(t, ptyFactory.closed)
+}
+
+// flakyPtyFactory fails the first `failures` calls to Start with err before delegating to MockPtyFactory.
+type flakyPtyFactory struct {
+	*MockPtyFactory
+	failures int
+	err      error
+}
+
+func (pt *flakyPtyFactory) Start(cmd *exec.Cmd) (*os.File, error) {
+	if pt.failures > 0 {
+		pt.failures--
+		return nil, pt.err
+	}
+	return pt.MockPtyFactory.Start(cmd)
+}
+
+// TestStartTmuxSessionRetriesTransientErrors checks that a failed creation attempt is retried.
+func TestStartTmuxSessionRetriesTransientErrors(t *testing.T) {
+	ptyFactory := &flakyPtyFactory{MockPtyFactory: NewMockPtyFactory(t), failures: 1, err: fmt.Errorf("server exited unexpectedly")}
+
+	// The session doesn't exist for the pre-check and the check after the failed attempt.
+	hasSessionCalls := 0
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			if strings.Contains(cmd.String(), "has-session") {
+				hasSessionCalls++
+				if hasSessionCalls <= 2 {
+					return fmt.Errorf("no such session")
+				}
+			}
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return []byte("output"), nil
+		},
+	}
+
+	session := newTmuxSession("test-session", "bash", t.TempDir(), ptyFactory, cmdExec)
+	require.NoError(t, session.Start(t.TempDir()))
+	require.Equal(t, 2, len(ptyFactory.cmds))
+	require.Contains(t, cmd2.ToString(ptyFactory.cmds[0]), "new-session")
+	require.Contains(t, cmd2.ToString(ptyFactory.cmds[1]), "attach-session")
+}
+
+func TestLiveSessions(t *testing.T) {
+	cmdExec := cmd_test.MockCmdExec{
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			require.Contains(t, cmd.String(), "list-panes -a")
+			return []byte("claudesquad_a\nclaudesquad_a\nclaudesquad_b\n"), nil
+		},
+	}
+	live, err := LiveSessions(cmdExec)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"claudesquad_a": true, "claudesquad_b": true}, live)
+}
+
+func TestSessionActivity(t *testing.T) {
+	cmdExec := cmd_test.MockCmdExec{
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			require.Contains(t, cmd.String(), "list-windows -a")
+			return []byte("claudesquad_a 100\nclaudesquad_a 200\nmy session 300\n"), nil
+		},
+	}
+	activity, err := SessionActivity(cmdExec)
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Time{
+		"claudesquad_a": time.Unix(200, 0),
+		"my session":    time.Unix(300, 0),
+	}, activity)
+}
+
+// TestStartTmuxSessionFatalError checks that errors which retrying can't fix fail immediately.
+func TestStartTmuxSessionFatalError(t *testing.T) {
+	ptyFactory := &flakyPtyFactory{MockPtyFactory: NewMockPtyFactory(t), failures: startMaxAttempts, err: exec.ErrNotFound}
+
+	attempts := 0
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			if strings.Contains(cmd.String(), "has-session") {
+				attempts++
+				return fmt.Errorf("no such session")
+			}
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return []byte("output"), nil
+		},
+	}
+
+	session := newTmuxSession("test-session", "bash", t.TempDir(), ptyFactory, cmdExec)
+	err := session.Start(t.TempDir())
+	require.ErrorIs(t, err, exec.ErrNotFound)
+	// One pre-check and one check after the only attempt.
+	require.Equal(t, 2, attempts)
+	require.Equal(t, startMaxAttempts-1, ptyFactory.failures)
+}
+
+func TestSanitizeTmuxTitle(t *testing.T) {
+	longTitle := strings.Repeat("a", 60)
+	longTitleOther := strings.Repeat("a", 59) + "b"
+
+	tests := []struct {
+		name     string
+		title    string
+		expected string
+	}{
+		{name: "plain", title: "feature", expected: "feature"},
+		{name: "whitespace removed", title: "a sd\tf", expected: "asdf"},
+		{name: "dots replaced", title: "v1.2", expected: "v1_2"},
+		{name: "colons replaced", title: "fix: login", expected: "fix_login"},
+		{name: "control characters removed", title: "a\x00b\x1bc", expected: "abc"},
+		{name: "accented characters replaced", title: "café", expected: "caf__" + titleHash("café")},
+		{name: "CJK replaced", title: "日本語", expected: "____" + titleHash("日本語")},
+		{name: "emoji replaced", title: "fix 🐛", expected: "fix__" + titleHash("fix 🐛")},
+		{name: "long title truncated", title: longTitle, expected: strings.Repeat("a", 41) + "_" + titleHash(longTitle)},
+		{name: "long title with other suffix", title: longTitleOther, expected: strings.Repeat("a", 41) + "_" + titleHash(longTitleOther)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeTmuxTitle(tt.title)
+			require.Equal(t, tt.expected, got)
+			require.LessOrEqual(t, len([]rune(got)), maxTmuxTitleLength)
+		})
+	}
+
+	// Titles that only differ after the truncation point or in replaced characters must not collide.
+	require.NotEqual(t, sanitizeTmuxTitle(longTitle), sanitizeTmuxTitle(longTitleOther))
+	require.NotEqual(t, sanitizeTmuxTitle("日本"), sanitizeTmuxTitle("中国"))
+	require.NotEqual(t, sanitizeTmuxTitle("🚀"), sanitizeTmuxTitle("🔥"))
+}
+
+func TestResize(t *testing.T) {
+	var cmds []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			cmds = append(cmds, cmd2.ToString(cmd))
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return nil, nil
+		},
+	}
+	session := newTmuxSession("test-session", "claude", t.TempDir(), NewMockPtyFactory(t), cmdExec)
+
+	require.Error(t, session.Resize(0, 24))
+	require.Empty(t, cmds)
+
+	require.NoError(t, session.Resize(120, 40))
+	require.Equal(t, []string{
+		fmt.Sprintf("tmux resize-window -t %s -x 120 -y 40", session.sanitizedName),
+		fmt.Sprintf("tmux set-option -w -t %s window-size latest", session.sanitizedName),
+	}, cmds)
+}
+
+func TestAttachGrid(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	var cmds []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			cmds = append(cmds, cmd2.ToString(cmd))
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return nil, nil
+		},
+	}
+	repoPath := t.TempDir()
+	first := newTmuxSession("first", "claude", repoPath, NewMockPtyFactory(t), cmdExec)
+	second := newTmuxSession("second", "claude", repoPath, NewMockPtyFactory(t), cmdExec)
+
+	require.Error(t, attachGrid(cmdExec, nil))
+	require.NoError(t, attachGrid(cmdExec, []*TmuxSession{first, second}))
+
+	gridName := fmt.Sprintf("%s%d", gridSessionPrefix, os.Getpid())
+	require.Len(t, cmds, 4)
+	require.True(t, strings.HasPrefix(cmds[0], "tmux new-session -d -s "+gridName+" "))
+	require.Contains(t, cmds[0], "-f read-only,ignore-size -t '="+first.sanitizedName+"'")
+	require.True(t, strings.HasPrefix(cmds[1], "tmux split-window -t "+gridName+" "))
+	require.Contains(t, cmds[1], "'="+second.sanitizedName+"'")
+	require.Equal(t, "tmux select-layout -t "+gridName+" tiled", cmds[2])
+	require.Equal(t, "tmux attach-session -t "+gridName+" ; set-option -t "+gridName+" destroy-unattached on", cmds[3])
+}
+
+func TestStartTmuxSessionPassesProgramArgs(t *testing.T) {
+	ptyFactory := NewMockPtyFactory(t)
+
+	created := false
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			if strings.Contains(cmd.String(), "has-session") && !created {
+				created = true
+				return fmt.Errorf("session already exists")
+			}
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return []byte("output"), nil
+		},
+	}
+
+	workdir := t.TempDir()
+	session := newTmuxSession("test-session", `MODE=fast aider --read "/tmp/my prompt.md"`, t.TempDir(), ptyFactory, cmdExec)
+	session.SetEnv([]string{"MODE=slow", "TOKEN=x"})
+	require.NoError(t, session.Start(workdir))
+	require.Equal(t, append([]string{"tmux"}, session.withHistoryLimit([]string{"new-session", "-d", "-s",
+		session.sanitizedName, "-c", workdir, "env", "MODE=slow", "TOKEN=x", "MODE=fast", "aider", "--read", "/tmp/my prompt.md"})...),
+		ptyFactory.cmds[0].Args)
+	require.NoError(t, session.Close())
+
+	created = false
+	invalid := newTmuxSession("invalid", `aider "unterminated`, t.TempDir(), ptyFactory, cmdExec)
+	require.ErrorContains(t, invalid.Start(workdir), "unterminated")
+}
+
+// TestNewSessionRestoresHistoryLimit checks that the global history-limit is restored even when new-session fails,
+// which makes tmux skip the rest of its command sequence.
+func TestNewSessionRestoresHistoryLimit(t *testing.T) {
+	// A tmux server of its own, so the test doesn't touch the user's.
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	tmux := func(args ...string) string {
+		output, err := exec.Command("tmux", args...).CombinedOutput()
+		require.NoError(t, err, "tmux %v: %s", args, output)
+		return strings.TrimSpace(string(output))
+	}
+	tmux("new-session", "-d", "-s", "keep")
+	t.Cleanup(func() { _ = exec.Command("tmux", "kill-server").Run() })
+	tmux("set-option", "-g", "history-limit", "1234")
+
+	session := newTmuxSession("history", "sleep 60", t.TempDir(), MakePtyFactory(), cmd2.MakeExecutor())
+	session.historyLimit = 77777
+	require.NoError(t, session.newSession(t.TempDir(), []string{"sleep", "60"}))
+	require.Equal(t, "77777", tmux("display-message", "-p", "-t", session.sanitizedName, "#{history_limit}"))
+	require.Equal(t, "1234", tmux("show-option", "-gv", "history-limit"))
+
+	// The session exists now, so creating it again fails.
+	require.NoError(t, session.newSession(t.TempDir(), []string{"sleep", "60"}))
+	require.Equal(t, "1234", tmux("show-option", "-gv", "history-limit"))
+	require.Empty(t, tmux("show-option", "-gqv", historyLimitSaveOption))
+}
+
+func TestCaptureHistory(t *testing.T) {
+	var captured []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			captured = append(captured, cmd2.ToString(cmd))
+			// The visible pane ends in blank rows below the cursor.
+			return []byte("one\ntwo\nthree\nfour\n\n\n"), nil
+		},
+	}
+	session := newTmuxSession("test-session", "claude", t.TempDir(), NewMockPtyFactory(t), cmdExec)
+
+	output, err := session.CaptureHistory(2)
+	require.NoError(t, err)
+	require.Equal(t, "three\nfour\n", output)
+	require.Contains(t, captured[0], "-S -2")
+	require.NotContains(t, captured[0], "-e")
+
+	output, err = session.CaptureHistory(0)
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\nthree\nfour\n", output)
+	require.Contains(t, captured[1], "-S -")
+
+	// Captures are redacted.
+	session.redactor, err = config.NewRedactor([]string{`thr\w+`})
+	require.NoError(t, err)
+	output, err = session.CaptureHistory(0)
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\n[REDACTED]\nfour\n", output)
+	content, err := session.CapturePaneContent()
+	require.NoError(t, err)
+	require.Contains(t, content, "[REDACTED]")
+	require.NotContains(t, content, "three")
+}
+
+func TestSendConfirmKeys(t *testing.T) {
+	var mu sync.Mutex
+	var sent [][]string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, cmd.Args)
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return nil, nil
+		},
+	}
+	sentKeys := func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(sent)
+	}
+	session := newTmuxSession("test-session", "claude", t.TempDir(), NewMockPtyFactory(t), cmdExec)
+
+	// Without a delay, the keys are sent right away, after C-u if the line is to be cleared.
+	ok, err := session.SendConfirmKeys("\r", 0, true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, [][]string{{"tmux", "send-keys", "-t", session.sanitizedName, "-l", "\x15\r"}}, sentKeys())
+
+	// With one, the call returns at once and a second answer isn't queued while the first waits.
+	start := time.Now()
+	ok, err = session.SendConfirmKeys("y\r", 100*time.Millisecond, false)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	ok, err = session.SendConfirmKeys("y\r", 100*time.Millisecond, false)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Len(t, sentKeys(), 1)
+
+	require.Eventually(t, func() bool { return len(sentKeys()) == 2 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"tmux", "send-keys", "-t", session.sanitizedName, "-l", "y\r"}, sentKeys()[1])
+	// Once sent, the next prompt is answered again.
+	require.Eventually(t, func() bool { return !session.confirmPending.Load() }, time.Second, 10*time.Millisecond)
+}
+
+func TestCleanupSessionsByPrefixKeep(t *testing.T) {
+	var killed []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			killed = append(killed, cmd.Args[len(cmd.Args)-1])
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return []byte("claudesquad_abc_one: 1 windows\nclaudesquad_abc_two: 1 windows\nother: 1 windows\n"), nil
+		},
+	}
+
+	require.NoError(t, CleanupSessionsByPrefix(cmdExec, "claudesquad_abc", []string{"claudesquad_abc_two"}, nil))
+	require.Equal(t, []string{"claudesquad_abc_one"}, killed)
+}
+
+func TestAttachTerminalInsideTmux(t *testing.T) {
+	t.Setenv("TMUX", "/tmp/tmux-1000/default,1234,0")
+
+	var cmds []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			cmds = append(cmds, cmd2.ToString(cmd))
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return nil, nil
+		},
+	}
+	session := newTmuxSession("test-session", "claude", t.TempDir(), NewMockPtyFactory(t), cmdExec)
+
+	require.NoError(t, session.AttachTerminal())
+	require.Equal(t, []string{"tmux switch-client -t " + session.sanitizedName}, cmds)
 }
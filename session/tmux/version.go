@@ -0,0 +1,124 @@
+package tmux
+
+import (
+	"claude-squad/cmd"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is a tmux release, e.g. {3, 3} for 3.3a. The letter of bugfix releases is dropped, since features only
+// arrive in minor releases.
+type Version struct {
+	Major int
+	Minor int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// AtLeast reports whether v is other or a later release.
+func (v Version) AtLeast(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	return v.Minor >= other.Minor
+}
+
+// tmuxVersionRegex matches the release number in tmux -V output such as "tmux 3.3a", "tmux next-3.5" or
+// "tmux 3.4-rc".
+var tmuxVersionRegex = regexp.MustCompile(`^tmux (?:next-)?(\d+)\.(\d+)`)
+
+// ParseVersion parses the output of tmux -V. Builds that don't print a release number, like "tmux master" or
+// OpenBSD's "tmux openbsd-7.4", return an error.
+func ParseVersion(output string) (Version, error) {
+	output = strings.TrimSpace(output)
+	match := tmuxVersionRegex.FindStringSubmatch(output)
+	if match == nil {
+		return Version{}, fmt.Errorf("unrecognized tmux version %q", output)
+	}
+	major, err := strconv.Atoi(match[1])
+	if err != nil {
+		return Version{}, fmt.Errorf("unrecognized tmux version %q", output)
+	}
+	minor, err := strconv.Atoi(match[2])
+	if err != nil {
+		return Version{}, fmt.Errorf("unrecognized tmux version %q", output)
+	}
+	return Version{Major: major, Minor: minor}, nil
+}
+
+var (
+	installedVersionOnce sync.Once
+	installedVersion     Version
+	installedVersionErr  error
+)
+
+// InstalledVersion returns the version of the tmux in PATH. It's only asked once per process.
+func InstalledVersion() (Version, error) {
+	installedVersionOnce.Do(func() {
+		output, err := cmd.MakeExecutor().Output(exec.Command("tmux", "-V"))
+		if err != nil {
+			installedVersionErr = fmt.Errorf("failed to get tmux version: %w", err)
+			return
+		}
+		installedVersion, installedVersionErr = ParseVersion(string(output))
+	})
+	return installedVersion, installedVersionErr
+}
+
+// Feature is something cs uses that older tmux releases lack.
+type Feature struct {
+	Name string
+	// Since is the first release that has it.
+	Since Version
+}
+
+var (
+	// FeatureSessionEnv is looking up a single variable of a session's environment, which is how cs tracks which
+	// repository a session belongs to, e.g. to find orphaned sessions.
+	FeatureSessionEnv = Feature{Name: "session environment lookups", Since: Version{Major: 1, Minor: 8}}
+	// FeatureMouse is the mouse option, which lets the mouse wheel scroll a session.
+	FeatureMouse = Feature{Name: "the mouse option", Since: Version{Major: 2, Minor: 1}}
+	// FeatureOptionFormats is set-option -F with options in formats, with which a command can set an option for the
+	// commands after it and restore it.
+	FeatureOptionFormats = Feature{Name: "set-option -F", Since: Version{Major: 2, Minor: 6}}
+	// FeatureWindowSizeLatest is window-size latest, which makes a window follow the most recently active client.
+	FeatureWindowSizeLatest = Feature{Name: "window-size latest", Since: Version{Major: 3, Minor: 1}}
+)
+
+// Features lists every Feature, oldest first.
+var Features = []Feature{FeatureSessionEnv, FeatureMouse, FeatureOptionFormats, FeatureWindowSizeLatest}
+
+// Supports reports whether tmux version v has the feature.
+func (v Version) Supports(f Feature) bool {
+	return v.AtLeast(f.Since)
+}
+
+// MissingFeatures returns the features tmux version v lacks.
+func (v Version) MissingFeatures() []Feature {
+	var missing []Feature
+	for _, f := range Features {
+		if !v.Supports(f) {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// supported reports whether the installed tmux has the feature. If its version is unknown, e.g. for a build from
+// master, it's assumed to be recent enough.
+func supported(f Feature) bool {
+	v, err := InstalledVersion()
+	return err != nil || v.Supports(f)
+}
+
+// unsupportedError says the installed tmux is too old for the feature.
+func unsupportedError(f Feature) error {
+	v, _ := InstalledVersion()
+	return fmt.Errorf("tmux %s is too old for %s, which needs tmux %s or later", v, f.Name, f.Since)
+}
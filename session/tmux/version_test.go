@@ -0,0 +1,36 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	for output, want := range map[string]Version{
+		"tmux 3.3a\n":   {Major: 3, Minor: 3},
+		"tmux 1.8":      {Major: 1, Minor: 8},
+		"tmux next-3.5": {Major: 3, Minor: 5},
+		"tmux 3.4-rc":   {Major: 3, Minor: 4},
+		"tmux 2.10":     {Major: 2, Minor: 10},
+	} {
+		v, err := ParseVersion(output)
+		require.NoError(t, err, output)
+		require.Equal(t, want, v, output)
+	}
+
+	for _, output := range []string{"tmux master", "tmux openbsd-7.4", ""} {
+		_, err := ParseVersion(output)
+		require.Error(t, err, output)
+	}
+}
+
+func TestVersionFeatures(t *testing.T) {
+	require.True(t, Version{Major: 2, Minor: 10}.AtLeast(Version{Major: 2, Minor: 9}))
+	require.False(t, Version{Major: 2, Minor: 9}.AtLeast(Version{Major: 3, Minor: 0}))
+	require.True(t, Version{Major: 3, Minor: 0}.AtLeast(Version{Major: 2, Minor: 10}))
+
+	require.Empty(t, Version{Major: 3, Minor: 3}.MissingFeatures())
+	require.Equal(t, []Feature{FeatureWindowSizeLatest}, Version{Major: 2, Minor: 9}.MissingFeatures())
+	require.Equal(t, Features, Version{Major: 1, Minor: 6}.MissingFeatures())
+}
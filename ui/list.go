@@ -1,18 +1,23 @@
 package ui
 
 import (
+	"claude-squad/humanize"
 	"claude-squad/log"
 	"claude-squad/session"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
 )
 
 const readyIcon = "● "
 const pausedIcon = "⏸ "
+const crashedIcon = "✗ "
+const doneIcon = "✓ "
 
 var readyStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#51bd73", Dark: "#51bd73"})
@@ -23,6 +28,9 @@ var addedLinesStyle = lipgloss.NewStyle().
 var removedLinesStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.Color("#de613e"))
 
+var crashedStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#de613e"))
+
 var pausedStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#888888", Dark: "#888888"})
 
@@ -130,18 +138,35 @@ func (r *InstanceRenderer) Render(i *session.Instance, idx int, selected bool, h
 	switch i.Status {
 	case session.Running:
 		join = fmt.Sprintf("%s ", r.spinner.View())
-	case session.Ready:
+	case session.Idle:
 		join = readyStyle.Render(readyIcon)
 	case session.Paused:
 		join = pausedStyle.Render(pausedIcon)
+	case session.Crashed:
+		join = crashedStyle.Render(crashedIcon)
+	case session.Done:
+		join = readyStyle.Render(doneIcon)
 	default:
 	}
 
 	// Cut the title if it's too long
 	titleText := i.Title
+	// Flag instances that override the global autoyes setting
+	if i.AutoYesOverride != nil {
+		if *i.AutoYesOverride {
+			titleText += " [auto-yes]"
+		} else {
+			titleText += " [no auto-yes]"
+		}
+	}
+	// and those whose program is treated as another agent than the one it looks like
+	if i.Agent != "" {
+		titleText += " [agent " + i.Agent + "]"
+	}
 	widthAvail := r.width - 3 - len(prefix) - 1
-	if widthAvail > 0 && widthAvail < len(titleText) && len(titleText) >= widthAvail-3 {
-		titleText = titleText[:widthAvail-3] + "..."
+	if widthAvail > 0 && widthAvail < runewidth.StringWidth(titleText) {
+		// Truncate by display width so multi-byte titles (CJK, emoji) aren't cut mid-character.
+		titleText = runewidth.Truncate(titleText, widthAvail, "...")
 	}
 	title := titleS.Render(lipgloss.JoinHorizontal(
 		lipgloss.Left,
@@ -204,13 +229,20 @@ func (r *InstanceRenderer) Render(i *session.Instance, idx int, selected bool, h
 	}
 	remainingWidth -= len(branch)
 
+	// Show how long ago the instance was created if there's room left, the way cs list does.
+	age := humanize.Ago(i.CreatedAt, time.Now()) + " "
+	if remainingWidth < len(age)+1 {
+		age = ""
+	}
+	remainingWidth -= len(age)
+
 	// Add spaces to fill the remaining width.
 	spaces := ""
 	if remainingWidth > 0 {
 		spaces = strings.Repeat(" ", remainingWidth)
 	}
 
-	branchLine := fmt.Sprintf("%s %s-%s%s%s", strings.Repeat(" ", len(prefix)), branchIcon, branch, spaces, diff)
+	branchLine := fmt.Sprintf("%s %s-%s%s%s%s", strings.Repeat(" ", len(prefix)), branchIcon, branch, spaces, age, diff)
 
 	// join title and subtitle
 	text := lipgloss.JoinVertical(
@@ -14,6 +14,9 @@ type SingleLineInputOverlay struct {
 	Canceled      bool
 	OnSubmit      func()
 	width, height int
+
+	// Description is shown between the title and the input, e.g. what submitting will do. Empty shows nothing.
+	Description string
 }
 
 // NewSingleLineInputOverlay creates a new single-line input overlay with the given title and initial value.
@@ -103,12 +106,19 @@ func (s *SingleLineInputOverlay) Render() string {
 		Bold(true).
 		MarginBottom(1)
 
+	descriptionStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color("245")).
+		MarginBottom(1)
+
 	helpStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("240")).
 		MarginTop(1)
 
 	// Build the view
 	content := titleStyle.Render(s.Title) + "\n"
+	if s.Description != "" {
+		content += descriptionStyle.Render(s.Description) + "\n"
+	}
 	content += s.textinput.View() + "\n"
 	content += helpStyle.Render("(Enter to submit, Esc to cancel)")
 
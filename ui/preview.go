@@ -7,18 +7,24 @@ import (
 
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
 )
 
 var previewPaneStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"})
 
+var previewNoteStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.AdaptiveColor{Light: "#808080", Dark: "#808080"})
+
 type PreviewPane struct {
 	width  int
 	height int
 
 	previewState previewState
 	isScrolling  bool
-	viewport     viewport.Model
+	// note is the selected instance's note, shown above its preview.
+	note     string
+	viewport viewport.Model
 }
 
 type previewState struct {
@@ -51,6 +57,12 @@ func (p *PreviewPane) setFallbackState(message string) {
 
 // Updates the preview pane content with the tmux pane content
 func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
+	p.note = ""
+	if instance != nil {
+		// Keep the note on one line.
+		p.note = strings.Join(strings.Fields(instance.Notes), " ")
+	}
+
 	switch {
 	case instance == nil:
 		p.setFallbackState("No agents running yet. Spin up a new instance with 'n' to get started!")
@@ -69,6 +81,10 @@ func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
 					instance.Branch,
 				)),
 		))
+		if p.note != "" {
+			p.previewState.text = lipgloss.JoinVertical(lipgloss.Center, p.previewState.text, "",
+				previewNoteStyle.Render("Note: "+p.note))
+		}
 		return nil
 	}
 
@@ -160,6 +176,12 @@ func (p *PreviewPane) String() string {
 	// Calculate available height accounting for border and margin
 	availableHeight := p.height - 1 //  1 for ellipsis
 
+	var noteLine string
+	if p.note != "" {
+		noteLine = previewNoteStyle.Render(runewidth.Truncate("Note: "+p.note, p.width, "..."))
+		availableHeight--
+	}
+
 	lines := strings.Split(p.previewState.text, "\n")
 
 	// Truncate if we have more lines than available height
@@ -175,6 +197,9 @@ func (p *PreviewPane) String() string {
 	}
 
 	content := strings.Join(lines, "\n")
+	if noteLine != "" {
+		content = noteLine + "\n" + content
+	}
 	rendered := previewPaneStyle.Width(p.width).Render(content)
 	return rendered
 }
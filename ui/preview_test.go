@@ -387,3 +387,26 @@ func max(a, b int) int {
 	}
 	return b
 }
+
+func TestPreviewShowsNote(t *testing.T) {
+	log.Initialize(false)
+
+	// Paused instances are restored without touching tmux.
+	instance, err := session.FromInstanceData(session.InstanceData{
+		Title:   "task",
+		Path:    t.TempDir(),
+		Branch:  "test/task",
+		Status:  session.Paused,
+		Started: true,
+		Notes:   "blocked on the\nOAuth refactor",
+	})
+	require.NoError(t, err)
+
+	preview := NewPreviewPane()
+	preview.SetSize(100, 30)
+	require.NoError(t, preview.UpdateContent(instance))
+	require.Contains(t, preview.String(), "Note: blocked on the OAuth refactor")
+
+	require.NoError(t, preview.UpdateContent(nil))
+	require.NotContains(t, preview.String(), "Note:")
+}